@@ -0,0 +1,597 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"mysql-tui/dbs"
+	"mysql-tui/dump"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exit codes of the export and import subcommands
+const (
+	exitOK     = 0
+	exitFailed = 1 // the export or import failed, or left objects or rows behind
+	exitUsage  = 2 // bad flags or arguments
+)
+
+// How often the running totals are printed
+const progressInterval = 10 * time.Second
+
+// Connection flags, named as for the TUI. Without -p the password is read from MYSQL_PWD,
+// which keeps it out of the process list when run from cron.
+func connectionFlags(fs *flag.FlagSet) *dump.Connection {
+	conn := &dump.Connection{}
+	fs.StringVar(&conn.User, "u", "", "Username")
+	fs.StringVar(&conn.Password, "p", "", "Password (default $MYSQL_PWD)")
+	fs.StringVar(&conn.Host, "host", "localhost", "Hostname")
+	fs.StringVar(&conn.Port, "port", "3306", "Port number")
+	return conn
+}
+
+func parseFlags(fs *flag.FlagSet, conn *dump.Connection, args []string) bool {
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	if conn.Password == "" {
+		conn.Password = os.Getenv("MYSQL_PWD")
+	}
+	return true
+}
+
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "pheri %s: %s\n", fs.Name(), fmt.Sprintf(format, args...))
+	fs.Usage()
+	return exitUsage
+}
+
+var colorTagRegex = regexp.MustCompile(`^\[(red|yellow|green|blue|gray)\]`)
+
+// Print an export log line to stderr, with its color tag turned into a prefix; quiet keeps only errors
+func printProgressLine(msg string, quiet bool) {
+	tag := colorTagRegex.FindStringSubmatch(msg)
+	text := colorTagRegex.ReplaceAllString(msg, "")
+	prefix := ""
+	if tag != nil {
+		switch tag[1] {
+		case "red":
+			prefix = "error: "
+		case "yellow":
+			prefix = "warning: "
+		}
+	}
+	if quiet && prefix != "error: " {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s %s%s\n", time.Now().Format("15:04:05"), prefix, text)
+}
+
+// pheri export: dump.Export without the TUI
+func runExportCommand(args []string) int {
+	defaults := dump.DefaultExportOptions()
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: pheri export -db NAME [flags]")
+		fs.PrintDefaults()
+	}
+	conn := connectionFlags(fs)
+	database := fs.String("db", "", "Database to export (required)")
+	objectList := fs.String("objects", "", "Comma-separated objects to export, as name or TYPE:name (default all)")
+	typeList := fs.String("types", "", "Comma-separated object types to export: table, view, procedure, function, trigger, event (default all)")
+	format := fs.String("format", "sql", "Output format: sql (one script), split (one file per object type) or xlsx (table and view rows)")
+	content := fs.String("content", defaults.Content, "What to export: both, schema or data")
+	output := fs.String("o", defaults.OutputFile, "Output file")
+	compress := fs.Bool("gzip", defaults.Compress, "Compress the output with gzip")
+	workers := fs.Int("workers", defaults.Workers, "Objects and table chunks exported in parallel")
+	batch := fs.Int("batch", defaults.BatchSize, "Rows per INSERT statement")
+	noDrop := fs.Bool("no-drop", false, "Leave out the DROP ... IF EXISTS statements")
+	grants := fs.Bool("grants", false, "Add the users and grants with privileges on the database")
+	consistent := fs.Bool("consistent", false, "Read every object from one consistent snapshot")
+	resume := fs.Bool("resume", false, "Continue an interrupted export to the same output file")
+	from := fs.String("from", "", "Export a subset: the rows of this table matching -where and the rows tied to them by foreign keys")
+	where := fs.String("where", "", "Condition selecting the starting rows of -from (default all)")
+	limit := fs.Int("limit", 0, "At most this many starting rows of -from (default no limit)")
+	children := fs.Bool("children", false, "With -from, also take the rows referencing the selected ones")
+	depth := fs.Int("depth", 1, "With -children, levels of referencing rows to follow; 0 follows them all")
+	maxRows := fs.Int("max-rows", 0, "With -from, give up when the subset grows past this many rows (default no limit)")
+	maskFile := fs.String("mask", "", "Masking rules file (JSON) applied to the exported rows")
+	quiet := fs.Bool("q", false, "Only print errors and the summary")
+	if !parseFlags(fs, conn, args) {
+		return exitUsage
+	}
+	if *database == "" {
+		return usageError(fs, "-db is required")
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "unexpected argument %q", fs.Arg(0))
+	}
+
+	if *from != "" {
+		if *objectList != "" || *typeList != "" || *resume || *format != "sql" {
+			return usageError(fs, "-from cannot be combined with -objects, -types, -resume or -format")
+		}
+		if *content == dump.ExportContentSchema {
+			return usageError(fs, "-from exports rows; use -content both or data")
+		}
+		if *limit < 0 || *depth < 0 || *maxRows < 0 || *batch < 1 {
+			return usageError(fs, "-limit, -depth and -max-rows cannot be negative, -batch must be positive")
+		}
+		path := *output
+		if path == defaults.OutputFile {
+			path = *database + "_" + *from + "_subset.sql"
+		}
+		if *compress && !strings.HasSuffix(path, ".gz") {
+			path += ".gz"
+		}
+		opts := dump.SubsetOptions{
+			Database:  *database,
+			Table:     *from,
+			Where:     *where,
+			Limit:     *limit,
+			Children:  *children,
+			Depth:     *depth,
+			Schema:    *content == dump.ExportContentBoth,
+			DropTable: *content == dump.ExportContentBoth && !*noDrop,
+			BatchSize: *batch,
+			MaxRows:   *maxRows,
+		}
+		if *maskFile != "" {
+			masker, err := dump.LoadMasker(*maskFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "pheri export: cannot load the masking rules: %v\n", err)
+				return exitFailed
+			}
+			opts.Mask = masker
+		}
+		return runSubsetExport(*conn, opts, path, *compress, *quiet)
+	}
+
+	opts := defaults
+	opts.OutputFile = *output
+	opts.Compress = *compress
+	opts.Workers = *workers
+	opts.BatchSize = *batch
+	opts.DropTables, opts.DropViews, opts.DropRoutines = !*noDrop, !*noDrop, !*noDrop
+	opts.Grants = *grants
+	opts.Consistent = *consistent
+	opts.MaskFile = *maskFile
+	switch *format {
+	case "sql":
+		opts.Layout = dump.ExportLayoutSingle
+	case "split":
+		opts.Layout = dump.ExportLayoutSplit
+	case "xlsx":
+		opts.Layout = dump.ExportLayoutXLSX
+	default:
+		return usageError(fs, "unknown format %q", *format)
+	}
+	switch *content {
+	case dump.ExportContentBoth, dump.ExportContentSchema, dump.ExportContentData:
+		opts.Content = *content
+	default:
+		return usageError(fs, "unknown content %q", *content)
+	}
+	if opts.Workers < 1 || opts.BatchSize < 1 {
+		return usageError(fs, "-workers and -batch must be positive")
+	}
+
+	manifest, err := dump.LoadManifest(opts.OutputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pheri export: cannot read the manifest of an earlier export: %v\n", err)
+		return exitFailed
+	}
+	switch {
+	case *resume && manifest == nil:
+		fmt.Fprintf(os.Stderr, "pheri export: no interrupted export to %s to resume\n", opts.OutputFile)
+		return exitFailed
+	case *resume:
+		// The rest of the export has to match what is already there
+		opts = manifest.Options
+		opts.Resume = true
+		if manifest.Database != *database {
+			fmt.Fprintf(os.Stderr, "pheri export: the interrupted export to %s is of database %s\n", opts.OutputFile, manifest.Database)
+			return exitFailed
+		}
+	default:
+		if manifest != nil {
+			fmt.Fprintf(os.Stderr, "pheri export: discarding the interrupted export to %s (use -resume to continue it)\n", opts.OutputFile)
+		}
+		if opts.Objects, err = selectObjects(*conn, *database, *objectList, *typeList); err != nil {
+			fmt.Fprintf(os.Stderr, "pheri export: %v\n", err)
+			return exitFailed
+		}
+		if len(opts.Objects) == 0 {
+			fmt.Fprintln(os.Stderr, "pheri export: no objects match, nothing to export")
+			return exitFailed
+		}
+	}
+
+	progressChan := make(chan string)
+	progress := dump.NewExportProgress(*database, opts)
+	var printer sync.WaitGroup
+	printer.Add(1)
+	go func() {
+		defer printer.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case msg, ok := <-progressChan:
+				if !ok {
+					return
+				}
+				printProgressLine(msg, *quiet)
+			case <-ticker.C:
+				if !*quiet {
+					printTotals(progress.Totals())
+				}
+			}
+		}
+	}()
+
+	failed, err := dump.Export(*conn, *database, opts, progressChan, progress)
+	close(progressChan)
+	printer.Wait()
+
+	fmt.Fprintln(os.Stderr, progress.Summary(err, len(failed)))
+	// The progress also knows of failures a layout does not return
+	if err != nil || len(failed) > 0 || progress.Totals().Failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// pheri export -from: a foreign-key-closed subset of rows as one INSERT script
+func runSubsetExport(conn dump.Connection, opts dump.SubsetOptions, output string, compress, quiet bool) int {
+	db, err := sql.Open("mysql", conn.DSN(opts.Database))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pheri export: %v\n", err)
+		return exitFailed
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	var lastPrint time.Time
+	total := map[string]int{}
+	onProgress := func(t dump.SubsetTable) {
+		total[t.Name] = t.Rows
+		if quiet || time.Since(lastPrint) < progressInterval {
+			return
+		}
+		lastPrint = time.Now()
+		rows := 0
+		for _, n := range total {
+			rows += n
+		}
+		fmt.Fprintf(os.Stderr, "%s progress: %d rows in %d tables\n", time.Now().Format("15:04:05"), rows, len(total))
+	}
+
+	tables, err := dump.ExportSubset(ctx, db, output, compress, opts, onProgress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pheri export: subset of %s.%s failed: %v\n", opts.Database, opts.Table, err)
+		return exitFailed
+	}
+	rows := 0
+	for _, t := range tables {
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "%s %s: %d rows\n", time.Now().Format("15:04:05"), t.Name, t.Rows)
+		}
+		rows += t.Rows
+	}
+	fmt.Fprintf(os.Stderr, "Subset export finished: %d rows of %d table(s) written to %s in %s\n",
+		rows, len(tables), output, time.Since(started).Round(time.Second))
+	return exitOK
+}
+
+func printTotals(t dump.ExportTotals) {
+	line := fmt.Sprintf("progress: %d/%d objects", t.Done+t.Skipped, t.Objects)
+	if t.Failed > 0 {
+		line += fmt.Sprintf(", %d failed", t.Failed)
+	}
+	line += fmt.Sprintf(", %d/~%d rows, %s, %.0f rows/s", t.Rows, t.Estimated, dump.FormatBytes(t.Bytes), t.RowsPerSecond)
+	if t.ETA > 0 {
+		line += ", ETA " + t.ETA.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format("15:04:05"), line)
+}
+
+// Objects of the database picked by -objects and -types; names that match nothing are an error
+func selectObjects(conn dump.Connection, database, objectList, typeList string) ([]dump.Object, error) {
+	db, err := sql.Open("mysql", conn.DSN(database))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	all, err := dump.ListObjects(context.Background(), db, database)
+	if err != nil {
+		return nil, err
+	}
+
+	types := map[string]bool{}
+	for _, t := range splitList(typeList) {
+		t = strings.ToUpper(t)
+		switch t {
+		case "TABLE", "VIEW", "PROCEDURE", "FUNCTION", "TRIGGER", "EVENT":
+			types[t] = true
+		default:
+			return nil, fmt.Errorf("unknown object type %q", t)
+		}
+	}
+
+	// name, or TYPE:name -> seen
+	wanted := map[string]bool{}
+	for _, name := range splitList(objectList) {
+		if typ, rest, ok := strings.Cut(name, ":"); ok {
+			name = strings.ToUpper(typ) + ":" + rest
+		}
+		wanted[name] = false
+	}
+
+	var selected []dump.Object
+	for _, obj := range all {
+		if len(types) > 0 && !types[obj.Type] {
+			continue
+		}
+		if len(wanted) > 0 {
+			_, byName := wanted[obj.Name]
+			_, byTypedName := wanted[obj.Type+":"+obj.Name]
+			if !byName && !byTypedName {
+				continue
+			}
+			if byName {
+				wanted[obj.Name] = true
+			}
+			if byTypedName {
+				wanted[obj.Type+":"+obj.Name] = true
+			}
+		}
+		selected = append(selected, obj)
+	}
+
+	var missing []string
+	for name, seen := range wanted {
+		if !seen {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("not found in %s: %s", database, strings.Join(missing, ", "))
+	}
+	return selected, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// pheri import: a SQL dump through dump.Restore, or a CSV file through dump.ImportCSV
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: pheri import -db NAME [flags] FILE")
+		fs.PrintDefaults()
+	}
+	conn := connectionFlags(fs)
+	database := fs.String("db", "", "Database to import into (required)")
+	format := fs.String("format", "", "sql or csv (default from the file name: .csv, .tsv and .txt are csv)")
+	skipErrors := fs.Bool("continue", false, "sql: skip failing statements instead of stopping at the first")
+	table := fs.String("table", "", "csv: target table (default the file name)")
+	delimiter := fs.String("delimiter", "", `csv: field delimiter, "\t" for tab (default "," or tab for .tsv)`)
+	hasHeader := fs.Bool("header", true, "csv: the first line holds the column names")
+	columnList := fs.String("columns", "", "csv: comma-separated target column for each CSV column, empty to skip one (default the header)")
+	encoding := fs.String("encoding", "UTF-8", "csv: character set: "+strings.Join(dump.CSVEncodings, ", "))
+	nullToken := fs.String("null", "", `csv: unquoted field value read as NULL, e.g. \N (default empty fields)`)
+	create := fs.Bool("create", false, "csv: create the table with inferred column types when it does not exist")
+	batch := fs.Int("batch", 1000, "csv: rows per INSERT statement")
+	rollback := fs.Bool("rollback-on-reject", false, "csv: roll the whole import back when any row is rejected")
+	quiet := fs.Bool("q", false, "Only print errors and the summary")
+	if !parseFlags(fs, conn, args) {
+		return exitUsage
+	}
+	if *database == "" {
+		return usageError(fs, "-db is required")
+	}
+	if fs.NArg() != 1 {
+		return usageError(fs, "expected one file to import")
+	}
+	file := fs.Arg(0)
+
+	if *format == "" {
+		*format = "sql"
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".csv", ".tsv", ".txt":
+			*format = "csv"
+		}
+	}
+	if *format != "sql" && *format != "csv" {
+		return usageError(fs, "unknown format %q", *format)
+	}
+
+	db, err := dbs.Connect(conn.User, conn.Password, conn.Host, conn.Port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pheri import: %v\n", err)
+		return exitFailed
+	}
+	defer db.Close()
+
+	// Ctrl+C stops the import; a CSV import is then rolled back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *format == "sql" {
+		return importSQL(ctx, db, dump.RestoreOptions{File: file, Database: *database, StopOnError: !*skipErrors}, *quiet)
+	}
+
+	opts := dump.CSVImportOptions{
+		CSVOptions: dump.CSVOptions{
+			File:      file,
+			Delimiter: ',',
+			Quote:     '"',
+			Header:    *hasHeader,
+			Encoding:  *encoding,
+			NullToken: *nullToken,
+		},
+		Database:         *database,
+		Table:            *table,
+		BatchSize:        *batch,
+		RollbackOnReject: *rollback,
+	}
+	switch {
+	case *delimiter == `\t`:
+		opts.Delimiter = '\t'
+	case *delimiter != "":
+		opts.Delimiter = []rune(*delimiter)[0]
+	case strings.EqualFold(filepath.Ext(file), ".tsv"):
+		opts.Delimiter = '\t'
+	}
+	if opts.Table == "" {
+		opts.Table = dump.TableNameForFile(file)
+	}
+	header, err := planCSVImport(ctx, db, &opts, splitColumns(*columnList), *create)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pheri import: %v\n", err)
+		return exitFailed
+	}
+	return importCSV(ctx, db, opts, header, *quiet)
+}
+
+// -columns keeps empty entries, they skip a CSV column
+func splitColumns(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	columns := strings.Split(s, ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	return columns
+}
+
+// Map the CSV columns onto the table and, with create, plan a CREATE TABLE when there is no table yet.
+// It returns the CSV header, named column_1, column_2... when the file has none.
+func planCSVImport(ctx context.Context, db *sql.DB, opts *dump.CSVImportOptions, columns []string, create bool) ([]string, error) {
+	header, sample, err := dump.PreviewCSV(opts.CSVOptions, 1000)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		if !opts.Header {
+			return nil, fmt.Errorf("without a header line, -columns has to name the target columns")
+		}
+		columns = dump.ColumnNames(header)
+	}
+	if len(columns) != len(header) {
+		return nil, fmt.Errorf("-columns names %d column(s), the file has %d", len(columns), len(header))
+	}
+	opts.Columns = columns
+
+	existing, err := dump.TableColumns(ctx, db, opts.Database, opts.Table)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return header, nil
+	}
+	if !create {
+		return nil, fmt.Errorf("table %s.%s does not exist (use -create to create it)", opts.Database, opts.Table)
+	}
+
+	types := dump.InferColumnTypes(len(header), sample)
+	var names, mappedTypes []string
+	for i, col := range columns {
+		if col != "" {
+			names = append(names, col)
+			mappedTypes = append(mappedTypes, types[i])
+		}
+	}
+	opts.CreateTable = dump.CreateTableSQL(opts.Table, names, mappedTypes)
+	return header, nil
+}
+
+func importSQL(ctx context.Context, db *sql.DB, opts dump.RestoreOptions, quiet bool) int {
+	lastPrint := time.Now()
+	onProgress := func(p dump.RestoreProgress) {
+		if quiet || time.Since(lastPrint) < progressInterval {
+			return
+		}
+		lastPrint = time.Now()
+		fmt.Fprintf(os.Stderr, "%s progress: %s of %s, %d statement(s), %d failed\n", time.Now().Format("15:04:05"),
+			dump.FormatBytes(p.BytesRead), dump.FormatBytes(p.TotalBytes), p.Statements, p.Failed)
+	}
+	onError := func(e dump.RestoreError) {
+		fmt.Fprintf(os.Stderr, "%s error: %v\n    %s\n", time.Now().Format("15:04:05"), e, dump.Abbreviate(e.Statement, 200))
+	}
+
+	started := time.Now()
+	progress, err := dump.Restore(ctx, db, opts, onProgress, onError)
+	elapsed := time.Since(started).Round(time.Second)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Import failed after %d statement(s): %v\n", progress.Statements, err)
+		return exitFailed
+	case progress.Failed > 0:
+		fmt.Fprintf(os.Stderr, "Import finished in %s: %d statement(s), %d failed.\n", elapsed, progress.Statements, progress.Failed)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "Import completed in %s: %d statement(s).\n", elapsed, progress.Statements)
+	return exitOK
+}
+
+func importCSV(ctx context.Context, db *sql.DB, opts dump.CSVImportOptions, header []string, quiet bool) int {
+	report := &dump.RejectedReport{Path: opts.File + ".rejected.csv", Header: header, NullToken: opts.NullToken}
+
+	lastPrint := time.Now()
+	onProgress := func(p dump.ImportProgress) {
+		if quiet || time.Since(lastPrint) < progressInterval {
+			return
+		}
+		lastPrint = time.Now()
+		fmt.Fprintf(os.Stderr, "%s progress: %s of %s, %d row(s), %d inserted, %d rejected\n", time.Now().Format("15:04:05"),
+			dump.FormatBytes(p.BytesRead), dump.FormatBytes(p.TotalBytes), p.Rows, p.Inserted, p.Rejected)
+	}
+	onReject := func(r dump.RejectedRow) {
+		report.Add(r)
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "%s warning: line %d rejected: %v\n", time.Now().Format("15:04:05"), r.Line, r.Err)
+		}
+	}
+
+	started := time.Now()
+	progress, err := dump.ImportCSV(ctx, db, opts, onProgress, onReject)
+	if reportErr := report.Close(); reportErr != nil {
+		fmt.Fprintf(os.Stderr, "pheri import: cannot write rejected rows: %v\n", reportErr)
+	}
+	summary := fmt.Sprintf("%d row(s) read, %d inserted, %d rejected in %s", progress.Rows, progress.Inserted, progress.Rejected,
+		time.Since(started).Round(time.Second))
+	if progress.Rejected > 0 {
+		summary += ", rejected rows written to " + report.Path
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Import failed, nothing was committed: %v (%s)\n", err, summary)
+		return exitFailed
+	case progress.Rejected > 0:
+		fmt.Fprintf(os.Stderr, "Import finished with rejected rows: %s.\n", summary)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "Import completed: %s.\n", summary)
+	return exitOK
+}
@@ -0,0 +1,660 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// CSVEncodings lists the character sets a CSV file can be read in
+var CSVEncodings = []string{"UTF-8", "UTF-16LE", "UTF-16BE", "ISO-8859-1", "Windows-1252"}
+
+// CSVOptions describes how a delimited text file is read
+type CSVOptions struct {
+	File      string
+	Delimiter rune
+	Quote     rune   // 0 reads quote characters literally
+	Header    bool   // the first record names the columns
+	Encoding  string // one of CSVEncodings; empty means UTF-8
+	NullToken string // an unquoted field equal to this is NULL, e.g. `\N`; "" makes empty unquoted fields NULL
+}
+
+// CSVReader reads records of a CSV file with a configurable delimiter and quote character.
+// Quoted fields may span lines and escape the quote by doubling it.
+type CSVReader struct {
+	Header     []string // column names when CSVOptions.Header is set
+	TotalBytes int64
+
+	r         *bufio.Reader
+	file      io.Closer
+	bytesRead func() int64
+	opts      CSVOptions
+	line      int
+	next      int
+}
+
+func csvDecoder(name string) (*encoding.Decoder, error) {
+	switch strings.ToUpper(name) {
+	case "", "UTF-8", "UTF8":
+		return unicode.UTF8BOM.NewDecoder(), nil
+	case "UTF-16LE":
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder(), nil
+	case "UTF-16BE":
+		return unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder(), nil
+	case "ISO-8859-1", "LATIN1":
+		return charmap.ISO8859_1.NewDecoder(), nil
+	case "WINDOWS-1252", "CP1252":
+		return charmap.Windows1252.NewDecoder(), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", name)
+}
+
+// OpenCSV opens a CSV file, which may be gzip-compressed, and reads its header row when opts.Header is set
+func OpenCSV(opts CSVOptions) (*CSVReader, error) {
+	decoder, err := csvDecoder(opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.Delimiter == opts.Quote {
+		return nil, fmt.Errorf("the delimiter and the quote character must differ")
+	}
+
+	file, bytesRead, total, err := OpenDump(opts.File)
+	if err != nil {
+		return nil, err
+	}
+	c := &CSVReader{
+		TotalBytes: total,
+		r:          bufio.NewReaderSize(transform.NewReader(file, decoder), 64*1024),
+		file:       file,
+		bytesRead:  bytesRead,
+		opts:       opts,
+		next:       1,
+	}
+
+	if opts.Header {
+		fields, err := c.Read()
+		if err == io.EOF {
+			file.Close()
+			return nil, fmt.Errorf("%s is empty", opts.File)
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		for _, f := range fields {
+			c.Header = append(c.Header, f.String)
+		}
+	}
+	return c, nil
+}
+
+// Close closes the underlying file
+func (c *CSVReader) Close() error { return c.file.Close() }
+
+// Line is the line the last record started on
+func (c *CSVReader) Line() int { return c.line }
+
+// BytesRead is how much of the file has been read (compressed bytes for .gz)
+func (c *CSVReader) BytesRead() int64 { return c.bytesRead() }
+
+// Read returns the next record; blank lines are skipped and io.EOF ends the file
+func (c *CSVReader) Read() ([]sql.NullString, error) {
+	var fields []sql.NullString
+	var field strings.Builder
+	inQuotes, quoted, started := false, false, false
+
+	endField := func() {
+		value := field.String()
+		null := !quoted && value == c.opts.NullToken
+		fields = append(fields, sql.NullString{String: value, Valid: !null})
+		field.Reset()
+		quoted = false
+	}
+
+	for {
+		r, _, err := c.r.ReadRune()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, fmt.Errorf("line %d: unterminated quoted field", c.line)
+			}
+			if !started {
+				return nil, io.EOF
+			}
+			endField()
+			return fields, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !started {
+			if r == '\n' {
+				c.next++
+				continue
+			}
+			if r == '\r' {
+				continue
+			}
+			started = true
+			c.line = c.next
+		}
+
+		if inQuotes {
+			if r == c.opts.Quote {
+				if p, _, err := c.r.ReadRune(); err == nil {
+					if p == c.opts.Quote {
+						field.WriteRune(r)
+						continue
+					}
+					c.r.UnreadRune()
+				}
+				inQuotes = false
+				continue
+			}
+			if r == '\n' {
+				c.next++
+			}
+			field.WriteRune(r)
+			continue
+		}
+
+		switch {
+		case r == c.opts.Quote && c.opts.Quote != 0 && field.Len() == 0 && !quoted:
+			inQuotes, quoted = true, true
+		case r == c.opts.Delimiter:
+			endField()
+		case r == '\r':
+			if p, _, err := c.r.ReadRune(); err == nil && p != '\n' {
+				c.r.UnreadRune()
+				field.WriteRune(r)
+				continue
+			} else if err == nil {
+				c.next++
+				endField()
+				return fields, nil
+			}
+		case r == '\n':
+			c.next++
+			endField()
+			return fields, nil
+		default:
+			field.WriteRune(r)
+		}
+	}
+}
+
+// PreviewCSV reads up to limit records, returning the column names (from the header or column_N) and the rows
+func PreviewCSV(opts CSVOptions, limit int) ([]string, [][]sql.NullString, error) {
+	reader, err := OpenCSV(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+
+	var rows [][]sql.NullString
+	width := len(reader.Header)
+	for len(rows) < limit {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, fields)
+		if len(fields) > width {
+			width = len(fields)
+		}
+	}
+
+	header := append([]string(nil), reader.Header...)
+	for i := len(header); i < width; i++ {
+		header = append(header, fmt.Sprintf("column_%d", i+1))
+	}
+	return header, rows, nil
+}
+
+// ColumnNames turns CSV header fields into unique column names of at most 64 characters
+func ColumnNames(header []string) []string {
+	names := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, h := range header {
+		name := strings.TrimSpace(h)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		name = truncateRunes(name, 64)
+		base := name
+		for n := 2; seen[strings.ToLower(name)]; n++ {
+			suffix := fmt.Sprintf("_%d", n)
+			name = truncateRunes(base, 64-len(suffix)) + suffix
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+var (
+	csvIntRegex      = regexp.MustCompile(`^[-+]?(0|[1-9]\d*)$`)
+	csvDecimalRegex  = regexp.MustCompile(`^[-+]?(0|[1-9]\d*)?\.(\d+)$`)
+	csvDoubleRegex   = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)[eE][-+]?\d+$`)
+	csvDateRegex     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	csvDateTimeRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}(:\d{2}(\.\d{1,6})?)?$`)
+)
+
+// InferColumnTypes picks a MySQL type for each column from sample rows; NULLs and blank values are ignored.
+// Numbers with leading zeros stay text, so codes such as "00123" keep their digits.
+func InferColumnTypes(width int, rows [][]sql.NullString) []string {
+	types := make([]string, width)
+	for col := 0; col < width; col++ {
+		isInt, isDecimal, isDouble, isDate, isDateTime := true, true, true, true, true
+		hasValue, fraction := false, false
+		intDigits, scale, maxLen := 0, 0, 0
+
+		for _, row := range rows {
+			if col >= len(row) || !row[col].Valid {
+				continue
+			}
+			v := strings.TrimSpace(row[col].String)
+			if v == "" {
+				continue
+			}
+			hasValue = true
+			if n := utf8.RuneCountInString(row[col].String); n > maxLen {
+				maxLen = n
+			}
+			digits := strings.TrimLeft(v, "+-")
+
+			if csvIntRegex.MatchString(v) {
+				intDigits = max(intDigits, len(digits))
+			} else {
+				isInt = false
+				if m := csvDecimalRegex.FindStringSubmatch(v); m != nil {
+					intDigits = max(intDigits, len(m[1]))
+					scale = max(scale, len(m[2]))
+				} else {
+					isDecimal = false
+					if !csvDoubleRegex.MatchString(v) {
+						isDouble = false
+					}
+				}
+			}
+			if !csvDateRegex.MatchString(v) {
+				isDate = false
+				if !csvDateTimeRegex.MatchString(v) {
+					isDateTime = false
+				} else if strings.Contains(v[10:], ".") {
+					fraction = true
+				}
+			}
+		}
+
+		switch {
+		case !hasValue:
+			types[col] = "VARCHAR(255)"
+		case isInt && intDigits <= 9:
+			types[col] = "INT"
+		case isInt && intDigits <= 18:
+			types[col] = "BIGINT"
+		case (isInt || isDecimal) && intDigits+scale <= 65 && scale <= 30:
+			types[col] = fmt.Sprintf("DECIMAL(%d,%d)", max(intDigits+scale, 1), scale)
+		case isInt || isDecimal || isDouble:
+			types[col] = "DOUBLE"
+		case isDate:
+			types[col] = "DATE"
+		case isDateTime && fraction:
+			types[col] = "DATETIME(6)"
+		case isDateTime:
+			types[col] = "DATETIME"
+		case maxLen <= 255:
+			types[col] = "VARCHAR(255)"
+		case maxLen <= 16383:
+			types[col] = "TEXT"
+		default:
+			types[col] = "MEDIUMTEXT"
+		}
+	}
+	return types
+}
+
+// CreateTableSQL is the CREATE TABLE statement for a table of the given columns and types
+func CreateTableSQL(table string, columns, types []string) string {
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		defs[i] = fmt.Sprintf("  %s %s NULL", QuoteIdent(col), types[i])
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n) DEFAULT CHARSET=utf8mb4", QuoteIdent(table), strings.Join(defs, ",\n"))
+}
+
+// CSVImportOptions controls ImportCSV
+type CSVImportOptions struct {
+	CSVOptions
+	Database         string
+	Table            string
+	Columns          []string // target column for each CSV column; "" skips the CSV column
+	CreateTable      string   // statement run before the import, e.g. from CreateTableSQL
+	BatchSize        int      // rows per INSERT; 0 means 1000
+	RollbackOnReject bool     // roll the whole import back when any row is rejected
+}
+
+// ImportProgress is a snapshot of a running import
+type ImportProgress struct {
+	BytesRead  int64
+	TotalBytes int64
+	Rows       int // records read, excluding the header
+	Inserted   int
+	Rejected   int
+}
+
+// RejectedRow is a record that could not be inserted
+type RejectedRow struct {
+	Line   int
+	Fields []sql.NullString
+	Err    error
+}
+
+// RejectedReport writes rejected rows to a CSV file, each with its line and the reason, ready to fix and
+// re-import. The file is only created once a row is rejected. It is safe for concurrent use.
+type RejectedReport struct {
+	Path      string
+	Header    []string // CSV header, written after the line and error columns
+	NullToken string   // written for NULL fields
+
+	mu   sync.Mutex
+	file *os.File
+	w    *csv.Writer
+	err  error
+}
+
+// Add writes one rejected row
+func (r *RejectedReport) Add(row RejectedRow) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil && r.err == nil {
+		r.file, r.err = os.Create(r.Path)
+		if r.err != nil {
+			return
+		}
+		r.w = csv.NewWriter(r.file)
+		r.w.Write(append([]string{"line", "error"}, r.Header...))
+	}
+	if r.w == nil {
+		return
+	}
+	record := []string{strconv.Itoa(row.Line), row.Err.Error()}
+	for _, f := range row.Fields {
+		if f.Valid {
+			record = append(record, f.String)
+		} else {
+			record = append(record, r.NullToken)
+		}
+	}
+	r.w.Write(record)
+}
+
+// Close flushes the report; it returns the first error met writing it
+func (r *RejectedReport) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return r.err
+	}
+	r.w.Flush()
+	if err := r.w.Error(); r.err == nil {
+		r.err = err
+	}
+	if err := r.file.Close(); r.err == nil {
+		r.err = err
+	}
+	r.file = nil
+	return r.err
+}
+
+var tableNameRegex = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// TableNameForFile suggests a table name for importing a file: its base name up to the first dot,
+// with anything but letters, digits and underscores replaced
+func TableNameForFile(path string) string {
+	name := strings.Trim(tableNameRegex.ReplaceAllString(strings.SplitN(filepath.Base(path), ".", 2)[0], "_"), "_")
+	if name == "" {
+		return "imported_rows"
+	}
+	return name
+}
+
+// TableColumns lists the column names of a table in their defined order; empty when the table does not exist
+func TableColumns(ctx context.Context, q Querier, database, table string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT COLUMN_NAME
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ?
+		  AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`, database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// A deadlock (1213) rolls back the whole transaction, and so does a lock wait timeout (1205) when
+// innodb_rollback_on_timeout is on; the rows inserted so far are gone and the import cannot go on
+func rolledBackTransaction(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1213 || mysqlErr.Number == 1205)
+}
+
+type pendingRow struct {
+	line   int
+	fields []sql.NullString
+	tuple  string
+}
+
+// ImportCSV loads a CSV file into a table with batched INSERTs inside one transaction.
+// A batch that fails is retried row by row so that only the offending rows are rejected; a deadlock or
+// lock wait timeout ends the import with an error instead, as the transaction may have been rolled back.
+// CREATE TABLE commits on its own, so a table created by an import that fails or is rolled back is dropped again.
+// onProgress and onReject may be nil.
+func ImportCSV(ctx context.Context, db *sql.DB, opts CSVImportOptions, onProgress func(ImportProgress), onReject func(RejectedRow)) (_ ImportProgress, err error) {
+	var progress ImportProgress
+
+	var targets []string
+	for _, col := range opts.Columns {
+		if col != "" {
+			targets = append(targets, QuoteIdent(col))
+		}
+	}
+	if len(targets) == 0 {
+		return progress, fmt.Errorf("no columns are mapped")
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	reader, err := OpenCSV(opts.CSVOptions)
+	if err != nil {
+		return progress, err
+	}
+	defer reader.Close()
+	progress.TotalBytes = reader.TotalBytes
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return progress, err
+	}
+	defer conn.Close()
+
+	if opts.Database != "" {
+		if _, err := conn.ExecContext(ctx, "USE "+QuoteIdent(opts.Database)); err != nil {
+			return progress, err
+		}
+	}
+	if opts.CreateTable != "" {
+		if _, err := conn.ExecContext(ctx, opts.CreateTable); err != nil {
+			return progress, err
+		}
+		// Runs after the transaction below is rolled back
+		defer func() {
+			if err == nil {
+				return
+			}
+			if _, dropErr := conn.ExecContext(context.Background(), "DROP TABLE "+QuoteIdent(opts.Table)); dropErr != nil {
+				err = fmt.Errorf("%w (the table %s created for the import could not be dropped: %v)", err, opts.Table, dropErr)
+			}
+		}()
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return progress, err
+	}
+	defer tx.Rollback()
+
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", QuoteIdent(opts.Table), strings.Join(targets, ", "))
+	reject := func(row pendingRow, err error) {
+		progress.Rejected++
+		if onReject != nil {
+			onReject(RejectedRow{Line: row.line, Fields: row.fields, Err: err})
+		}
+	}
+
+	var batch []pendingRow
+	batchBytes := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		tuples := make([]string, len(batch))
+		for i, row := range batch {
+			tuples[i] = row.tuple
+		}
+		_, err := tx.ExecContext(ctx, prefix+strings.Join(tuples, ","))
+		if err == nil {
+			progress.Inserted += len(batch)
+		} else {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if rolledBackTransaction(err) {
+				return err
+			}
+			// Any other failed INSERT only rolls back itself, so the rows can be retried one at a time
+			for _, row := range batch {
+				if _, err := tx.ExecContext(ctx, prefix+row.tuple); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					if rolledBackTransaction(err) {
+						return err
+					}
+					reject(row, err)
+					continue
+				}
+				progress.Inserted++
+			}
+		}
+		batch = batch[:0]
+		batchBytes = 0
+		progress.BytesRead = reader.BytesRead()
+		if onProgress != nil {
+			onProgress(progress)
+		}
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return progress, err
+		}
+		progress.Rows++
+
+		row := pendingRow{line: reader.Line(), fields: fields}
+		if len(fields) != len(opts.Columns) {
+			reject(row, fmt.Errorf("expected %d fields, found %d", len(opts.Columns), len(fields)))
+			continue
+		}
+		values := make([]string, 0, len(targets))
+		for i, f := range fields {
+			if opts.Columns[i] == "" {
+				continue
+			}
+			if f.Valid {
+				values = append(values, QuoteString(f.String))
+			} else {
+				values = append(values, "NULL")
+			}
+		}
+		row.tuple = "(" + strings.Join(values, ",") + ")"
+		batch = append(batch, row)
+		batchBytes += len(row.tuple)
+
+		if len(batch) >= batchSize || batchBytes >= maxStatementBytes {
+			if err := flush(); err != nil {
+				return progress, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return progress, err
+	}
+
+	if opts.RollbackOnReject && progress.Rejected > 0 {
+		tx.Rollback()
+		progress.Inserted = 0
+		return progress, fmt.Errorf("%d row(s) rejected, the import was rolled back", progress.Rejected)
+	}
+	if err := tx.Commit(); err != nil {
+		return progress, err
+	}
+	progress.BytesRead = reader.BytesRead()
+	if onProgress != nil {
+		onProgress(progress)
+	}
+	return progress, nil
+}
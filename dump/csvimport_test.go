@@ -0,0 +1,329 @@
+package dump
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// Read every record of a CSV file with the given contents, rendering NULL as <NULL>
+func readCSV(t *testing.T, contents string, opts CSVOptions) ([][]string, []int) {
+	t.Helper()
+	opts.File = filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(opts.File, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenCSV(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var records [][]string
+	var lines []int
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, lines
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var record []string
+		for _, f := range fields {
+			if !f.Valid {
+				record = append(record, "<NULL>")
+				continue
+			}
+			record = append(record, f.String)
+		}
+		records = append(records, record)
+		lines = append(lines, reader.Line())
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		opts     CSVOptions
+		want     [][]string
+		lines    []int
+	}{
+		{
+			name:     "plain",
+			contents: "a,b,c\n1,2,3\n",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{"a", "b", "c"}, {"1", "2", "3"}},
+			lines:    []int{1, 2},
+		},
+		{
+			name:     "no final newline",
+			contents: "a,b\n1,2",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{"a", "b"}, {"1", "2"}},
+			lines:    []int{1, 2},
+		},
+		{
+			name:     "crlf",
+			contents: "a,b\r\n1,2\r\n\r\n3,4\r\n",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{"a", "b"}, {"1", "2"}, {"3", "4"}},
+			lines:    []int{1, 2, 4},
+		},
+		{
+			name:     "lone carriage return is data",
+			contents: "a\rb,c\n",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{"a\rb", "c"}},
+			lines:    []int{1},
+		},
+		{
+			name:     "multi-line quoted field",
+			contents: "1,\"first\nsecond\r\nthird\",x\n2,y,z\n",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{"1", "first\nsecond\r\nthird", "x"}, {"2", "y", "z"}},
+			lines:    []int{1, 4},
+		},
+		{
+			name:     "doubled quotes",
+			contents: "\"say \"\"hi\"\"\",\"\"\"\",\"a,b\"\n",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{`say "hi"`, `"`, "a,b"}},
+			lines:    []int{1},
+		},
+		{
+			name:     "quote inside an unquoted field is literal",
+			contents: "5\" pipe,x\n",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{`5" pipe`, "x"}},
+			lines:    []int{1},
+		},
+		{
+			name:     "no quote character",
+			contents: "\"a\",b\n",
+			opts:     CSVOptions{},
+			want:     [][]string{{`"a"`, "b"}},
+			lines:    []int{1},
+		},
+		{
+			name:     "empty unquoted fields are NULL by default",
+			contents: "1,,\"\"\n",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{"1", "<NULL>", ""}},
+			lines:    []int{1},
+		},
+		{
+			name:     "null token",
+			contents: "\\N,\"\\N\",,N\n",
+			opts:     CSVOptions{Quote: '"', NullToken: `\N`},
+			want:     [][]string{{"<NULL>", `\N`, "", "N"}},
+			lines:    []int{1},
+		},
+		{
+			name:     "semicolon and single quote",
+			contents: "'a;b';'it''s'\n",
+			opts:     CSVOptions{Delimiter: ';', Quote: '\''},
+			want:     [][]string{{"a;b", "it's"}},
+			lines:    []int{1},
+		},
+		{
+			name:     "tab delimited",
+			contents: "a\tb c\t\n",
+			opts:     CSVOptions{Delimiter: '\t', Quote: '"'},
+			want:     [][]string{{"a", "b c", "<NULL>"}},
+			lines:    []int{1},
+		},
+		{
+			name:     "utf-8 bom",
+			contents: "\ufeffid,name\n1,żółw\n",
+			opts:     CSVOptions{Quote: '"'},
+			want:     [][]string{{"id", "name"}, {"1", "żółw"}},
+			lines:    []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, lines := readCSV(t, tt.contents, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("records = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Fatalf("lines = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestCSVReaderHeaderAndEncoding(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "latin1.csv")
+	if err := os.WriteFile(file, []byte("id;nom\n1;caf\xe9\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenCSV(CSVOptions{File: file, Delimiter: ';', Quote: '"', Header: true, Encoding: "ISO-8859-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if want := []string{"id", "nom"}; !reflect.DeepEqual(reader.Header, want) {
+		t.Fatalf("header = %q, want %q", reader.Header, want)
+	}
+	fields, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields[1].String != "café" || reader.Line() != 2 {
+		t.Fatalf("read %q on line %d, want café on line 2", fields[1].String, reader.Line())
+	}
+}
+
+func TestCSVReaderUnterminatedQuote(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bad.csv")
+	if err := os.WriteFile(file, []byte("1,ok\n2,\"open\n3,x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenCSV(CSVOptions{File: file, Quote: '"'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, err := reader.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(); err == nil || err == io.EOF {
+		t.Fatalf("unterminated quote read without an error, err = %v", err)
+	}
+}
+
+func TestOpenCSVSameDelimiterAndQuote(t *testing.T) {
+	if _, err := OpenCSV(CSVOptions{File: "unused.csv", Delimiter: '"', Quote: '"'}); err == nil {
+		t.Fatal("a quote equal to the delimiter was accepted")
+	}
+}
+
+func TestInferColumnTypes(t *testing.T) {
+	column := func(values ...string) [][]sql.NullString {
+		rows := make([][]sql.NullString, len(values))
+		for i, v := range values {
+			rows[i] = []sql.NullString{{String: v, Valid: v != "<NULL>"}}
+		}
+		return rows
+	}
+	tests := []struct {
+		name string
+		rows [][]sql.NullString
+		want string
+	}{
+		{"no values", column("<NULL>", "", "  "), "VARCHAR(255)"},
+		{"int", column("1", "-20", "+300", "<NULL>", ""), "INT"},
+		{"nine digits", column("999999999"), "INT"},
+		{"bigint", column("1234567890"), "BIGINT"},
+		{"eighteen digits", column("-123456789012345678"), "BIGINT"},
+		{"nineteen digits", column("1234567890123456789"), "DECIMAL(19,0)"},
+		{"leading zeros stay text", column("00123", "1"), "VARCHAR(255)"},
+		{"zero", column("0", "-0"), "INT"},
+		{"decimal", column("12.5", "-0.125", "3"), "DECIMAL(5,3)"},
+		{"decimal without integer part", column(".5"), "DECIMAL(1,1)"},
+		{"decimal too wide", column("0." + strings.Repeat("1", 31)), "DOUBLE"},
+		{"double", column("1e10", "2.5E-3", "7"), "DOUBLE"},
+		{"date", column("2024-02-29", "1999-12-31"), "DATE"},
+		{"datetime", column("2024-02-29 23:59", "2024-03-01T00:00:01"), "DATETIME"},
+		{"date and datetime", column("2024-02-29", "2024-03-01 10:00:00"), "DATETIME"},
+		{"datetime with fraction", column("2024-02-29 23:59:58.123456", "2024-02-29 00:00:00"), "DATETIME(6)"},
+		{"mixed", column("1", "abc"), "VARCHAR(255)"},
+		{"255 characters", column(strings.Repeat("x", 255)), "VARCHAR(255)"},
+		{"text", column(strings.Repeat("x", 256)), "TEXT"},
+		{"multi-byte length counts characters", column(strings.Repeat("ż", 255)), "VARCHAR(255)"},
+		{"mediumtext", column(strings.Repeat("x", 16384)), "MEDIUMTEXT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InferColumnTypes(1, tt.rows); got[0] != tt.want {
+				t.Fatalf("InferColumnTypes = %s, want %s", got[0], tt.want)
+			}
+		})
+	}
+
+	// Short rows leave the missing columns untyped rather than failing
+	got := InferColumnTypes(3, [][]sql.NullString{{{String: "1", Valid: true}}})
+	if want := []string{"INT", "VARCHAR(255)", "VARCHAR(255)"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("InferColumnTypes = %q, want %q", got, want)
+	}
+}
+
+func TestRolledBackTransaction(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{fmt.Errorf("batch: %w", &mysql.MySQLError{Number: 1213}), true},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+		{&mysql.MySQLError{Number: 1366, Message: "Incorrect integer value"}, false},
+		{io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		if got := rolledBackTransaction(tt.err); got != tt.want {
+			t.Errorf("rolledBackTransaction(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// An import into a table it creates leaves the table only when it succeeds. SQLite stands in for MySQL.
+func TestImportCSVDropsCreatedTable(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "import.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	file := filepath.Join(dir, "people.csv")
+	if err := os.WriteFile(file, []byte("id,name\n1,Ann\n2\n3,Cy\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := CSVImportOptions{
+		CSVOptions:  CSVOptions{File: file, Quote: '"', Header: true},
+		Table:       "people",
+		Columns:     []string{"id", "name"},
+		CreateTable: "CREATE TABLE `people` (`id` INT NULL, `name` VARCHAR(255) NULL)",
+	}
+	tableExists := func() bool {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'people'`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n > 0
+	}
+
+	opts.RollbackOnReject = true
+	if _, err := ImportCSV(context.Background(), db, opts, nil, nil); err == nil {
+		t.Fatal("an import with a rejected row was not rolled back")
+	}
+	if tableExists() {
+		t.Fatal("the table created for a rolled back import was left behind")
+	}
+
+	opts.RollbackOnReject = false
+	progress, err := ImportCSV(context.Background(), db, opts, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Inserted != 2 || progress.Rejected != 1 {
+		t.Fatalf("inserted %d and rejected %d rows, want 2 and 1", progress.Inserted, progress.Rejected)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("people holds %d rows (%v), want 2", count, err)
+	}
+}
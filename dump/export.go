@@ -0,0 +1,1129 @@
+package dump
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output layouts of Export
+const (
+	ExportLayoutSplit  = "split"  // one gzip file per object type
+	ExportLayoutSingle = "single" // one restorable, dependency-ordered script
+	ExportLayoutXLSX   = "xlsx"   // table and view rows as an Excel workbook, one sheet each
+)
+
+// Kinds of rendered parts; a view yields a placeholder table and the real view
+const (
+	partTable     = "table"
+	partViewStub  = "viewddl"
+	partView      = "view"
+	partProcedure = "procedure"
+	partFunction  = "function"
+	partTrigger   = "trigger"
+	partEvent     = "event"
+	partGrants    = "grants"
+)
+
+// What an export contains
+const (
+	ExportContentBoth   = "both"
+	ExportContentSchema = "schema"
+	ExportContentData   = "data"
+)
+
+// Object is a database object by type (TABLE, VIEW, PROCEDURE, FUNCTION, TRIGGER or EVENT) and name
+type Object struct {
+	Name string
+	Type string
+}
+
+// ListObjects returns the tables, views, procedures, functions, triggers and events of a database, in that order
+func ListObjects(ctx context.Context, q Querier, database string) ([]Object, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT TABLE_NAME, IF(TABLE_TYPE = 'VIEW', 'VIEW', 'TABLE'), IF(TABLE_TYPE = 'VIEW', 1, 0)
+		FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ?
+		UNION ALL
+		SELECT ROUTINE_NAME, ROUTINE_TYPE, IF(ROUTINE_TYPE = 'PROCEDURE', 2, 3)
+		FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_SCHEMA = ?
+		UNION ALL
+		SELECT TRIGGER_NAME, 'TRIGGER', 4 FROM INFORMATION_SCHEMA.TRIGGERS WHERE TRIGGER_SCHEMA = ?
+		UNION ALL
+		SELECT EVENT_NAME, 'EVENT', 5 FROM INFORMATION_SCHEMA.EVENTS WHERE EVENT_SCHEMA = ?
+		ORDER BY 3, 1
+	`, database, database, database, database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []Object
+	for rows.Next() {
+		var obj Object
+		var rank int
+		if err := rows.Scan(&obj.Name, &obj.Type, &rank); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, rows.Err()
+}
+
+// ExportOptions controls Export
+type ExportOptions struct {
+	OutputFile   string
+	Layout       string
+	Objects      []Object
+	Compress     bool
+	Content      string
+	BatchSize    int
+	Workers      int
+	DropTables   bool
+	DropViews    bool
+	DropRoutines bool   // also covers triggers and events
+	Grants       bool   // add CREATE USER and GRANT statements for users with privileges on the database
+	Consistent   bool   // read every object from one consistent snapshot
+	Resume       bool   `json:"-"` // continue the interrupted export recorded in the work directory
+	MaskFile     string // masking rules file applied to the rows; empty exports them as they are
+
+	masker *Masker // loaded from MaskFile by Export
+}
+
+// DefaultExportOptions are the settings the export dialog and pheri export start from, without any objects
+func DefaultExportOptions() ExportOptions {
+	return ExportOptions{
+		OutputFile:   "backup.sql",
+		Layout:       ExportLayoutSingle,
+		Compress:     true,
+		Content:      ExportContentBoth,
+		BatchSize:    1000,
+		Workers:      10,
+		DropTables:   true,
+		DropViews:    true,
+		DropRoutines: true,
+	}
+}
+
+func (o ExportOptions) withSchema() bool { return o.Content != ExportContentData }
+func (o ExportOptions) withData() bool   { return o.Content != ExportContentSchema }
+
+// Connection is where Export reads from; it opens its own pool, sized to the workers
+type Connection struct {
+	User     string
+	Password string
+	Host     string
+	Port     string
+}
+
+// DSN for a database, in UTF-8 and UTC so dumped values do not depend on the server's settings
+func (c Connection) DSN(database string) string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&time_zone=%%27%%2B00%%3A00%%27", c.User, c.Password, c.Host, c.Port, database)
+}
+
+// Export writes the selected objects of a database and returns the objects that failed.
+// Progress is recorded in a manifest, so after a failure or an interruption the export can be resumed, and the
+// output is only assembled once every object has been exported. Log lines go to progressChan with a leading
+// color tag: [red] errors, [yellow] warnings, [green] finished objects, [blue] and [gray] information.
+// progressChan is not closed; progress, when not nil, follows rows and bytes as they are written.
+func Export(conn Connection, dbName string, opts ExportOptions, progressChan chan<- string, progress *ExportProgress) ([]ManifestObject, error) {
+	if progress == nil {
+		progress = NewExportProgress(dbName, opts)
+	}
+	defer progress.End()
+
+	if opts.MaskFile != "" {
+		masker, err := LoadMasker(opts.MaskFile)
+		if err != nil {
+			progressChan <- fmt.Sprintf("[red]Failed to load masking rules: %v", err)
+			return nil, err
+		}
+		opts.masker = masker
+		progressChan <- fmt.Sprintf("[blue]Masking rows with the rules of %s", opts.MaskFile)
+	}
+
+	db, err := sql.Open("mysql", conn.DSN(dbName))
+	if err != nil {
+		progressChan <- fmt.Sprintf("[red]Failed to connect to DB: %v", err)
+		return nil, err
+	}
+	defer db.Close()
+
+	workerCount := opts.Workers
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	db.SetMaxOpenConns(workerCount)
+	db.SetMaxIdleConns(workerCount)
+	db.SetConnMaxLifetime(time.Minute * 5)
+
+	var snapshot *exportSnapshot
+	if opts.Consistent {
+		snapshot, err = beginSnapshot(context.Background(), db, workerCount)
+		if err != nil {
+			progressChan <- fmt.Sprintf("[red]Failed to start consistent snapshot: %v", err)
+			return nil, err
+		}
+		defer snapshot.close()
+		workerCount = len(snapshot.Conns)
+		if snapshot.Locked {
+			progressChan <- fmt.Sprintf("[blue]Consistent snapshot on %d connection(s)", workerCount)
+		} else {
+			progressChan <- "[yellow]No privilege for FLUSH TABLES WITH READ LOCK, exporting from a single snapshot connection"
+		}
+		if snapshot.BinlogFile != "" {
+			progressChan <- fmt.Sprintf("[blue]Binlog position: %s:%s", snapshot.BinlogFile, snapshot.BinlogPos)
+		}
+		if opts.Resume {
+			progressChan <- "[yellow]Resuming: objects exported before the interruption come from an earlier snapshot"
+		}
+	}
+
+	var first Querier = db
+	if snapshot != nil {
+		first = snapshot.Conns[0]
+	}
+	if opts.withData() {
+		if err := progress.LoadEstimates(first); err != nil {
+			progressChan <- fmt.Sprintf("[yellow]Row estimates unavailable, no ETA: %v", err)
+		}
+	}
+
+	if opts.Layout == ExportLayoutXLSX {
+		return exportWorkbook(first, opts, progressChan, progress)
+	}
+
+	parts, err := openExportParts(dbName, opts)
+	if err != nil {
+		progressChan <- fmt.Sprintf("[red]Failed to prepare work directory: %v", err)
+		return nil, err
+	}
+	parts.progress = progress
+	if opts.Resume {
+		done, failed := parts.manifest.Counts()
+		progressChan <- fmt.Sprintf("[blue]Resuming export: %d object(s) already done, %d to retry", done, failed)
+	}
+
+	// Snapshot workers keep their own connection; the others share the pool
+	queriers := make([]Querier, workerCount)
+	for w := range queriers {
+		queriers[w] = db
+		if snapshot != nil {
+			queriers[w] = snapshot.Conns[w]
+		}
+	}
+
+	// Phase one: every object, where a table only gets its DDL and the key ranges its rows are cut into
+	var chunksMu sync.Mutex
+	var chunks []tableChunk
+	runExportWorkers(queriers, len(opts.Objects), func(q Querier, i int) {
+		obj := opts.Objects[i]
+		queued := 0
+
+		var export func(entry ManifestObject) error
+		switch {
+		case obj.Type == "TABLE":
+			export = func(entry ManifestObject) error {
+				planned, err := prepareTable(q, parts, entry, opts)
+				if err == nil && len(planned) > 0 {
+					chunksMu.Lock()
+					chunks = append(chunks, planned...)
+					chunksMu.Unlock()
+					queued = len(planned)
+				}
+				return err
+			}
+		case obj.Type == "VIEW" && opts.withSchema():
+			export = func(entry ManifestObject) error {
+				err := parts.write(obj.Type, obj.Name, partViewStub, nil, func(w *bufio.Writer) error {
+					return exportViewStub(q, obj.Name, w, opts.DropViews)
+				})
+				if err != nil {
+					return err
+				}
+				return parts.write(obj.Type, obj.Name, partView, nil, func(w *bufio.Writer) error {
+					return exportView(q, obj.Name, w)
+				})
+			}
+		case (obj.Type == "PROCEDURE" || obj.Type == "FUNCTION") && opts.withSchema():
+			export = func(entry ManifestObject) error {
+				return parts.write(obj.Type, obj.Name, strings.ToLower(obj.Type), nil, func(w *bufio.Writer) error {
+					return exportRoutine(q, obj.Type, obj.Name, w, opts.DropRoutines)
+				})
+			}
+		case (obj.Type == "TRIGGER" || obj.Type == "EVENT") && opts.withSchema():
+			export = func(entry ManifestObject) error {
+				return parts.write(obj.Type, obj.Name, strings.ToLower(obj.Type), nil, func(w *bufio.Writer) error {
+					return exportTriggerOrEvent(q, obj.Type, obj.Name, w, opts.DropRoutines)
+				})
+			}
+		default:
+			return
+		}
+
+		entry := parts.begin(obj.Type, obj.Name)
+		if entry.Status == objectDone {
+			progress.Skip(obj.Type, obj.Name)
+			progressChan <- fmt.Sprintf("[gray]Already exported %s: %s", obj.Type, obj.Name)
+			return
+		}
+		var resumedRows, resumedBytes int64
+		for _, chunk := range entry.Chunks {
+			resumedRows += int64(chunk.Rows)
+			resumedBytes += chunk.Bytes
+		}
+		progress.Start(obj.Type, obj.Name, resumedRows, resumedBytes)
+
+		err := withRetry(snapshot, progressChan, obj.Type+": "+obj.Name, func() error {
+			err := export(entry)
+			if err != nil {
+				entry = parts.begin(obj.Type, obj.Name)
+			}
+			return err
+		})
+		if err == nil && queued > 0 {
+			// Finished by the last of its chunks
+			if queued > 1 {
+				progressChan <- fmt.Sprintf("[blue]%s %s: %d chunk(s) queued", obj.Type, obj.Name, queued)
+			}
+			return
+		}
+		progress.Finish(obj.Type, obj.Name, err)
+		if finishErr := parts.finish(obj.Type, obj.Name, err); finishErr != nil {
+			progressChan <- fmt.Sprintf("[red]Failed to update manifest: %v", finishErr)
+		}
+		if err != nil {
+			progressChan <- fmt.Sprintf("[red]Failed to export %s: %s - %v", obj.Type, obj.Name, err)
+			return
+		}
+		progressChan <- fmt.Sprintf("[green]Exported %s: %s", obj.Type, obj.Name)
+	})
+
+	// Phase two: the rows of every table, one key range per task, so a huge table keeps all workers busy
+	runExportWorkers(queriers, len(chunks), func(q Querier, i int) {
+		c := chunks[i]
+		err := withRetry(snapshot, progressChan, fmt.Sprintf("TABLE: %s chunk %d", c.Table, c.Index+1), func() error {
+			return exportChunk(q, parts, c, opts)
+		})
+		if err != nil {
+			err = fmt.Errorf("chunk %d: %w", c.Index+1, err)
+			progress.Finish("TABLE", c.Table, err)
+			parts.finish("TABLE", c.Table, err)
+			progressChan <- fmt.Sprintf("[red]Failed to export TABLE: %s chunk %d - %v", c.Table, c.Index+1, err)
+			return
+		}
+
+		done, total, rows, bytes, completed, err := parts.chunkFinished("TABLE", c.Table)
+		if err != nil {
+			progressChan <- fmt.Sprintf("[red]Failed to update manifest: %v", err)
+		}
+		if total > 1 {
+			progressChan <- fmt.Sprintf("[blue]TABLE %s: %d/%d chunks, %d rows, %s", c.Table, done, total, rows, FormatBytes(bytes))
+		}
+		if completed {
+			progress.Finish("TABLE", c.Table, nil)
+			progressChan <- fmt.Sprintf("[green]Exported TABLE: %s (%d rows, %s)", c.Table, rows, FormatBytes(bytes))
+		}
+	})
+
+	if snapshot != nil {
+		snapshot.close()
+	}
+
+	if opts.Grants {
+		entry := parts.begin(partGrants, dbName)
+		if entry.Status == objectDone {
+			progress.Skip(partGrants, dbName)
+		} else {
+			progress.Start(partGrants, dbName, 0, 0)
+			err := parts.write(partGrants, dbName, partGrants, nil, func(w *bufio.Writer) error {
+				return exportGrants(db, dbName, w)
+			})
+			progress.Finish(partGrants, dbName, err)
+			parts.finish(partGrants, dbName, err)
+			if err != nil {
+				progressChan <- fmt.Sprintf("[red]Failed to export users and grants: %v", err)
+			} else {
+				progressChan <- "[green]Exported users and grants"
+			}
+		}
+	}
+
+	// Never assemble an output that silently lacks objects
+	if failed := parts.failures(); len(failed) > 0 {
+		progressChan <- fmt.Sprintf("[red]Export incomplete, %d object(s) failed:", len(failed))
+		for _, obj := range failed {
+			progressChan <- fmt.Sprintf("[red]  %s %s: %s", obj.Type, obj.Name, obj.Error)
+		}
+		progressChan <- fmt.Sprintf("[yellow]Finished objects are kept in %s. Export to the same file again and choose Resume to retry the failed ones.", parts.dir)
+		return failed, nil
+	}
+
+	order, err := exportOrder(db, dbName, opts.Objects)
+	if err != nil {
+		progressChan <- fmt.Sprintf("[yellow]Failed to read dependencies, using name order: %v", err)
+	}
+
+	var written []string
+	switch opts.Layout {
+	case ExportLayoutSingle:
+		written, err = assembleSingleFile(opts, conn, dbName, snapshot, parts, order)
+	default:
+		written, err = assembleSplitFiles(opts, parts, order)
+	}
+	if err != nil {
+		progressChan <- fmt.Sprintf("[red]Failed to write export: %v", err)
+		return nil, err
+	}
+	for _, path := range written {
+		progressChan <- fmt.Sprintf("[blue]Export written to %s", path)
+	}
+	os.RemoveAll(parts.dir)
+	return nil, nil
+}
+
+// Run work for items 0..n-1 on one goroutine per querier and wait for all of them
+func runExportWorkers(queriers []Querier, n int, work func(q Querier, i int)) {
+	tasks := make(chan int, n)
+	for i := 0; i < n; i++ {
+		tasks <- i
+	}
+	close(tasks)
+
+	var wg sync.WaitGroup
+	for _, q := range queriers {
+		wg.Add(1)
+		go func(q Querier) {
+			defer wg.Done()
+			for i := range tasks {
+				work(q, i)
+			}
+		}(q)
+	}
+	wg.Wait()
+}
+
+// Retry fn after a blip on a pooled connection; a snapshot connection cannot be replaced
+func withRetry(snapshot *exportSnapshot, progressChan chan<- string, what string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || snapshot != nil || attempt == 3 || !isConnectionError(err) {
+			return err
+		}
+		progressChan <- fmt.Sprintf("[yellow]Connection lost exporting %s, retrying (%v)", what, err)
+		time.Sleep(time.Duration(attempt) * 2 * time.Second)
+	}
+}
+
+func (o ExportOptions) tableSQLOptions() TableSQLOptions {
+	return TableSQLOptions{
+		Schema:    o.withSchema(),
+		DropTable: o.DropTables,
+		Data:      o.withData(),
+		BatchSize: max(o.BatchSize, 1),
+		Mask:      o.masker,
+	}
+}
+
+// One primary key range of a table, exported to its own part file
+type tableChunk struct {
+	Table string
+	Index int
+	Keys  []string
+	After []string // last key of the previous range; nil for the first
+	Upto  []string // last key of this range; nil for the final one
+}
+
+// Write a table's CREATE TABLE as opts.Content asks and plan its rows: a table with a primary key is cut into
+// ranges of about exportChunkRows rows, recorded in the manifest and returned for the workers (minus those a
+// resumed export already has); the rows of a table without one are written here in a single part.
+func prepareTable(q Querier, parts *exportParts, entry ManifestObject, opts ExportOptions) ([]tableChunk, error) {
+	ctx := context.Background()
+	name := entry.Name
+
+	if len(entry.Parts[partTable]) == 0 {
+		headerOpts := opts.tableSQLOptions()
+		headerOpts.Data = false
+		err := parts.write(entry.Type, name, partTable, nil, func(w *bufio.Writer) error {
+			if _, err := WriteTableSQL(ctx, q, w, name, headerOpts); err != nil {
+				return err
+			}
+			if opts.withData() {
+				w.WriteString("-- DATA\n")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !opts.withData() {
+		return nil, nil
+	}
+
+	if len(entry.KeyColumns) == 0 {
+		keys, err := PrimaryKeyColumns(ctx, q, "", name)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			tableOpts := opts.tableSQLOptions()
+			var takeBack func()
+			tableOpts.OnRows, takeBack = parts.progress.RowCounter(entry.Type, name)
+			err := parts.write(entry.Type, name, partTable, nil, func(w *bufio.Writer) error {
+				_, _, err := WriteTableRange(ctx, q, w, name, KeyRange{}, tableOpts)
+				return err
+			})
+			if err != nil {
+				takeBack()
+			}
+			return nil, err
+		}
+		boundaries, err := KeyBoundaries(ctx, q, "", name, keys, exportChunkRows)
+		if err != nil {
+			return nil, fmt.Errorf("plan chunks: %w", err)
+		}
+		if err := parts.setPlan(entry.Type, name, keys, boundaries); err != nil {
+			return nil, err
+		}
+		entry.KeyColumns, entry.Boundaries = keys, boundaries
+	}
+
+	finished := map[int]bool{}
+	for _, chunk := range entry.Chunks {
+		finished[chunk.Index] = true
+	}
+	var chunks []tableChunk
+	for i := 0; i <= len(entry.Boundaries); i++ {
+		if finished[i] {
+			continue
+		}
+		chunk := tableChunk{Table: name, Index: i, Keys: entry.KeyColumns}
+		if i > 0 {
+			chunk.After = entry.Boundaries[i-1]
+		}
+		if i < len(entry.Boundaries) {
+			chunk.Upto = entry.Boundaries[i]
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// Rows of one key range as batched INSERTs
+func exportChunk(q Querier, parts *exportParts, c tableChunk, opts ExportOptions) error {
+	tableOpts := opts.tableSQLOptions()
+	var takeBack func()
+	tableOpts.OnRows, takeBack = parts.progress.RowCounter("TABLE", c.Table)
+
+	chunk := &manifestChunk{Index: c.Index}
+	err := parts.write("TABLE", c.Table, partTable, chunk, func(w *bufio.Writer) error {
+		var err error
+		chunk.Rows, _, err = WriteTableRange(context.Background(), q, w, c.Table, KeyRange{
+			Columns: c.Keys,
+			After:   c.After,
+			Upto:    c.Upto,
+		}, tableOpts)
+		return err
+	})
+	if err != nil {
+		takeBack()
+	}
+	return err
+}
+
+// Placeholder table with the view's columns, so views depending on views can be created in any order
+func exportViewStub(q Querier, name string, writer *bufio.Writer, dropFirst bool) error {
+	rowsddl, err := q.QueryContext(context.Background(), fmt.Sprintf("SELECT * FROM `%s` LIMIT 0", name))
+	if err != nil {
+		return fmt.Errorf("select data: %w", err)
+	}
+	cols, err := rowsddl.ColumnTypes()
+	rowsddl.Close()
+	if err != nil {
+		return fmt.Errorf("column types: %w", err)
+	}
+
+	writer.WriteString("-- ----------------------------\n")
+	writer.WriteString(fmt.Sprintf("--  STRUCTURE (DUMMY TABLE FOR VIEW): %s\n", name))
+	writer.WriteString("-- ----------------------------\n")
+	if dropFirst {
+		writer.WriteString(fmt.Sprintf("DROP TABLE IF EXISTS `%s`;\n", name))
+		writer.WriteString(fmt.Sprintf("DROP VIEW IF EXISTS `%s`;\n", name))
+	}
+	writer.WriteString(fmt.Sprintf("CREATE TABLE `%s` (\n", name))
+	for i, col := range cols {
+		nullable, _ := col.Nullable()
+		nullStr := "NOT NULL"
+		if nullable {
+			nullStr = "NULL"
+		}
+		colDef := fmt.Sprintf("  `%s` %s %s", col.Name(), mapSQLType(col.DatabaseTypeName()), nullStr)
+		if i < len(cols)-1 {
+			colDef += ",\n"
+		} else {
+			colDef += "\n"
+		}
+		writer.WriteString(colDef)
+	}
+	writer.WriteString(");\n\n")
+	return nil
+}
+
+func exportView(q Querier, name string, writer *bufio.Writer) error {
+	var view, createStmt, charset, collation string
+	row := q.QueryRowContext(context.Background(), fmt.Sprintf("SHOW CREATE VIEW `%s`", name))
+	if err := row.Scan(&view, &createStmt, &charset, &collation); err != nil {
+		return err
+	}
+
+	writer.WriteString("-- ----------------------------\n")
+	writer.WriteString(fmt.Sprintf("-- VIEW: %s\n", name))
+	writer.WriteString("-- ----------------------------\n")
+	writer.WriteString("DROP TABLE IF EXISTS `" + name + "`;\n")
+	writer.WriteString(createStmt + ";\n\n")
+	return nil
+}
+
+func exportRoutine(q Querier, routineType, name string, writer *bufio.Writer, dropFirst bool) error {
+	var routine, sqlMode, createStmt, charset, collation, dbCollation string
+	row := q.QueryRowContext(context.Background(), fmt.Sprintf("SHOW CREATE %s `%s`", routineType, name))
+	if err := row.Scan(&routine, &sqlMode, &createStmt, &charset, &collation, &dbCollation); err != nil {
+		return err
+	}
+
+	writer.WriteString("-- ----------------------------\n")
+	writer.WriteString(fmt.Sprintf("-- %s: %s\n", routineType, name))
+	writer.WriteString("-- ----------------------------\n")
+	if dropFirst {
+		writer.WriteString(fmt.Sprintf("DROP %s IF EXISTS `%s`;\n", routineType, name))
+	}
+	writer.WriteString("DELIMITER ;;\n")
+	writer.WriteString(createStmt + " ;;\n")
+	writer.WriteString("DELIMITER ;\n\n")
+	return nil
+}
+
+// Triggers and events keep the sql_mode (and events the time zone) they were created with
+func exportTriggerOrEvent(q Querier, objType, name string, writer *bufio.Writer, dropFirst bool) error {
+	create, err := ShowCreate(q, objType, name)
+	if err != nil {
+		return err
+	}
+
+	writer.WriteString("-- ----------------------------\n")
+	writer.WriteString(fmt.Sprintf("-- %s: %s\n", objType, name))
+	writer.WriteString("-- ----------------------------\n")
+	if dropFirst {
+		writer.WriteString(fmt.Sprintf("DROP %s IF EXISTS `%s`;\n", objType, name))
+	}
+	writer.WriteString("SET @saved_sql_mode = @@sql_mode;\n")
+	writer.WriteString(fmt.Sprintf("SET sql_mode = %s;\n", QuoteString(create.SQLMode)))
+	if create.TimeZone != "" {
+		writer.WriteString("SET @saved_time_zone = @@time_zone;\n")
+		writer.WriteString(fmt.Sprintf("SET time_zone = %s;\n", QuoteString(create.TimeZone)))
+	}
+	writer.WriteString("DELIMITER ;;\n")
+	writer.WriteString(create.Statement + " ;;\n")
+	writer.WriteString("DELIMITER ;\n")
+	if create.TimeZone != "" {
+		writer.WriteString("SET time_zone = @saved_time_zone;\n")
+	}
+	writer.WriteString("SET sql_mode = @saved_sql_mode;\n\n")
+	return nil
+}
+
+// Result of SHOW CREATE TRIGGER / EVENT
+type CreateStatement struct {
+	Statement string
+	SQLMode   string
+	TimeZone  string
+}
+
+func ShowCreate(q Querier, objType, name string) (CreateStatement, error) {
+	row, err := queryFirstRow(context.Background(), q, fmt.Sprintf("SHOW CREATE %s `%s`", objType, name))
+	if err != nil {
+		return CreateStatement{}, err
+	}
+	create := CreateStatement{SQLMode: row["sql_mode"], TimeZone: row["time_zone"]}
+	switch objType {
+	case "TRIGGER":
+		create.Statement = row["SQL Original Statement"]
+	case "EVENT":
+		create.Statement = row["Create Event"]
+	}
+	if create.Statement == "" {
+		return create, fmt.Errorf("%s %s not found", strings.ToLower(objType), name)
+	}
+	return create, nil
+}
+
+// CREATE USER and GRANT statements for every account with privileges on the database
+func exportGrants(db *sql.DB, dbName string, writer *bufio.Writer) error {
+	rows, err := db.Query(`
+		SELECT GRANTEE FROM information_schema.SCHEMA_PRIVILEGES WHERE TABLE_SCHEMA = ?
+		UNION
+		SELECT GRANTEE FROM information_schema.TABLE_PRIVILEGES WHERE TABLE_SCHEMA = ?
+		UNION
+		SELECT GRANTEE FROM information_schema.COLUMN_PRIVILEGES WHERE TABLE_SCHEMA = ?
+		ORDER BY GRANTEE
+	`, dbName, dbName, dbName)
+	if err != nil {
+		return err
+	}
+	var grantees []string
+	for rows.Next() {
+		var grantee string
+		if err := rows.Scan(&grantee); err != nil {
+			rows.Close()
+			return err
+		}
+		grantees = append(grantees, grantee)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, grantee := range grantees {
+		writer.WriteString("-- ----------------------------\n")
+		writer.WriteString(fmt.Sprintf("-- USER: %s\n", grantee))
+		writer.WriteString("-- ----------------------------\n")
+
+		// SHOW CREATE USER needs MySQL 5.7+; older servers only get the grants
+		var createUser string
+		if err := db.QueryRow("SHOW CREATE USER " + grantee).Scan(&createUser); err == nil {
+			createUser = strings.Replace(createUser, "CREATE USER ", "CREATE USER IF NOT EXISTS ", 1)
+			writer.WriteString(createUser + ";\n")
+		}
+
+		grants, err := db.Query("SHOW GRANTS FOR " + grantee)
+		if err != nil {
+			writer.WriteString(fmt.Sprintf("-- SHOW GRANTS failed: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " ")))
+			continue
+		}
+		for grants.Next() {
+			var grant string
+			if err := grants.Scan(&grant); err != nil {
+				grants.Close()
+				return err
+			}
+			writer.WriteString(grant + ";\n")
+		}
+		grants.Close()
+		writer.WriteString("\n")
+	}
+	return nil
+}
+
+func mapSQLType(mysqlType string) string {
+	switch strings.ToUpper(mysqlType) {
+	case "VARCHAR", "TEXT", "CHAR":
+		return "VARCHAR(1)"
+	case "INT", "INTEGER", "SMALLINT", "TINYINT", "MEDIUMINT", "BIGINT":
+		return "INT(11)"
+	case "DECIMAL", "NUMERIC", "FLOAT", "DOUBLE":
+		return "DECIMAL(10,2)"
+	case "DATE":
+		return "DATE"
+	case "DATETIME", "TIMESTAMP":
+		return "DATETIME"
+	case "BLOB", "LONGBLOB", "MEDIUMBLOB":
+		return "BLOB"
+	default:
+		return "VARCHAR(1)"
+	}
+}
+
+// Order in which the parts of each kind are restored
+type exportSequence struct {
+	Tables []string
+	Views  []string
+}
+
+// Tables ordered by foreign keys (parents first) and views by the views they select from
+func exportOrder(db *sql.DB, dbName string, objects []Object) (exportSequence, error) {
+	var seq exportSequence
+	for _, obj := range objects {
+		switch obj.Type {
+		case "TABLE":
+			seq.Tables = append(seq.Tables, obj.Name)
+		case "VIEW":
+			seq.Views = append(seq.Views, obj.Name)
+		}
+	}
+	sort.Strings(seq.Tables)
+	sort.Strings(seq.Views)
+
+	tableDeps := map[string][]string{}
+	rows, err := db.Query(`
+		SELECT TABLE_NAME, REFERENCED_TABLE_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = ?
+		  AND REFERENCED_TABLE_SCHEMA = ?
+		  AND REFERENCED_TABLE_NAME IS NOT NULL
+	`, dbName, dbName)
+	if err != nil {
+		return seq, err
+	}
+	for rows.Next() {
+		var child, parent string
+		if err := rows.Scan(&child, &parent); err != nil {
+			rows.Close()
+			return seq, err
+		}
+		tableDeps[child] = append(tableDeps[child], parent)
+	}
+	rows.Close()
+	seq.Tables = SortByDependencies(seq.Tables, tableDeps)
+
+	viewDeps := map[string][]string{}
+	rows, err = db.Query(`
+		SELECT TABLE_NAME, VIEW_DEFINITION
+		FROM information_schema.VIEWS
+		WHERE TABLE_SCHEMA = ?
+	`, dbName)
+	if err != nil {
+		return seq, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var view, definition string
+		if err := rows.Scan(&view, &definition); err != nil {
+			return seq, err
+		}
+		for _, other := range seq.Views {
+			if other != view && strings.Contains(definition, "`"+other+"`") {
+				viewDeps[view] = append(viewDeps[view], other)
+			}
+		}
+	}
+	seq.Views = SortByDependencies(seq.Views, viewDeps)
+	return seq, rows.Err()
+}
+
+// Part files of a kind, in restore order
+func orderedParts(parts *exportParts, kind string, order []string) []string {
+	byName := parts.paths(kind)
+	var paths []string
+	seen := map[string]bool{}
+	for _, name := range order {
+		if files, ok := byName[name]; ok {
+			paths = append(paths, files...)
+			seen[name] = true
+		}
+	}
+	var rest []string
+	for name := range byName {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		paths = append(paths, byName[name]...)
+	}
+	return paths
+}
+
+func copyParts(w io.Writer, paths []string) error {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create an output file, gzip-compressed if asked, and hand a buffered writer for it to fill
+func writeExportFile(path string, compress bool, fill func(w *bufio.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = f
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(f)
+		out = gz
+	}
+	buf := bufio.NewWriter(out)
+
+	err = fill(buf)
+	if flushErr := buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if gz != nil {
+		if gzErr := gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// One file per kind: <output>_table.gz, _view.gz, _viewddl.gz, _procedure.gz, _function.gz
+// (.sql instead of .gz without compression); kinds with nothing exported are skipped
+func assembleSplitFiles(opts ExportOptions, parts *exportParts, order exportSequence) ([]string, error) {
+	files := []struct {
+		kind  string
+		order []string
+	}{
+		{partTable, order.Tables},
+		{partView, order.Views},
+		{partViewStub, order.Views},
+		{partProcedure, nil},
+		{partFunction, nil},
+		{partTrigger, nil},
+		{partEvent, nil},
+		{partGrants, nil},
+	}
+	ext := ".sql"
+	if opts.Compress {
+		ext = ".gz"
+	}
+
+	var written []string
+	for _, file := range files {
+		paths := orderedParts(parts, file.kind, file.order)
+		if len(paths) == 0 {
+			continue
+		}
+		path := fmt.Sprintf("%s_%s%s", opts.OutputFile, file.kind, ext)
+		err := writeExportFile(path, opts.Compress, func(w *bufio.Writer) error {
+			return copyParts(w, paths)
+		})
+		if err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// A single script in restore order, with the session settings mysqldump uses
+func assembleSingleFile(opts ExportOptions, conn Connection, dbName string, snapshot *exportSnapshot, parts *exportParts, order exportSequence) ([]string, error) {
+	path := opts.OutputFile
+	if opts.Compress {
+		path += ".gz"
+	}
+	err := writeExportFile(path, opts.Compress, func(w *bufio.Writer) error {
+		w.WriteString(dumpHeader(conn, dbName, snapshot))
+
+		sections := []struct {
+			title string
+			kind  string
+			order []string
+		}{
+			{"Tables", partTable, order.Tables},
+			{"Triggers", partTrigger, nil},
+			{"Placeholder tables for views", partViewStub, order.Views},
+			{"Views", partView, order.Views},
+			{"Procedures", partProcedure, nil},
+			{"Functions", partFunction, nil},
+			{"Events", partEvent, nil},
+			{"Users and grants", partGrants, nil},
+		}
+		for _, section := range sections {
+			paths := orderedParts(parts, section.kind, section.order)
+			if len(paths) == 0 {
+				continue
+			}
+			w.WriteString(fmt.Sprintf("--\n-- %s\n--\n\n", section.title))
+			if err := copyParts(w, paths); err != nil {
+				return err
+			}
+		}
+
+		w.WriteString(dumpFooter())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+func dumpHeader(conn Connection, dbName string, snapshot *exportSnapshot) string {
+	var b strings.Builder
+	b.WriteString("-- Pheri SQL dump\n")
+	b.WriteString(fmt.Sprintf("-- Host: %s:%s    Database: %s\n", conn.Host, conn.Port, dbName))
+	b.WriteString(fmt.Sprintf("-- Generated: %s\n", time.Now().Format(time.RFC3339)))
+	if snapshot != nil {
+		b.WriteString(snapshot.headerLines())
+	}
+	b.WriteString("-- ------------------------------------------------------\n\n")
+	b.WriteString(sessionHeader())
+	return b.String()
+}
+
+// Session settings a script runs under, as mysqldump sets them; dumpFooter restores them
+func sessionHeader() string {
+	var b strings.Builder
+	b.WriteString("/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n")
+	b.WriteString("/*!40101 SET @OLD_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS */;\n")
+	b.WriteString("/*!40101 SET @OLD_COLLATION_CONNECTION=@@COLLATION_CONNECTION */;\n")
+	b.WriteString("/*!50503 SET NAMES utf8mb4 */;\n")
+	b.WriteString("/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;\n")
+	b.WriteString("/*!40103 SET TIME_ZONE='+00:00' */;\n")
+	b.WriteString("/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;\n")
+	b.WriteString("/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;\n")
+	b.WriteString("/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;\n")
+	b.WriteString("/*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;\n\n")
+	return b.String()
+}
+
+func dumpFooter() string {
+	var b strings.Builder
+	b.WriteString("/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;\n")
+	b.WriteString("/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;\n")
+	b.WriteString("/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;\n")
+	b.WriteString("/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;\n")
+	b.WriteString("/*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;\n")
+	b.WriteString("/*!40101 SET CHARACTER_SET_RESULTS=@OLD_CHARACTER_SET_RESULTS */;\n")
+	b.WriteString("/*!40101 SET COLLATION_CONNECTION=@OLD_COLLATION_CONNECTION */;\n")
+	b.WriteString("/*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */;\n\n")
+	b.WriteString(fmt.Sprintf("-- Dump completed on %s\n", time.Now().Format("2006-01-02 15:04:05")))
+	return b.String()
+}
+
+// Rows of tables and views as an .xlsx workbook with one sheet per object. Objects that cannot be read are
+// left out of the workbook and returned.
+func exportWorkbook(q Querier, opts ExportOptions, progressChan chan<- string, progress *ExportProgress) ([]ManifestObject, error) {
+	src := &objectRowsSource{q: q, progressChan: progressChan, progress: progress, masker: opts.masker}
+	for _, obj := range opts.Objects {
+		if obj.Type == "TABLE" || obj.Type == "VIEW" {
+			src.objects = append(src.objects, obj)
+		}
+	}
+	if len(src.objects) == 0 {
+		progressChan <- "[yellow]No tables or views selected, nothing to export"
+		return nil, nil
+	}
+
+	path := opts.OutputFile
+	if !strings.HasSuffix(strings.ToLower(path), ".xlsx") {
+		path = strings.TrimSuffix(path, ".sql") + ".xlsx"
+	}
+	// Filled in as objects open, so a skipped object does not shift the names of the sheets after it
+	src.sheetNames = make([]string, len(src.objects))
+
+	if src.openFrom(0) {
+		defer src.close()
+		err := writeExportFile(path, false, func(w *bufio.Writer) error {
+			_, err := WriteResults(w, src, ResultOptions{Format: FormatXLSX, SheetNames: src.sheetNames})
+			return err
+		})
+		if err != nil {
+			if src.rows != nil {
+				obj := src.objects[src.index]
+				progress.Finish(obj.Type, obj.Name, err)
+			}
+			progressChan <- fmt.Sprintf("[red]Failed to write workbook: %v", err)
+			return src.failed, err
+		}
+	}
+
+	if len(src.failed) > 0 {
+		progressChan <- fmt.Sprintf("[red]Export incomplete, %d object(s) failed:", len(src.failed))
+		for _, obj := range src.failed {
+			progressChan <- fmt.Sprintf("[red]  %s %s: %s", obj.Type, obj.Name, obj.Error)
+		}
+		if len(src.failed) < len(src.objects) {
+			progressChan <- fmt.Sprintf("[yellow]Workbook written to %s without the failed objects", path)
+		}
+		return src.failed, nil
+	}
+	progressChan <- fmt.Sprintf("[blue]Export written to %s", path)
+	return nil, nil
+}
+
+// The rows of several tables as consecutive result sets
+type objectRowsSource struct {
+	*RowsSource
+	q            Querier
+	objects      []Object
+	index        int
+	rows         *sql.Rows
+	progressChan chan<- string
+	progress     *ExportProgress
+	masker       *Masker
+	masks        []*MaskRule      // of the open object
+	sheetNames   []string         // one per object opened, in order
+	sets         int              // objects opened so far
+	failed       []ManifestObject // objects that could not be read
+}
+
+func (s *objectRowsSource) open(index int) error {
+	obj := s.objects[index]
+	s.progress.Start(obj.Type, obj.Name, 0, 0)
+	rows, err := s.q.QueryContext(context.Background(), fmt.Sprintf("SELECT * FROM `%s`", obj.Name))
+	if err != nil {
+		s.progress.Finish(obj.Type, obj.Name, err)
+		return err
+	}
+	s.index = index
+	s.rows = rows
+	s.RowsSource = NewRowsSource(rows)
+	s.masks = s.masker.Columns(obj.Name, s.RowsSource.Columns())
+	s.sheetNames[s.sets] = obj.Name
+	s.sets++
+	return nil
+}
+
+// Open the first object from index on that can be read, recording the ones that cannot; false when none is left
+func (s *objectRowsSource) openFrom(index int) bool {
+	for ; index < len(s.objects); index++ {
+		err := s.open(index)
+		if err == nil {
+			return true
+		}
+		obj := s.objects[index]
+		s.failed = append(s.failed, ManifestObject{Type: obj.Type, Name: obj.Name, Status: objectFailed, Error: err.Error()})
+		s.progressChan <- fmt.Sprintf("[red]Failed to export %s: %s - %v", obj.Type, obj.Name, err)
+	}
+	return false
+}
+
+func (s *objectRowsSource) Values() []interface{} {
+	return s.masker.Row(s.masks, s.RowsSource.Values(), s.RowsSource.Types())
+}
+
+func (s *objectRowsSource) close() {
+	if s.rows != nil {
+		s.rows.Close()
+		s.rows = nil
+	}
+}
+
+func (s *objectRowsSource) Next() bool {
+	if !s.RowsSource.Next() {
+		return false
+	}
+	obj := s.objects[s.index]
+	s.progress.Add(obj.Type, obj.Name, 1, 0)
+	return true
+}
+
+func (s *objectRowsSource) NextResultSet() bool {
+	obj := s.objects[s.index]
+	s.close()
+	s.progress.Finish(obj.Type, obj.Name, nil)
+	s.progressChan <- fmt.Sprintf("[green]Exported %s: %s", obj.Type, obj.Name)
+	return s.openFrom(s.index + 1)
+}
@@ -0,0 +1,297 @@
+package dump
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State of an object in ExportProgress
+const (
+	progressPending = "pending"
+	progressRunning = "running"
+	progressDone    = "done"
+	progressSkipped = "skipped" // already exported by the run being resumed
+	progressFailed  = "failed"
+)
+
+// ExportProgress is the live state of an export: rows written against the estimate, bytes, failures
+type ExportProgress struct {
+	mu        sync.Mutex
+	database  string
+	output    string
+	resumable bool // the layout keeps a manifest, so failed objects can be retried
+	started   time.Time
+	finished  time.Time
+	objects   []*ObjectProgress
+	byKey     map[string]*ObjectProgress // keyed by manifestKey
+	bytes     int64
+}
+
+// ObjectProgress is the state of one object in ExportProgress
+type ObjectProgress struct {
+	Type      string
+	Name      string
+	Status    string
+	Rows      int64
+	Resumed   int64 // rows a resumed export already had
+	Estimated int64 // TABLE_ROWS from information_schema; 0 when unknown
+	Bytes     int64
+	Started   time.Time
+	Finished  time.Time
+	Error     string
+}
+
+// NewExportProgress starts tracking the objects of opts
+func NewExportProgress(dbName string, opts ExportOptions) *ExportProgress {
+	p := &ExportProgress{
+		database:  dbName,
+		output:    opts.OutputFile,
+		resumable: opts.Layout != ExportLayoutXLSX,
+		started:   time.Now(),
+		byKey:     map[string]*ObjectProgress{},
+	}
+	for _, obj := range opts.Objects {
+		p.entry(obj.Type, obj.Name)
+	}
+	if opts.Grants && opts.Layout != ExportLayoutXLSX {
+		p.entry(partGrants, dbName)
+	}
+	return p
+}
+
+// LoadEstimates reads the row estimates of the database's tables; they come from InnoDB statistics
+// and may be off by a fair margin
+func (p *ExportProgress) LoadEstimates(q Querier) error {
+	rows, err := q.QueryContext(context.Background(), `
+		SELECT TABLE_NAME, COALESCE(TABLE_ROWS, 0)
+		FROM INFORMATION_SCHEMA.TABLES
+		WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'
+	`, p.database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for rows.Next() {
+		var name string
+		var estimate int64
+		if err := rows.Scan(&name, &estimate); err != nil {
+			return err
+		}
+		if entry := p.byKey[manifestKey("TABLE", name)]; entry != nil {
+			entry.Estimated = estimate
+		}
+	}
+	return rows.Err()
+}
+
+func (p *ExportProgress) entry(objType, name string) *ObjectProgress {
+	entry := p.byKey[manifestKey(objType, name)]
+	if entry == nil {
+		entry = &ObjectProgress{Type: objType, Name: name, Status: progressPending}
+		p.objects = append(p.objects, entry)
+		p.byKey[manifestKey(objType, name)] = entry
+	}
+	return entry
+}
+
+// Start marks an object running, with the rows and bytes a resumed export already has of it
+func (p *ExportProgress) Start(objType, name string, rows, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.entry(objType, name)
+	entry.Status = progressRunning
+	entry.Started = time.Now()
+	entry.Rows, entry.Resumed = rows, rows
+	entry.Bytes = bytes
+}
+
+// Skip marks an object finished by the run being resumed
+func (p *ExportProgress) Skip(objType, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entry(objType, name).Status = progressSkipped
+}
+
+// Add counts rows and bytes written for an object; negative amounts take back a part that failed and is retried
+func (p *ExportProgress) Add(objType, name string, rows, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.entry(objType, name)
+	entry.Rows += rows
+	entry.Bytes += bytes
+	p.bytes += bytes
+}
+
+// RowCounter returns a callback for TableSQLOptions.OnRows, and one that takes back what it counted
+// when the part fails
+func (p *ExportProgress) RowCounter(objType, name string) (func(n int), func()) {
+	var counted int64
+	onRows := func(n int) {
+		counted += int64(n)
+		p.Add(objType, name, int64(n), 0)
+	}
+	takeBack := func() {
+		p.Add(objType, name, -counted, 0)
+		counted = 0
+	}
+	return onRows, takeBack
+}
+
+// Finish marks an object done, or failed with err
+func (p *ExportProgress) Finish(objType, name string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.entry(objType, name)
+	if entry.Status == progressFailed {
+		return
+	}
+	entry.Status = progressDone
+	entry.Finished = time.Now()
+	if err != nil {
+		entry.Status = progressFailed
+		entry.Error = err.Error()
+	}
+}
+
+// End stops the clock; Export calls it when it returns
+func (p *ExportProgress) End() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished = time.Now()
+}
+
+// Running returns a copy of the objects being exported, in the order they started
+func (p *ExportProgress) Running() []ObjectProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var running []ObjectProgress
+	for _, entry := range p.objects {
+		if entry.Status == progressRunning {
+			running = append(running, *entry)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].Started.Before(running[j].Started) })
+	return running
+}
+
+// ExportTotals sums up ExportProgress over all objects
+type ExportTotals struct {
+	Objects, Done, Skipped, Failed, Running int
+	Rows, Estimated                         int64
+	Copied                                  int64 // rows written by this run, for the rates
+	Bytes                                   int64 // written by this run
+	Elapsed                                 time.Duration
+	RowsPerSecond, BytesPerSecond           float64
+	Ended                                   bool
+	ETA                                     time.Duration // 0 when there is nothing to base it on
+}
+
+// Totals returns the current totals
+func (p *ExportProgress) Totals() ExportTotals {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.totalsLocked()
+}
+
+func (p *ExportProgress) totalsLocked() ExportTotals {
+	t := ExportTotals{Objects: len(p.objects), Bytes: p.bytes}
+	end := p.finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	t.Elapsed = end.Sub(p.started)
+	t.Ended = !p.finished.IsZero()
+
+	var remaining int64
+	for _, entry := range p.objects {
+		switch entry.Status {
+		case progressDone:
+			t.Done++
+		case progressSkipped:
+			t.Skipped++
+		case progressFailed:
+			t.Failed++
+		case progressRunning:
+			t.Running++
+		}
+		if entry.Status == progressSkipped {
+			continue
+		}
+		t.Rows += entry.Rows
+		t.Estimated += max(entry.Estimated, entry.Rows)
+		t.Copied += entry.Rows - entry.Resumed
+		if entry.Status == progressPending || entry.Status == progressRunning {
+			remaining += max(entry.Estimated-entry.Rows, 0)
+		}
+	}
+
+	if seconds := t.Elapsed.Seconds(); p.finished.IsZero() && t.Copied > 0 && seconds > 0 {
+		t.ETA = time.Duration(float64(remaining) / (float64(t.Copied) / seconds) * float64(time.Second))
+	}
+	t.RowsPerSecond = rate(t.Copied, t.Elapsed)
+	t.BytesPerSecond = rate(t.Bytes, t.Elapsed)
+	return t
+}
+
+// Per second over the whole run so far
+func rate(amount int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(amount) / elapsed.Seconds()
+}
+
+// Report is a plain-text summary of the export with one line per object
+func (p *ExportProgress) Report() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := p.totalsLocked()
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Export of database %s to %s\n", p.database, p.output))
+	b.WriteString(fmt.Sprintf("Started:  %s\n", p.started.Format("2006-01-02 15:04:05")))
+	b.WriteString(fmt.Sprintf("Duration: %s\n", t.Elapsed.Round(time.Second)))
+	b.WriteString(fmt.Sprintf("Objects:  %d exported, %d already done before resuming, %d failed, %d not exported\n",
+		t.Done, t.Skipped, t.Failed, t.Objects-t.Done-t.Skipped-t.Failed))
+	b.WriteString(fmt.Sprintf("Rows:     %d (estimated %d)\n", t.Rows, t.Estimated))
+	b.WriteString(fmt.Sprintf("Written:  %s, %.0f rows/s, %s/s\n\n",
+		FormatBytes(t.Bytes), t.RowsPerSecond, FormatBytes(int64(t.BytesPerSecond))))
+
+	b.WriteString(fmt.Sprintf("%-10s %-40s %-8s %12s %12s %10s %9s\n", "TYPE", "NAME", "STATUS", "ROWS", "ESTIMATED", "SIZE", "TIME"))
+	for _, entry := range p.objects {
+		duration := ""
+		if !entry.Finished.IsZero() {
+			duration = entry.Finished.Sub(entry.Started).Round(time.Millisecond).String()
+		}
+		b.WriteString(fmt.Sprintf("%-10s %-40s %-8s %12d %12d %10s %9s\n",
+			entry.Type, entry.Name, entry.Status, entry.Rows, entry.Estimated, FormatBytes(entry.Bytes), duration))
+		if entry.Error != "" {
+			b.WriteString("           error: " + entry.Error + "\n")
+		}
+	}
+	return b.String()
+}
+
+// Summary is the outcome in a sentence or two; failed is the number of objects the export returned as failed.
+// Objects that failed only as far as the progress knows count too.
+func (p *ExportProgress) Summary(exportErr error, failed int) string {
+	t := p.Totals()
+	failed = max(failed, t.Failed)
+	stats := fmt.Sprintf("%d object(s), %d rows, %s in %s.", t.Done+t.Skipped, t.Rows, FormatBytes(t.Bytes), t.Elapsed.Round(time.Second))
+	switch {
+	case exportErr != nil:
+		return "Export failed: " + exportErr.Error()
+	case failed > 0 && p.resumable:
+		return fmt.Sprintf("Export incomplete: %d object(s) failed. Exported %s\n\nExport to the same file again and choose Resume to retry them.", failed, stats)
+	case failed > 0:
+		return fmt.Sprintf("Export incomplete: %d object(s) failed. Exported %s", failed, stats)
+	}
+	return "Export completed: " + stats
+}
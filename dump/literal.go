@@ -0,0 +1,154 @@
+package dump
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var numericRegex = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// Escaping done by mysql_real_escape_string; tabs and other bytes stay as they are
+var literalEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\x00", "\\0",
+	"\n", "\\n",
+	"\r", "\\r",
+	"'", "\\'",
+	"\"", "\\\"",
+	"\x1a", "\\Z",
+)
+
+// Type families that decide how a value is written
+const (
+	kindText = iota
+	kindNumeric
+	kindBinary
+	kindBit
+)
+
+// EscapeString escapes a string for use inside a single-quoted MySQL literal
+func EscapeString(s string) string {
+	return literalEscaper.Replace(s)
+}
+
+// QuoteString returns s as a single-quoted MySQL string literal
+func QuoteString(s string) string {
+	return "'" + EscapeString(s) + "'"
+}
+
+// QuoteIdent returns name as a backtick-quoted identifier
+func QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// Literal renders a scanned value as a MySQL literal, driven by its column type.
+// ct may be nil, in which case the Go type of the value decides.
+func Literal(val interface{}, ct *sql.ColumnType) string {
+	typeName := ""
+	if ct != nil {
+		typeName = ct.DatabaseTypeName()
+	}
+	return LiteralForType(val, typeName)
+}
+
+// LiteralForType is Literal for a driver type name such as "VARCHAR" or "UNSIGNED BIGINT"
+func LiteralForType(val interface{}, typeName string) string {
+	kind := typeKind(typeName)
+
+	switch v := val.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int:
+		return strconv.Itoa(v)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return "'" + formatTime(v, typeName) + "'"
+	case sql.RawBytes:
+		return bytesLiteral([]byte(v), kind)
+	case []byte:
+		return bytesLiteral(v, kind)
+	case string:
+		return bytesLiteral([]byte(v), kind)
+	}
+	return QuoteString(fmt.Sprint(val))
+}
+
+func bytesLiteral(b []byte, kind int) string {
+	switch kind {
+	case kindNumeric:
+		if numericRegex.Match(b) {
+			return string(b)
+		}
+		return QuoteString(string(b))
+	case kindBit:
+		if len(b) == 0 {
+			return "b''"
+		}
+		return "0x" + hex.EncodeToString(b)
+	case kindBinary:
+		if len(b) == 0 {
+			return "''"
+		}
+		return "0x" + hex.EncodeToString(b)
+	}
+	// Text that is not valid UTF-8 cannot survive a text literal
+	if !utf8.Valid(b) {
+		return "_binary 0x" + hex.EncodeToString(b)
+	}
+	return QuoteString(string(b))
+}
+
+func typeKind(typeName string) int {
+	name := strings.TrimPrefix(strings.ToUpper(typeName), "UNSIGNED ")
+	switch name {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT",
+		"DECIMAL", "NUMERIC", "FLOAT", "DOUBLE", "REAL", "YEAR":
+		return kindNumeric
+	case "BIT":
+		return kindBit
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return kindBinary
+	}
+	return kindText
+}
+
+// IsNumericType reports whether values of the driver type are written unquoted
+func IsNumericType(typeName string) bool {
+	return typeKind(typeName) == kindNumeric
+}
+
+// IsBinaryType reports whether values of the driver type are written as hex literals
+func IsBinaryType(typeName string) bool {
+	kind := typeKind(typeName)
+	return kind == kindBinary || kind == kindBit
+}
+
+func formatTime(t time.Time, typeName string) string {
+	switch strings.ToUpper(typeName) {
+	case "DATE":
+		return t.Format("2006-01-02")
+	case "TIME":
+		return t.Format("15:04:05.999999")
+	}
+	return t.Format("2006-01-02 15:04:05.999999")
+}
@@ -0,0 +1,234 @@
+package dump
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Parse a literal the way the MySQL server reads it, returning the bytes it stands for; null is true for NULL.
+// Only the forms LiteralForType writes are understood.
+func parseLiteral(t *testing.T, lit string) (value []byte, null bool) {
+	t.Helper()
+	switch {
+	case lit == "NULL":
+		return nil, true
+	case lit == "b''":
+		return []byte{}, false
+	case strings.HasPrefix(lit, "_binary 0x"):
+		return decodeHex(t, lit[len("_binary 0x"):]), false
+	case strings.HasPrefix(lit, "0x"):
+		return decodeHex(t, lit[2:]), false
+	case strings.HasPrefix(lit, "'"):
+		return unquote(t, lit), false
+	}
+	if !numericRegex.MatchString(lit) {
+		t.Fatalf("%q is not a literal", lit)
+	}
+	return []byte(lit), false
+}
+
+func decodeHex(t *testing.T, digits string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(digits)
+	if err != nil {
+		t.Fatalf("bad hex literal 0x%s: %v", digits, err)
+	}
+	return b
+}
+
+// Undo the backslash escapes of a single-quoted string, as in the MySQL manual's table of escape sequences
+func unquote(t *testing.T, lit string) []byte {
+	t.Helper()
+	if len(lit) < 2 || lit[len(lit)-1] != '\'' {
+		t.Fatalf("unterminated string literal %q", lit)
+	}
+	body := lit[1 : len(lit)-1]
+	var out []byte
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '\'' {
+			t.Fatalf("unescaped quote inside %q", lit)
+		}
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		i++
+		if i == len(body) {
+			t.Fatalf("trailing backslash in %q", lit)
+		}
+		switch body[i] {
+		case '0':
+			out = append(out, 0)
+		case 'b':
+			out = append(out, '\b')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'Z':
+			out = append(out, 0x1a)
+		default:
+			out = append(out, body[i])
+		}
+	}
+	return out
+}
+
+func TestEscapeString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{`back\slash`, `back\\slash`},
+		{"it's", `it\'s`},
+		{`say "hi"`, `say \"hi\"`},
+		{"nul\x00byte", `nul\0byte`},
+		{"line\nfeed", `line\nfeed`},
+		{"carriage\rreturn", `carriage\rreturn`},
+		{"ctrl\x1aZ", `ctrl\ZZ`},
+		{"tab\tstays", "tab\tstays"},
+		{`\'`, `\\\'`},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := EscapeString(tt.in); got != tt.want {
+			t.Errorf("EscapeString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := unquote(t, QuoteString(tt.in)); string(got) != tt.in {
+			t.Errorf("QuoteString(%q) reads back as %q", tt.in, got)
+		}
+	}
+}
+
+// Expected read-back of a literal for an empty value
+const emptyValue = "<empty>"
+
+func TestLiteralForType(t *testing.T) {
+	micro := time.Date(2024, 2, 29, 23, 59, 58, 123456000, time.UTC)
+	tests := []struct {
+		name     string
+		val      interface{}
+		typeName string
+		want     string
+		back     string // bytes MySQL parses from the literal; empty means the same as want, emptyValue none
+	}{
+		{"null", nil, "VARCHAR", "NULL", ""},
+		{"null blob", nil, "BLOB", "NULL", ""},
+		{"backslash", []byte(`a\b`), "VARCHAR", `'a\\b'`, `a\b`},
+		{"quote", []byte("O'Brien"), "VARCHAR", `'O\'Brien'`, "O'Brien"},
+		{"nul", []byte("a\x00b"), "VARCHAR", `'a\0b'`, "a\x00b"},
+		{"newline", []byte("a\nb"), "TEXT", `'a\nb'`, "a\nb"},
+		{"carriage return", []byte("a\r\nb"), "TEXT", `'a\r\nb'`, "a\r\nb"},
+		{"ctrl-z", []byte("a\x1ab"), "CHAR", `'a\Zb'`, "a\x1ab"},
+		{"tab", []byte("a\tb"), "VARCHAR", "'a\tb'", "a\tb"},
+		{"utf-8", []byte("żółw 🐢"), "VARCHAR", "'żółw 🐢'", "żółw 🐢"},
+		{"string value", "x'y", "", `'x\'y'`, "x'y"},
+		{"invalid utf-8", []byte{'a', 0xff, 0xfe, 'b'}, "VARCHAR", "_binary 0x61fffe62", "a\xff\xfeb"},
+		{"invalid utf-8 untyped", sql.RawBytes{0xc3, 0x28}, "", "_binary 0xc328", "\xc3\x28"},
+		{"bit", []byte{0x05}, "BIT", "0x05", "\x05"},
+		{"bit(16)", []byte{0x80, 0x01}, "BIT", "0x8001", "\x80\x01"},
+		{"empty bit", []byte{}, "BIT", "b''", emptyValue},
+		{"blob", []byte{0x00, 0x27, 0x5c, 0xff}, "BLOB", "0x00275cff", "\x00'\\\xff"},
+		{"empty blob", []byte{}, "LONGBLOB", "''", emptyValue},
+		{"varbinary", []byte("ab"), "VARBINARY", "0x6162", "ab"},
+		{"decimal", []byte("12345678901234567890.123456789"), "DECIMAL", "12345678901234567890.123456789", ""},
+		{"negative decimal", []byte("-0.50"), "DECIMAL", "-0.50", ""},
+		{"unsigned bigint", []byte("18446744073709551615"), "UNSIGNED BIGINT", "18446744073709551615", ""},
+		{"not a number", []byte("1; DROP TABLE t"), "INT", `'1; DROP TABLE t'`, "1; DROP TABLE t"},
+		{"float", float64(0.1), "DOUBLE", "0.1", ""},
+		{"int64", int64(-42), "BIGINT", "-42", ""},
+		{"uint64", uint64(18446744073709551615), "UNSIGNED BIGINT", "18446744073709551615", ""},
+		{"bool", true, "TINYINT", "1", ""},
+		{"datetime(6)", micro, "DATETIME", "'2024-02-29 23:59:58.123456'", "2024-02-29 23:59:58.123456"},
+		{"datetime", micro.Truncate(time.Second), "DATETIME", "'2024-02-29 23:59:58'", "2024-02-29 23:59:58"},
+		{"timestamp(3)", micro.Truncate(time.Millisecond), "TIMESTAMP", "'2024-02-29 23:59:58.123'", "2024-02-29 23:59:58.123"},
+		{"date", micro, "DATE", "'2024-02-29'", "2024-02-29"},
+		{"time(6)", micro, "TIME", "'23:59:58.123456'", "23:59:58.123456"},
+		{"datetime text", []byte("2024-02-29 23:59:58.000001"), "DATETIME", "'2024-02-29 23:59:58.000001'", "2024-02-29 23:59:58.000001"},
+		{"json", []byte(`{"a": "it's", "b": "c:\\d", "n": null}`), "JSON",
+			`'{\"a\": \"it\'s\", \"b\": \"c:\\\\d\", \"n\": null}'`, `{"a": "it's", "b": "c:\\d", "n": null}`},
+		{"json unicode escape", []byte(`["\u00e9\n"]`), "JSON", `'[\"\\u00e9\\n\"]'`, `["\u00e9\n"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LiteralForType(tt.val, tt.typeName)
+			if got != tt.want {
+				t.Fatalf("LiteralForType(%#v, %q) = %s, want %s", tt.val, tt.typeName, got, tt.want)
+			}
+			value, null := parseLiteral(t, got)
+			if tt.val == nil {
+				if !null {
+					t.Fatalf("NULL read back as %q", value)
+				}
+				return
+			}
+			back := tt.back
+			switch back {
+			case "":
+				back = tt.want
+			case emptyValue:
+				back = ""
+			}
+			if !bytes.Equal(value, []byte(back)) {
+				t.Fatalf("%s reads back as %q, want %q", got, value, back)
+			}
+		})
+	}
+}
+
+// Every byte value survives a text and a binary column
+func TestLiteralRoundTripAllBytes(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, typeName := range []string{"VARCHAR", "BLOB", "BIT", ""} {
+		lit := LiteralForType(all, typeName)
+		value, _ := parseLiteral(t, lit)
+		if !bytes.Equal(value, all) {
+			t.Errorf("%q: all 256 bytes read back as %q", typeName, value)
+		}
+	}
+
+	// Valid UTF-8 with every escaped character stays a text literal
+	text := "\\\x00\n\r'\"\x1a\tż"
+	lit := LiteralForType([]byte(text), "TEXT")
+	if !strings.HasPrefix(lit, "'") {
+		t.Fatalf("valid UTF-8 written as %s", lit)
+	}
+	if value, _ := parseLiteral(t, lit); string(value) != text {
+		t.Errorf("%s reads back as %q, want %q", lit, value, text)
+	}
+}
+
+func TestBytesLiteral(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		kind int
+		want string
+	}{
+		{[]byte("12.50"), kindNumeric, "12.50"},
+		{[]byte("1e-7"), kindNumeric, "1e-7"},
+		{[]byte(".5"), kindNumeric, ".5"},
+		{[]byte(""), kindNumeric, "''"},
+		{[]byte("0x10"), kindNumeric, "'0x10'"},
+		{[]byte{}, kindBit, "b''"},
+		{[]byte{0x01}, kindBit, "0x01"},
+		{[]byte{}, kindBinary, "''"},
+		{[]byte{0xde, 0xad}, kindBinary, "0xdead"},
+		{[]byte("ok"), kindText, "'ok'"},
+		{[]byte{0x80}, kindText, "_binary 0x80"},
+	}
+	for _, tt := range tests {
+		if got := bytesLiteral(tt.in, tt.kind); got != tt.want {
+			t.Errorf("bytesLiteral(%q, %d) = %s, want %s", tt.in, tt.kind, got, tt.want)
+		}
+	}
+}
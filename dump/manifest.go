@@ -0,0 +1,350 @@
+package dump
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Name of the manifest inside an export's work directory
+const manifestFile = "manifest.json"
+
+// Rows per checkpointed chunk of a table with a primary key
+const exportChunkRows = 100000
+
+// Status of an object in the manifest
+const (
+	objectPartial = "partial" // some parts written, e.g. the first chunks of a table
+	objectDone    = "done"
+	objectFailed  = "failed"
+)
+
+// ExportManifest is the progress of an export, saved after every finished part so an interrupted export can be resumed
+type ExportManifest struct {
+	Database string
+	Options  ExportOptions
+	Started  time.Time
+	Updated  time.Time
+	Seq      int                        // last part number handed out
+	Objects  map[string]*ManifestObject // keyed by manifestKey
+}
+
+// ManifestObject is the state of one exported object
+type ManifestObject struct {
+	Type       string
+	Name       string
+	Status     string
+	Parts      map[string][]string `json:",omitempty"` // part kind -> file names in the work directory, in order
+	KeyColumns []string            `json:",omitempty"` // primary key the table's chunks are cut along
+	Boundaries [][]string          `json:",omitempty"` // last key of every chunk but the final one
+	Chunks     []manifestChunk     `json:",omitempty"` // finished chunks, in the order they finished
+	Error      string              `json:",omitempty"`
+}
+
+// A finished range of table rows
+type manifestChunk struct {
+	Index int // position of the range among the table's Boundaries
+	File  string
+	Rows  int
+	Bytes int64
+}
+
+func manifestKey(objType, name string) string {
+	return objType + " " + name
+}
+
+// Work directory of an export; it holds the part files and the manifest until the output is assembled
+func exportWorkDir(outputFile string) string {
+	return outputFile + ".parts"
+}
+
+// LoadManifest reads the manifest of an interrupted export to outputFile; it returns nil when there is none
+func LoadManifest(outputFile string) (*ExportManifest, error) {
+	data, err := os.ReadFile(filepath.Join(exportWorkDir(outputFile), manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := &ExportManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("read %s: %w", manifestFile, err)
+	}
+	if m.Objects == nil {
+		m.Objects = map[string]*ManifestObject{}
+	}
+	return m, nil
+}
+
+// Counts returns the objects done and failed so far
+func (m *ExportManifest) Counts() (done, failed int) {
+	for _, obj := range m.Objects {
+		switch obj.Status {
+		case objectDone:
+			done++
+		case objectFailed:
+			failed++
+		}
+	}
+	return done, failed
+}
+
+// Part files written by the workers, tracked in the manifest
+type exportParts struct {
+	mu       sync.Mutex
+	dir      string
+	manifest *ExportManifest
+	progress *ExportProgress // told about every byte written; may be nil
+}
+
+// Start a fresh work directory, or pick up the one of an interrupted export when resuming
+func openExportParts(dbName string, opts ExportOptions) (*exportParts, error) {
+	dir := exportWorkDir(opts.OutputFile)
+	parts := &exportParts{dir: dir}
+
+	if opts.Resume {
+		m, err := LoadManifest(opts.OutputFile)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return nil, fmt.Errorf("no interrupted export found in %s", dir)
+		}
+		if m.Database != dbName {
+			return nil, fmt.Errorf("%s belongs to an export of database %s", dir, m.Database)
+		}
+		parts.manifest = m
+		return parts, nil
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	parts.manifest = &ExportManifest{
+		Database: dbName,
+		Options:  opts,
+		Started:  time.Now(),
+		Objects:  map[string]*ManifestObject{},
+	}
+	return parts, parts.saveLocked()
+}
+
+// Write the manifest atomically; callers hold mu or have not shared parts yet
+func (p *exportParts) saveLocked() error {
+	p.manifest.Updated = time.Now()
+	data, err := json.MarshalIndent(p.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(p.dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(p.dir, manifestFile))
+}
+
+// Entry of an object about to be exported. Finished objects are returned as they are; anything else
+// starts over, except a table whose chunks can be continued after the last exported key.
+func (p *exportParts) begin(objType, name string) ManifestObject {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := manifestKey(objType, name)
+	entry := p.manifest.Objects[key]
+	if entry != nil && entry.Status == objectDone {
+		return *entry
+	}
+	resumable := entry != nil && len(entry.KeyColumns) > 0 && len(entry.Parts[partTable]) > 0
+	if entry == nil || !resumable {
+		if entry != nil {
+			p.removeFilesLocked(entry)
+		}
+		entry = &ManifestObject{Type: objType, Name: name}
+		p.manifest.Objects[key] = entry
+	}
+	entry.Status = objectPartial
+	entry.Error = ""
+	return *entry
+}
+
+func (p *exportParts) removeFilesLocked(entry *ManifestObject) {
+	for _, files := range entry.Parts {
+		for _, file := range files {
+			os.Remove(filepath.Join(p.dir, file))
+		}
+	}
+}
+
+// Remember the key a table is chunked along and where its chunks end
+func (p *exportParts) setPlan(objType, name string, columns []string, boundaries [][]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.manifest.Objects[manifestKey(objType, name)]
+	entry.KeyColumns = columns
+	entry.Boundaries = boundaries
+	return p.saveLocked()
+}
+
+// Progress of a chunked table after one of its chunks ended. completed is true exactly once,
+// for the chunk that finishes a table none of whose chunks failed; the table is then marked done.
+func (p *exportParts) chunkFinished(objType, name string) (done, total, rows int, bytes int64, completed bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.manifest.Objects[manifestKey(objType, name)]
+	for _, chunk := range entry.Chunks {
+		rows += chunk.Rows
+		bytes += chunk.Bytes
+	}
+	done, total = len(entry.Chunks), len(entry.Boundaries)+1
+	if done == total && entry.Status == objectPartial {
+		entry.Status = objectDone
+		completed = true
+		err = p.saveLocked()
+	}
+	return done, total, rows, bytes, completed, err
+}
+
+// Render one part of an object into its own file and record it; chunk, when given, is recorded with it
+func (p *exportParts) write(objType, name, kind string, chunk *manifestChunk, render func(w *bufio.Writer) error) error {
+	p.mu.Lock()
+	p.manifest.Seq++
+	file := fmt.Sprintf("%06d_%s.sql", p.manifest.Seq, kind)
+	p.mu.Unlock()
+
+	path := filepath.Join(p.dir, file)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	counter := &countingWriter{w: f}
+	if p.progress != nil {
+		counter.onWrite = func(n int) { p.progress.Add(objType, name, 0, int64(n)) }
+	}
+	w := bufio.NewWriter(counter)
+	err = render(w)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		if p.progress != nil {
+			p.progress.Add(objType, name, 0, -counter.n)
+		}
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.manifest.Objects[manifestKey(objType, name)]
+	if entry.Parts == nil {
+		entry.Parts = map[string][]string{}
+	}
+	entry.Parts[kind] = append(entry.Parts[kind], file)
+	if chunk != nil {
+		chunk.File = file
+		chunk.Bytes = counter.n
+		entry.Chunks = append(entry.Chunks, *chunk)
+	}
+	return p.saveLocked()
+}
+
+type countingWriter struct {
+	w       io.Writer
+	n       int64
+	onWrite func(n int)
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	if c.onWrite != nil {
+		c.onWrite(n)
+	}
+	return n, err
+}
+
+// Mark an object done, or failed with err; a failure is kept even if other chunks of the table finish later
+func (p *exportParts) finish(objType, name string, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.manifest.Objects[manifestKey(objType, name)]
+	if entry.Status == objectFailed {
+		return nil
+	}
+	entry.Status = objectDone
+	if err != nil {
+		entry.Status = objectFailed
+		entry.Error = err.Error()
+	}
+	return p.saveLocked()
+}
+
+// Objects that did not finish, sorted by type and name
+func (p *exportParts) failures() []ManifestObject {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var failed []ManifestObject
+	for _, entry := range p.manifest.Objects {
+		if entry.Status != objectDone {
+			failed = append(failed, *entry)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return manifestKey(failed[i].Type, failed[i].Name) < manifestKey(failed[j].Type, failed[j].Name)
+	})
+	return failed
+}
+
+// Part files of finished objects of one kind, by object name; a table's chunks follow its header in key order
+func (p *exportParts) paths(kind string) map[string][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := map[string][]string{}
+	for _, entry := range p.manifest.Objects {
+		if entry.Status != objectDone || len(entry.Parts[kind]) == 0 {
+			continue
+		}
+		chunkFiles := map[string]bool{}
+		for _, chunk := range entry.Chunks {
+			chunkFiles[chunk.File] = true
+		}
+		for _, file := range entry.Parts[kind] {
+			if !chunkFiles[file] {
+				out[entry.Name] = append(out[entry.Name], filepath.Join(p.dir, file))
+			}
+		}
+		chunks := append([]manifestChunk(nil), entry.Chunks...)
+		sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+		for _, chunk := range chunks {
+			out[entry.Name] = append(out[entry.Name], filepath.Join(p.dir, chunk.File))
+		}
+	}
+	return out
+}
+
+// Errors worth retrying on a fresh connection
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
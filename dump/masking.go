@@ -0,0 +1,248 @@
+package dump
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Masks a rule can apply
+const (
+	MaskNull   = "null"   // NULL
+	MaskFixed  = "fixed"  // the rule's Value
+	MaskHash   = "hash"   // a 16-character hex digest; numbers become a number with as many digits, which can collide
+	MaskEmail  = "email"  // user_<20 hex digits>@example.com
+	MaskName   = "name"   // a made-up first and last name
+	MaskFormat = "format" // every digit and letter replaced by another of its kind, punctuation kept
+)
+
+// MaskRule masks one column, named table.column; * as the table matches the column in every table
+type MaskRule struct {
+	Column string `json:"column"`
+	Mask   string `json:"mask"`
+	Value  string `json:"value,omitempty"` // replacement of MaskFixed
+}
+
+// MaskConfig is the layout of a masking rules file
+type MaskConfig struct {
+	Salt  string     `json:"salt"` // keys the digests, so they cannot be reversed by hashing guesses
+	Rules []MaskRule `json:"rules"`
+}
+
+// Masker applies masking rules to exported values. Every mask but MaskFixed and MaskNull derives its output
+// from the value alone, so a key masked in one table equals the same key masked in the tables referencing it.
+// Distinct values can still mask alike: numbers under MaskHash keep their digit count, so a short number has
+// few possible outputs; a numeric primary or unique key masked that way can break the restore. NULL stays NULL.
+// A nil *Masker masks nothing.
+type Masker struct {
+	salt   []byte
+	rules  map[string]*MaskRule // lower-case table.column
+	anyTab map[string]*MaskRule // lower-case column, from *.column
+}
+
+var maskFirstNames = []string{"Alex", "Sam", "Robin", "Jordan", "Taylor", "Morgan", "Casey", "Jamie", "Riley", "Avery",
+	"Quinn", "Charlie", "Drew", "Kim", "Lee", "Noa", "Sasha", "Toni", "Eli", "Jesse"}
+var maskLastNames = []string{"Smith", "Novak", "Garcia", "Kowalski", "Tanaka", "Müller", "Silva", "Jensen", "Rossi", "Dubois",
+	"Okafor", "Nguyen", "Petrov", "Larsen", "Moreau", "Costa", "Ivanova", "Berg", "Hansen", "Park"}
+
+// LoadMasker reads a masking rules file, e.g.
+//
+//	{"salt": "s3cret", "rules": [{"column": "customers.email", "mask": "email"}, {"column": "*.phone", "mask": "format"}]}
+func LoadMasker(path string) (*Masker, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config MaskConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m, err := NewMasker(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// NewMasker checks the rules of a config and prepares them for lookup
+func NewMasker(config MaskConfig) (*Masker, error) {
+	m := &Masker{salt: []byte(config.Salt), rules: map[string]*MaskRule{}, anyTab: map[string]*MaskRule{}}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		rule.Mask = strings.ToLower(strings.TrimSpace(rule.Mask))
+		switch rule.Mask {
+		case MaskNull, MaskFixed, MaskHash, MaskEmail, MaskName, MaskFormat:
+		default:
+			return nil, fmt.Errorf("rule %d (%s): unknown mask %q", i+1, rule.Column, rule.Mask)
+		}
+		table, column, ok := strings.Cut(strings.ToLower(strings.TrimSpace(rule.Column)), ".")
+		if !ok || table == "" || column == "" {
+			return nil, fmt.Errorf("rule %d: column %q is not table.column", i+1, rule.Column)
+		}
+		if table == "*" {
+			m.anyTab[column] = rule
+		} else {
+			m.rules[table+"."+column] = rule
+		}
+	}
+	return m, nil
+}
+
+// Columns returns the rule of each column of table, nil for unmasked columns, or nil when none is masked
+func (m *Masker) Columns(table string, columns []string) []*MaskRule {
+	if m == nil {
+		return nil
+	}
+	table = strings.ToLower(table)
+	var rules []*MaskRule
+	for i, col := range columns {
+		col = strings.ToLower(col)
+		rule, ok := m.rules[table+"."+col]
+		if !ok {
+			rule, ok = m.anyTab[col]
+		}
+		if !ok {
+			continue
+		}
+		if rules == nil {
+			rules = make([]*MaskRule, len(columns))
+		}
+		rules[i] = rule
+	}
+	return rules
+}
+
+// Row returns values with the rules applied; the values themselves are left alone.
+// types are driver type names and may be shorter than values.
+func (m *Masker) Row(rules []*MaskRule, values []interface{}, types []string) []interface{} {
+	if rules == nil {
+		return values
+	}
+	out := make([]interface{}, len(values))
+	for i, val := range values {
+		out[i] = val
+		if i < len(rules) && rules[i] != nil {
+			out[i] = m.Value(rules[i], val, typeAt(types, i))
+		}
+	}
+	return out
+}
+
+// RowForColumns is Row for scanned column types
+func (m *Masker) RowForColumns(rules []*MaskRule, values []interface{}, colTypes []*sql.ColumnType) []interface{} {
+	if rules == nil {
+		return values
+	}
+	types := make([]string, len(colTypes))
+	for i, ct := range colTypes {
+		types[i] = ct.DatabaseTypeName()
+	}
+	return m.Row(rules, values, types)
+}
+
+// Value masks one value of a column of the driver type typeName
+func (m *Masker) Value(rule *MaskRule, val interface{}, typeName string) interface{} {
+	if val == nil {
+		return nil
+	}
+	switch rule.Mask {
+	case MaskNull:
+		return nil
+	case MaskFixed:
+		return []byte(rule.Value)
+	}
+
+	text := maskText(val, typeName)
+	digest := m.digest(text)
+	numeric := IsNumericType(typeName)
+	switch rule.Mask {
+	case MaskHash:
+		if numeric {
+			return []byte(maskFormat(text, digest, true))
+		}
+		return []byte(hex.EncodeToString(digest[:8]))
+	case MaskEmail:
+		// 80 bits, so a unique column of millions of addresses stays unique
+		return []byte("user_" + hex.EncodeToString(digest[:10]) + "@example.com")
+	case MaskName:
+		first := maskFirstNames[int(digest[0])%len(maskFirstNames)]
+		last := maskLastNames[int(digest[1])%len(maskLastNames)]
+		return []byte(first + " " + last)
+	}
+	return []byte(maskFormat(text, digest, numeric))
+}
+
+// HMAC-SHA256 of a value under the salt
+func (m *Masker) digest(text string) []byte {
+	mac := hmac.New(sha256.New, m.salt)
+	mac.Write([]byte(text))
+	return mac.Sum(nil)
+}
+
+// Text of a value as the digest input, so the same value digests alike whatever Go type the driver chose
+func maskText(val interface{}, typeName string) string {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	case sql.RawBytes:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		return formatTime(v, typeName)
+	}
+	return fmt.Sprint(val)
+}
+
+// Replace digits with digits and letters with letters of the same case, drawing from a stream seeded by the
+// digest. A number keeps a non-zero leading digit, so it keeps its length.
+func maskFormat(text string, digest []byte, numeric bool) string {
+	stream := maskStream{seed: digest}
+	var b strings.Builder
+	leading := true
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			if numeric && leading && r != '0' {
+				b.WriteRune('1' + rune(stream.next()%9))
+			} else {
+				b.WriteRune('0' + rune(stream.next()%10))
+			}
+			leading = false
+		case r >= 'a' && r <= 'z':
+			b.WriteRune('a' + rune(stream.next()%26))
+		case r >= 'A' && r <= 'Z':
+			b.WriteRune('A' + rune(stream.next()%26))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Pseudo-random bytes: SHA-256 of the seed and a counter, for values longer than one digest
+type maskStream struct {
+	seed    []byte
+	block   []byte
+	counter uint64
+}
+
+func (s *maskStream) next() byte {
+	if len(s.block) == 0 {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], s.counter)
+		s.counter++
+		sum := sha256.Sum256(append(append([]byte{}, s.seed...), n[:]...))
+		s.block = sum[:]
+	}
+	b := s.block[0]
+	s.block = s.block[1:]
+	return b
+}
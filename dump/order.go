@@ -0,0 +1,43 @@
+package dump
+
+import "sort"
+
+// SortByDependencies orders names so that each one comes after the names it depends on.
+// Dependencies outside names are ignored and cycles are broken at the first back edge,
+// so the result always contains every name exactly once.
+func SortByDependencies(names []string, deps map[string][]string) []string {
+	known := make(map[string]bool, len(names))
+	for _, n := range names {
+		known[n] = true
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(names))
+	ordered := make([]string, 0, len(names))
+
+	var visit func(string)
+	visit = func(n string) {
+		if state[n] != unvisited {
+			return
+		}
+		state[n] = visiting
+		parents := append([]string(nil), deps[n]...)
+		sort.Strings(parents)
+		for _, p := range parents {
+			if known[p] && p != n && state[p] == unvisited {
+				visit(p)
+			}
+		}
+		state[n] = done
+		ordered = append(ordered, n)
+	}
+
+	for _, n := range names {
+		visit(n)
+	}
+	return ordered
+}
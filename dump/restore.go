@@ -0,0 +1,178 @@
+package dump
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// RestoreOptions controls how a dump file is loaded
+type RestoreOptions struct {
+	File        string
+	Database    string // selected with USE before the first statement; empty keeps the connection's
+	StopOnError bool   // false skips failing statements and reports them through OnError
+}
+
+// RestoreProgress is a snapshot of a running restore
+type RestoreProgress struct {
+	BytesRead  int64 // bytes of the file read so far (compressed bytes for .gz)
+	TotalBytes int64
+	Statements int // statements executed, including failed ones
+	Failed     int
+}
+
+// RestoreError describes one failed statement
+type RestoreError struct {
+	Line      int
+	Statement string
+	Err       error
+}
+
+func (e RestoreError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// OpenDump opens a .sql or gzip-compressed dump; compression is detected from the content, not the name.
+// The returned function reports how many bytes of the file have been read.
+func OpenDump(path string) (io.ReadCloser, func() int64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+
+	counter := &countingReader{r: f}
+	buffered := bufio.NewReader(counter)
+	var r io.Reader = buffered
+	var closeGzip func() error
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			f.Close()
+			return nil, nil, 0, err
+		}
+		r = gz
+		closeGzip = gz.Close
+	}
+
+	rc := readCloser{Reader: r, close: func() error {
+		if closeGzip != nil {
+			closeGzip()
+		}
+		return f.Close()
+	}}
+	return rc, counter.n.Load, info.Size(), nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error { return r.close() }
+
+// Restore runs every statement of the dump on one connection, so session settings such as
+// FOREIGN_KEY_CHECKS=0 from the dump header stay in effect. onProgress and onError may be nil.
+func Restore(ctx context.Context, db *sql.DB, opts RestoreOptions, onProgress func(RestoreProgress), onError func(RestoreError)) (RestoreProgress, error) {
+	var progress RestoreProgress
+
+	file, bytesRead, total, err := OpenDump(opts.File)
+	if err != nil {
+		return progress, err
+	}
+	defer file.Close()
+	progress.TotalBytes = total
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return progress, err
+	}
+	defer conn.Close()
+
+	if opts.Database != "" {
+		if _, err := conn.ExecContext(ctx, "USE "+QuoteIdent(opts.Database)); err != nil {
+			return progress, err
+		}
+	}
+
+	scanner := NewStatementScanner(file)
+	for scanner.Next() {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		stmt := scanner.Statement()
+		_, execErr := conn.ExecContext(ctx, stmt)
+		progress.Statements++
+		progress.BytesRead = bytesRead()
+
+		if execErr != nil {
+			if ctx.Err() != nil {
+				return progress, ctx.Err()
+			}
+			progress.Failed++
+			failure := RestoreError{Line: scanner.Line(), Statement: stmt, Err: execErr}
+			if onError != nil {
+				onError(failure)
+			}
+			if opts.StopOnError {
+				if onProgress != nil {
+					onProgress(progress)
+				}
+				return progress, failure
+			}
+		}
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return progress, err
+	}
+	progress.BytesRead = bytesRead()
+	return progress, nil
+}
+
+// Abbreviate collapses whitespace and shortens a statement to max characters for logs and error lists
+func Abbreviate(stmt string, max int) string {
+	runes := []rune(strings.Join(strings.Fields(stmt), " "))
+	if len(runes) <= max {
+		return string(runes)
+	}
+	return string(runes[:max]) + "..."
+}
+
+// FormatBytes renders a size in binary units, e.g. 1.5 MiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,551 @@
+package dump
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Result export formats
+const (
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatSQL      = "sql"
+)
+
+// ResultFormats lists the formats in the order they are offered
+var ResultFormats = []string{FormatCSV, FormatTSV, FormatJSON, FormatNDJSON, FormatMarkdown, FormatHTML, FormatSQL, FormatXLSX}
+
+// FormatExtension is the usual file extension of a format
+func FormatExtension(format string) string {
+	switch format {
+	case FormatMarkdown:
+		return ".md"
+	case FormatHTML:
+		return ".html"
+	}
+	return "." + format
+}
+
+// ResultOptions controls WriteResults
+type ResultOptions struct {
+	Format     string
+	TableName  string   // target table of FormatSQL
+	BatchSize  int      // rows per INSERT of FormatSQL; 0 means 1000
+	SheetNames []string // sheet per result set of FormatXLSX; "Result N" when missing
+	Mask       *Masker  // masks the rows written; nil writes them as they are
+	MaskTable  string   // table the columns are matched against; rules of other tables only apply through *.column
+}
+
+// ResultSource yields the rows of one or more result sets; *sql.Rows is adapted by RowsSource
+type ResultSource interface {
+	Columns() []string
+	Types() []string // driver type names, e.g. "VARCHAR"; may be shorter than Columns
+	Next() bool
+	Values() []interface{}
+	NextResultSet() bool
+	Err() error
+}
+
+// resultWriter renders result sets in one format
+type resultWriter interface {
+	begin(set int, columns, types []string) error
+	row(values []interface{}) error
+	end(set int) error
+	close() error
+}
+
+// WriteResults streams every result set of src to w in opts.Format and returns the number of rows written
+func WriteResults(w io.Writer, src ResultSource, opts ResultOptions) (int, error) {
+	rw, err := newResultWriter(w, opts)
+	if err != nil {
+		return 0, err
+	}
+	// Writers that buffer in temporary files drop them when writing stops early
+	if c, ok := rw.(interface{ cleanup() }); ok {
+		defer c.cleanup()
+	}
+
+	count := 0
+	for set := 0; ; set++ {
+		columns, types := src.Columns(), src.Types()
+		if len(columns) == 0 {
+			// Status-only results, such as the one ending a CALL
+			if !src.NextResultSet() {
+				break
+			}
+			set--
+			continue
+		}
+		if err := rw.begin(set, columns, types); err != nil {
+			return count, err
+		}
+		masks := opts.Mask.Columns(opts.MaskTable, columns)
+		for src.Next() {
+			if err := rw.row(opts.Mask.Row(masks, src.Values(), types)); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err := src.Err(); err != nil {
+			return count, err
+		}
+		if err := rw.end(set); err != nil {
+			return count, err
+		}
+		if !src.NextResultSet() {
+			break
+		}
+	}
+	return count, rw.close()
+}
+
+func newResultWriter(w io.Writer, opts ResultOptions) (resultWriter, error) {
+	switch opts.Format {
+	case FormatCSV, FormatTSV:
+		return &delimitedWriter{w: w, tsv: opts.Format == FormatTSV}, nil
+	case FormatJSON, FormatNDJSON:
+		return &jsonWriter{w: w, ndjson: opts.Format == FormatNDJSON}, nil
+	case FormatMarkdown:
+		return &markdownWriter{w: w}, nil
+	case FormatHTML:
+		return &htmlWriter{w: w}, nil
+	case FormatSQL:
+		if opts.TableName == "" {
+			return nil, fmt.Errorf("a table name is needed for INSERT statements")
+		}
+		batch := opts.BatchSize
+		if batch <= 0 {
+			batch = 1000
+		}
+		return &insertWriter{w: w, table: opts.TableName, batch: batch}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, opts.SheetNames), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", opts.Format)
+}
+
+// Text of a value for the plain-text formats; ok is false for NULL
+func textValue(val interface{}, typeName string) (string, bool) {
+	switch v := val.(type) {
+	case nil:
+		return "", false
+	case []byte:
+		if IsBinaryType(typeName) {
+			return "0x" + fmt.Sprintf("%x", v), true
+		}
+		return string(v), true
+	case sql.RawBytes:
+		return textValue([]byte(v), typeName)
+	case string:
+		return v, true
+	case time.Time:
+		return formatTime(v, typeName), true
+	}
+	return fmt.Sprint(val), true
+}
+
+func typeAt(types []string, i int) string {
+	if i < len(types) {
+		return types[i]
+	}
+	return ""
+}
+
+// CSV (RFC 4180: quoted when needed, CRLF line ends, NULL as an empty field)
+// or TSV (MySQL style: \t, \n and \\ escaped, NULL as \N)
+type delimitedWriter struct {
+	w     io.Writer
+	tsv   bool
+	csv   *csv.Writer
+	types []string
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func (d *delimitedWriter) begin(set int, columns, types []string) error {
+	d.types = types
+	if set > 0 {
+		// Blank line between result sets
+		if _, err := io.WriteString(d.w, d.lineEnd()); err != nil {
+			return err
+		}
+	}
+	if d.tsv {
+		return d.writeTSV(columns, nil)
+	}
+	if d.csv == nil {
+		d.csv = csv.NewWriter(d.w)
+		d.csv.UseCRLF = true
+	}
+	return d.csv.Write(columns)
+}
+
+func (d *delimitedWriter) lineEnd() string {
+	if d.tsv {
+		return "\n"
+	}
+	return "\r\n"
+}
+
+// Escape into a copy: the header fields are the result set's own column names, which masking still
+// looks up afterwards. A field marked in null is written as \N.
+func (d *delimitedWriter) writeTSV(fields []string, null []bool) error {
+	escaped := make([]string, len(fields))
+	for i, field := range fields {
+		if i < len(null) && null[i] {
+			escaped[i] = "\\N"
+			continue
+		}
+		escaped[i] = tsvEscaper.Replace(field)
+	}
+	_, err := io.WriteString(d.w, strings.Join(escaped, "\t")+"\n")
+	return err
+}
+
+func (d *delimitedWriter) row(values []interface{}) error {
+	fields := make([]string, len(values))
+	null := make([]bool, len(values))
+	for i, val := range values {
+		text, ok := textValue(val, typeAt(d.types, i))
+		fields[i], null[i] = text, !ok
+	}
+	if d.tsv {
+		return d.writeTSV(fields, null)
+	}
+	return d.csv.Write(fields)
+}
+
+func (d *delimitedWriter) end(set int) error {
+	if d.csv != nil {
+		d.csv.Flush()
+		return d.csv.Error()
+	}
+	return nil
+}
+
+func (d *delimitedWriter) close() error { return nil }
+
+// JSON: one array of row objects across all result sets; NDJSON: one object per line
+type jsonWriter struct {
+	w       io.Writer
+	ndjson  bool
+	columns []string
+	types   []string
+	rows    int
+	opened  bool
+}
+
+func (j *jsonWriter) begin(set int, columns, types []string) error {
+	j.columns, j.types = columns, types
+	if !j.opened && !j.ndjson {
+		j.opened = true
+		_, err := io.WriteString(j.w, "[")
+		return err
+	}
+	return nil
+}
+
+func jsonValue(val interface{}, typeName string) interface{} {
+	if val == nil {
+		return nil
+	}
+	if IsNumericType(typeName) {
+		if text, _ := textValue(val, typeName); numericRegex.MatchString(text) {
+			return json.Number(text)
+		}
+	}
+	switch v := val.(type) {
+	case int64, int32, int, uint64, float64, float32, bool:
+		return v
+	case []byte:
+		if IsBinaryType(typeName) || !utf8.Valid(v) {
+			return base64.StdEncoding.EncodeToString(v)
+		}
+	}
+	text, _ := textValue(val, typeName)
+	return text
+}
+
+func (j *jsonWriter) row(values []interface{}) error {
+	// Keep the column order of the result instead of map order
+	var b strings.Builder
+	b.WriteString("{")
+	for i, val := range values {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, _ := json.Marshal(j.columns[i])
+		data, err := json.Marshal(jsonValue(val, typeAt(j.types, i)))
+		if err != nil {
+			return err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(data)
+	}
+	b.WriteString("}")
+
+	prefix := ""
+	switch {
+	case j.ndjson:
+	case j.rows > 0:
+		prefix = ",\n"
+	default:
+		prefix = "\n"
+	}
+	suffix := ""
+	if j.ndjson {
+		suffix = "\n"
+	}
+	j.rows++
+	_, err := io.WriteString(j.w, prefix+b.String()+suffix)
+	return err
+}
+
+func (j *jsonWriter) end(set int) error { return nil }
+
+func (j *jsonWriter) close() error {
+	if j.ndjson {
+		return nil
+	}
+	if !j.opened {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+// GitHub-flavoured Markdown table
+type markdownWriter struct {
+	w     io.Writer
+	types []string
+}
+
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+func (m *markdownWriter) begin(set int, columns, types []string) error {
+	m.types = types
+	var b strings.Builder
+	if set > 0 {
+		b.WriteString("\n")
+	}
+	cells := make([]string, len(columns))
+	seps := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = markdownEscaper.Replace(col)
+		seps[i] = "---"
+		if IsNumericType(typeAt(types, i)) {
+			seps[i] = "---:"
+		}
+	}
+	b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	b.WriteString("| " + strings.Join(seps, " | ") + " |\n")
+	_, err := io.WriteString(m.w, b.String())
+	return err
+}
+
+func (m *markdownWriter) row(values []interface{}) error {
+	cells := make([]string, len(values))
+	for i, val := range values {
+		text, ok := textValue(val, typeAt(m.types, i))
+		if !ok {
+			text = "NULL"
+		}
+		cells[i] = markdownEscaper.Replace(text)
+	}
+	_, err := io.WriteString(m.w, "| "+strings.Join(cells, " | ")+" |\n")
+	return err
+}
+
+func (m *markdownWriter) end(set int) error { return nil }
+func (m *markdownWriter) close() error      { return nil }
+
+// HTML document with one <table> per result set
+type htmlWriter struct {
+	w     io.Writer
+	types []string
+}
+
+func (h *htmlWriter) begin(set int, columns, types []string) error {
+	h.types = types
+	var b strings.Builder
+	if set == 0 {
+		b.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>Query result</title></head>\n<body>\n")
+	}
+	b.WriteString("<table border=\"1\">\n<thead>\n<tr>")
+	for _, col := range columns {
+		b.WriteString("<th>" + html.EscapeString(col) + "</th>")
+	}
+	b.WriteString("</tr>\n</thead>\n<tbody>\n")
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *htmlWriter) row(values []interface{}) error {
+	var b strings.Builder
+	b.WriteString("<tr>")
+	for i, val := range values {
+		text, ok := textValue(val, typeAt(h.types, i))
+		if !ok {
+			b.WriteString("<td><i>NULL</i></td>")
+			continue
+		}
+		b.WriteString("<td>" + html.EscapeString(text) + "</td>")
+	}
+	b.WriteString("</tr>\n")
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *htmlWriter) end(set int) error {
+	_, err := io.WriteString(h.w, "</tbody>\n</table>\n")
+	return err
+}
+
+func (h *htmlWriter) close() error {
+	_, err := io.WriteString(h.w, "</body>\n</html>\n")
+	return err
+}
+
+// Batched INSERT statements with lossless literals
+type insertWriter struct {
+	w       io.Writer
+	table   string
+	batch   int
+	types   []string
+	prefix  string
+	pending []string
+}
+
+func (s *insertWriter) begin(set int, columns, types []string) error {
+	s.types = types
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = QuoteIdent(col)
+	}
+	s.prefix = fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", QuoteIdent(s.table), strings.Join(quoted, ", "))
+	return nil
+}
+
+func (s *insertWriter) row(values []interface{}) error {
+	literals := make([]string, len(values))
+	for i, val := range values {
+		literals[i] = LiteralForType(val, typeAt(s.types, i))
+	}
+	s.pending = append(s.pending, "("+strings.Join(literals, ", ")+")")
+	if len(s.pending) >= s.batch {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *insertWriter) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(s.w, s.prefix+strings.Join(s.pending, ",\n")+";\n")
+	s.pending = s.pending[:0]
+	return err
+}
+
+func (s *insertWriter) end(set int) error { return s.flush() }
+func (s *insertWriter) close() error      { return nil }
+
+// RowsSource adapts *sql.Rows to ResultSource
+type RowsSource struct {
+	rows    *sql.Rows
+	columns []string
+	types   []string
+	values  []interface{}
+	err     error
+}
+
+// NewRowsSource reads the column metadata of the current result set
+func NewRowsSource(rows *sql.Rows) *RowsSource {
+	s := &RowsSource{rows: rows}
+	s.load()
+	return s
+}
+
+func (s *RowsSource) load() {
+	s.columns, s.err = s.rows.Columns()
+	s.types = nil
+	if colTypes, err := s.rows.ColumnTypes(); err == nil {
+		for _, ct := range colTypes {
+			s.types = append(s.types, ct.DatabaseTypeName())
+		}
+	}
+}
+
+func (s *RowsSource) Columns() []string { return s.columns }
+func (s *RowsSource) Types() []string   { return s.types }
+
+func (s *RowsSource) Next() bool {
+	if s.err != nil || !s.rows.Next() {
+		return false
+	}
+	values := make([]interface{}, len(s.columns))
+	ptrs := make([]interface{}, len(s.columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := s.rows.Scan(ptrs...); err != nil {
+		s.err = err
+		return false
+	}
+	s.values = values
+	return true
+}
+
+func (s *RowsSource) Values() []interface{} { return s.values }
+
+func (s *RowsSource) NextResultSet() bool {
+	if s.err != nil || !s.rows.NextResultSet() {
+		return false
+	}
+	s.load()
+	return true
+}
+
+func (s *RowsSource) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.rows.Err()
+}
+
+// SliceSource is a single result set held in memory, e.g. the cells of a grid
+type SliceSource struct {
+	Cols  []string
+	Typs  []string
+	Rows  [][]interface{}
+	index int
+}
+
+func (s *SliceSource) Columns() []string { return s.Cols }
+func (s *SliceSource) Types() []string   { return s.Typs }
+
+func (s *SliceSource) Next() bool {
+	if s.index >= len(s.Rows) {
+		return false
+	}
+	s.index++
+	return true
+}
+
+func (s *SliceSource) Values() []interface{} { return s.Rows[s.index-1] }
+func (s *SliceSource) NextResultSet() bool   { return false }
+func (s *SliceSource) Err() error            { return nil }
@@ -0,0 +1,129 @@
+package dump
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// One row of every kind: quoting and escapes, NULLs, and empty and invalid UTF-8 values
+func testResultSource() *SliceSource {
+	return &SliceSource{
+		Cols: []string{"id", "name", "data", "price"},
+		Typs: []string{"INT", "VARCHAR", "BLOB", "DECIMAL"},
+		Rows: [][]interface{}{
+			{[]byte("1"), []byte(`say "hi", ok`), []byte{0x00, 0xff}, []byte("12.50")},
+			{[]byte("2"), nil, nil, nil},
+			{[]byte("3"), []byte("line\nbreak\\"), []byte{}, []byte("-0.5")},
+			{int64(4), []byte{'a', 0xff}, []byte("x"), float64(0.25)},
+		},
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	tests := []struct {
+		format string
+		opts   ResultOptions
+		want   string
+	}{
+		{FormatCSV, ResultOptions{},
+			"id,name,data,price\r\n" +
+				"1,\"say \"\"hi\"\", ok\",0x00ff,12.50\r\n" +
+				"2,,,\r\n" +
+				// encoding/csv ends lines inside quoted fields with CRLF too
+				"3,\"line\r\nbreak\\\",0x,-0.5\r\n" +
+				"4,a\xff,0x78,0.25\r\n"},
+		{FormatTSV, ResultOptions{},
+			"id\tname\tdata\tprice\n" +
+				"1\tsay \"hi\", ok\t0x00ff\t12.50\n" +
+				"2\t\\N\t\\N\t\\N\n" +
+				"3\tline\\nbreak\\\\\t0x\t-0.5\n" +
+				"4\ta\xff\t0x78\t0.25\n"},
+		{FormatJSON, ResultOptions{},
+			"[\n" +
+				`{"id":1,"name":"say \"hi\", ok","data":"AP8=","price":12.50},` + "\n" +
+				`{"id":2,"name":null,"data":null,"price":null},` + "\n" +
+				`{"id":3,"name":"line\nbreak\\","data":"","price":-0.5},` + "\n" +
+				`{"id":4,"name":"Yf8=","data":"eA==","price":0.25}` + "\n" +
+				"]\n"},
+		{FormatNDJSON, ResultOptions{},
+			`{"id":1,"name":"say \"hi\", ok","data":"AP8=","price":12.50}` + "\n" +
+				`{"id":2,"name":null,"data":null,"price":null}` + "\n" +
+				`{"id":3,"name":"line\nbreak\\","data":"","price":-0.5}` + "\n" +
+				`{"id":4,"name":"Yf8=","data":"eA==","price":0.25}` + "\n"},
+		{FormatSQL, ResultOptions{TableName: "my items", BatchSize: 2},
+			"INSERT INTO `my items` (`id`, `name`, `data`, `price`) VALUES\n" +
+				`(1, 'say \"hi\", ok', 0x00ff, 12.50),` + "\n" +
+				"(2, NULL, NULL, NULL);\n" +
+				"INSERT INTO `my items` (`id`, `name`, `data`, `price`) VALUES\n" +
+				`(3, 'line\nbreak\\', '', -0.5),` + "\n" +
+				"(4, _binary 0x61ff, 0x78, 0.25);\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			opts := tt.opts
+			opts.Format = tt.format
+			var out strings.Builder
+			count, err := WriteResults(&out, testResultSource(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 4 {
+				t.Errorf("wrote %d rows, want 4", count)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("wrote\n%q\nwant\n%q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteResultsEmpty(t *testing.T) {
+	for format, want := range map[string]string{
+		FormatCSV:    "id\r\n",
+		FormatTSV:    "id\n",
+		FormatJSON:   "[\n]\n",
+		FormatNDJSON: "",
+		FormatSQL:    "",
+	} {
+		var out strings.Builder
+		src := &SliceSource{Cols: []string{"id"}, Typs: []string{"INT"}}
+		if _, err := WriteResults(&out, src, ResultOptions{Format: format, TableName: "t"}); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if out.String() != want {
+			t.Errorf("%s: wrote %q for no rows, want %q", format, out.String(), want)
+		}
+	}
+}
+
+func TestWriteResultsTSVMasking(t *testing.T) {
+	mask, err := NewMasker(MaskConfig{Rules: []MaskRule{{Column: "*.pass\\word", Mask: MaskFixed, Value: "hidden"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &SliceSource{
+		Cols: []string{"id", "pass\\word", "note\tx"},
+		Typs: []string{"INT", "VARCHAR", "VARCHAR"},
+		Rows: [][]interface{}{
+			{[]byte("1"), []byte("s3cret"), []byte("a\tb\nc\\d")},
+			{[]byte("2"), nil, nil},
+			{[]byte("3"), []byte("x"), []byte(`\N`)},
+		},
+	}
+	var out strings.Builder
+	count, err := WriteResults(&out, src, ResultOptions{Format: FormatTSV, Mask: mask})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id\tpass\\\\word\tnote\\tx\n" +
+		"1\thidden\ta\\tb\\nc\\\\d\n" +
+		"2\t\\N\t\\N\n" +
+		"3\thidden\t\\\\N\n"
+	if count != 3 || out.String() != want {
+		t.Fatalf("wrote %d rows:\n%q\nwant 3 rows:\n%q", count, out.String(), want)
+	}
+	if cols := []string{"id", "pass\\word", "note\tx"}; !reflect.DeepEqual(src.Cols, cols) {
+		t.Fatalf("column names changed to %q", src.Cols)
+	}
+}
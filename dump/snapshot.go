@@ -0,0 +1,159 @@
+package dump
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Connections that all read the same point in time, and where that point is in the binlog
+type exportSnapshot struct {
+	Conns        []*sql.Conn
+	Connections  int  // number of connections that shared the snapshot
+	Locked       bool // FLUSH TABLES WITH READ LOCK was used to line the connections up
+	BinlogFile   string
+	BinlogPos    string
+	GTIDExecuted string
+}
+
+// Open a consistent snapshot on up to workers connections.
+// With the RELOAD privilege every connection starts its transaction under a brief global read lock, so all
+// of them see the same data; without it a single connection with its own snapshot is used instead.
+func beginSnapshot(ctx context.Context, db *sql.DB, workers int) (*exportSnapshot, error) {
+	snap := &exportSnapshot{}
+
+	first, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snap.Conns = append(snap.Conns, first)
+
+	if _, err := first.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err == nil {
+		snap.Locked = true
+		for len(snap.Conns) < workers {
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				break
+			}
+			snap.Conns = append(snap.Conns, conn)
+		}
+	}
+
+	for _, conn := range snap.Conns {
+		if err := startSnapshotTransaction(ctx, conn, false); err != nil {
+			if snap.Locked {
+				first.ExecContext(ctx, "UNLOCK TABLES")
+			}
+			snap.close()
+			return nil, err
+		}
+	}
+
+	snap.Connections = len(snap.Conns)
+
+	// While the lock is held nothing can commit, so this is exactly the position the snapshot shows
+	snap.readBinlogPosition(ctx, first)
+
+	if snap.Locked {
+		if _, err := first.ExecContext(ctx, "UNLOCK TABLES"); err != nil {
+			snap.close()
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+// Start a transaction that reads one point in time on conn; readOnly also refuses writes in it
+func startSnapshotTransaction(ctx context.Context, conn *sql.Conn, readOnly bool) error {
+	if _, err := conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return err
+	}
+	start := "START TRANSACTION WITH CONSISTENT SNAPSHOT"
+	if readOnly {
+		start += ", READ ONLY"
+	}
+	_, err := conn.ExecContext(ctx, start)
+	return err
+}
+
+// Best effort: servers without binary logging, or users without the privilege, leave the fields empty
+func (s *exportSnapshot) readBinlogPosition(ctx context.Context, conn *sql.Conn) {
+	for _, query := range []string{"SHOW BINARY LOG STATUS", "SHOW MASTER STATUS"} {
+		status, err := queryFirstRow(ctx, conn, query)
+		if err != nil {
+			continue
+		}
+		s.BinlogFile = status["File"]
+		s.BinlogPos = status["Position"]
+		s.GTIDExecuted = status["Executed_Gtid_Set"]
+		break
+	}
+	if s.GTIDExecuted == "" {
+		var gtid sql.NullString
+		if err := conn.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed").Scan(&gtid); err == nil {
+			s.GTIDExecuted = gtid.String
+		}
+	}
+}
+
+// First row of a result as column name -> value
+func queryFirstRow(ctx context.Context, q Querier, query string) (map[string]string, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	if !rows.Next() {
+		return result, rows.Err()
+	}
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	for i, col := range cols {
+		result[col] = values[i].String
+	}
+	return result, nil
+}
+
+// End the snapshot transactions and return the connections to the pool
+func (s *exportSnapshot) close() {
+	for _, conn := range s.Conns {
+		conn.ExecContext(context.Background(), "COMMIT")
+		conn.Close()
+	}
+	s.Conns = nil
+}
+
+// Comment lines for the dump header, in the form mysqldump --master-data=2 uses
+func (s *exportSnapshot) headerLines() string {
+	var b strings.Builder
+	if s.Locked {
+		b.WriteString(fmt.Sprintf("-- Consistent snapshot: %d connection(s), lined up with FLUSH TABLES WITH READ LOCK\n", s.Connections))
+	} else {
+		b.WriteString("-- Consistent snapshot: single connection (no RELOAD privilege for FLUSH TABLES WITH READ LOCK)\n")
+	}
+	if s.BinlogFile != "" {
+		b.WriteString("--\n-- Position to start replication or point-in-time recovery from\n--\n\n")
+		if !s.Locked {
+			b.WriteString("-- (read without a lock, so it may be slightly past the snapshot)\n")
+		}
+		b.WriteString(fmt.Sprintf("-- CHANGE MASTER TO MASTER_LOG_FILE='%s', MASTER_LOG_POS=%s;\n", s.BinlogFile, s.BinlogPos))
+	}
+	if s.GTIDExecuted != "" {
+		gtid := strings.ReplaceAll(s.GTIDExecuted, "\n", "")
+		b.WriteString(fmt.Sprintf("-- SET @@GLOBAL.GTID_PURGED='%s';\n", gtid))
+	}
+	return b.String()
+}
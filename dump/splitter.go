@@ -0,0 +1,202 @@
+package dump
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// States of the splitter between characters
+const (
+	scanCode = iota
+	scanSingleQuote
+	scanDoubleQuote
+	scanBacktick
+	scanComment     // /* ... */, dropped
+	scanExecComment // /*! ... */ or /*+ ... */, kept because MySQL runs it
+)
+
+// StatementScanner reads SQL statements one at a time the way the mysql client does:
+// it honours DELIMITER commands, quotes and comments, and drops plain comments.
+type StatementScanner struct {
+	r       *bufio.Reader
+	delim   string
+	state   int
+	pending string // rest of the current line after the last statement
+	buf     strings.Builder
+	stmt    string
+	line    int // line being read
+	start   int // line the statement being built started on
+	started bool
+	stmtAt  int
+	err     error
+	eof     bool
+}
+
+// NewStatementScanner splits r into statements, starting with ";" as the delimiter
+func NewStatementScanner(r io.Reader) *StatementScanner {
+	return &StatementScanner{r: bufio.NewReaderSize(r, 1<<16), delim: ";"}
+}
+
+// Next advances to the next statement; it returns false at the end of input or on a read error
+func (s *StatementScanner) Next() bool {
+	for {
+		if s.pending == "" {
+			if s.eof {
+				return s.finish()
+			}
+			line, err := s.r.ReadString('\n')
+			if err == io.EOF {
+				s.eof = true
+			} else if err != nil {
+				s.err = err
+				return false
+			}
+			if line == "" {
+				continue
+			}
+			s.line++
+
+			// DELIMITER is a client command, only recognised between statements
+			if s.state == scanCode && strings.TrimSpace(s.buf.String()) == "" {
+				if delim, ok := parseDelimiter(line); ok {
+					s.delim = delim
+					s.buf.Reset()
+					continue
+				}
+			}
+			s.pending = line
+		}
+
+		if s.scan() {
+			return true
+		}
+	}
+}
+
+// Scan the pending text; true when a statement has been completed
+func (s *StatementScanner) scan() bool {
+	text := s.pending
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		switch s.state {
+		case scanCode:
+			switch {
+			case strings.HasPrefix(text[i:], s.delim):
+				s.pending = text[i+len(s.delim):]
+				if s.emit() {
+					return true
+				}
+				text = s.pending
+				i = -1
+				continue
+			case c == '\'':
+				s.state = scanSingleQuote
+			case c == '"':
+				s.state = scanDoubleQuote
+			case c == '`':
+				s.state = scanBacktick
+			case c == '#' || (c == '-' && strings.HasPrefix(text[i:], "--") && (i+2 == len(text) || isSpace(text[i+2]))):
+				// Line comment: keep only the line break
+				s.buf.WriteByte('\n')
+				s.pending = ""
+				return false
+			case c == '/' && strings.HasPrefix(text[i:], "/*"):
+				if i+2 < len(text) && (text[i+2] == '!' || text[i+2] == '+') {
+					s.state = scanExecComment
+					s.markStart()
+					s.buf.WriteString("/*")
+					i++
+					continue
+				}
+				s.state = scanComment
+				s.buf.WriteByte(' ')
+				i++
+				continue
+			}
+			if !isSpace(c) {
+				s.markStart()
+			}
+			s.buf.WriteByte(c)
+		case scanSingleQuote, scanDoubleQuote, scanBacktick:
+			s.buf.WriteByte(c)
+			if c == '\\' && s.state != scanBacktick && i+1 < len(text) {
+				i++
+				s.buf.WriteByte(text[i])
+				continue
+			}
+			if (c == '\'' && s.state == scanSingleQuote) ||
+				(c == '"' && s.state == scanDoubleQuote) ||
+				(c == '`' && s.state == scanBacktick) {
+				s.state = scanCode
+			}
+		case scanComment, scanExecComment:
+			if c == '*' && i+1 < len(text) && text[i+1] == '/' {
+				if s.state == scanExecComment {
+					s.buf.WriteString("*/")
+				}
+				s.state = scanCode
+				i++
+				continue
+			}
+			if s.state == scanExecComment {
+				s.buf.WriteByte(c)
+			}
+		}
+	}
+	s.pending = ""
+	return false
+}
+
+func (s *StatementScanner) markStart() {
+	if !s.started {
+		s.started = true
+		s.start = s.line
+	}
+}
+
+// Take the buffered text as a statement unless it is blank
+func (s *StatementScanner) emit() bool {
+	stmt := strings.TrimSpace(s.buf.String())
+	s.buf.Reset()
+	s.started = false
+	if stmt == "" {
+		return false
+	}
+	s.stmt = stmt
+	s.stmtAt = s.start
+	return true
+}
+
+func (s *StatementScanner) finish() bool {
+	s.state = scanCode
+	return s.emit()
+}
+
+// Statement is the statement found by the last call to Next, without its delimiter
+func (s *StatementScanner) Statement() string {
+	return s.stmt
+}
+
+// Line is the line number the current statement starts on
+func (s *StatementScanner) Line() int {
+	return s.stmtAt
+}
+
+// Err is the read error that stopped the scanner, if any
+func (s *StatementScanner) Err() error {
+	return s.err
+}
+
+func parseDelimiter(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "DELIMITER") {
+		return "", false
+	}
+	return fields[1], true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,181 @@
+package dump
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatementScanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		lines []int
+	}{
+		{
+			name:  "plain",
+			input: "SELECT 1;\nSELECT 2;\n",
+			want:  []string{"SELECT 1", "SELECT 2"},
+			lines: []int{1, 2},
+		},
+		{
+			name:  "several on a line",
+			input: "SELECT 1; SELECT 2;SELECT 3;",
+			want:  []string{"SELECT 1", "SELECT 2", "SELECT 3"},
+			lines: []int{1, 1, 1},
+		},
+		{
+			name:  "trailing statement without a delimiter",
+			input: "SELECT 1;\nSELECT 2\n",
+			want:  []string{"SELECT 1", "SELECT 2"},
+			lines: []int{1, 2},
+		},
+		{
+			name:  "trailing statement without a newline",
+			input: "SELECT 1;\nSELECT 2",
+			want:  []string{"SELECT 1", "SELECT 2"},
+			lines: []int{1, 2},
+		},
+		{
+			name:  "blank statements are skipped",
+			input: ";;\n  ;\n\nSELECT 1;\n\n",
+			want:  []string{"SELECT 1"},
+			lines: []int{4},
+		},
+		{
+			name:  "crlf",
+			input: "SELECT 1;\r\nSELECT\r\n 2;\r\n",
+			want:  []string{"SELECT 1", "SELECT\r\n 2"},
+			lines: []int{1, 2},
+		},
+		{
+			name: "delimiter //",
+			input: "DELIMITER //\n" +
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND//\n" +
+				"DELIMITER ;\n" +
+				"CALL p();\n",
+			want:  []string{"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND", "CALL p()"},
+			lines: []int{2, 8},
+		},
+		{
+			name: "delimiter $$",
+			input: "delimiter $$\n" +
+				"CREATE TRIGGER t BEFORE INSERT ON x FOR EACH ROW BEGIN SET NEW.a = 1; END $$\n" +
+				"SELECT '$$' $$\n" +
+				"delimiter ;\n",
+			want:  []string{"CREATE TRIGGER t BEFORE INSERT ON x FOR EACH ROW BEGIN SET NEW.a = 1; END", "SELECT '$$'"},
+			lines: []int{2, 3},
+		},
+		{
+			name:  "DELIMITER inside a statement is not a command",
+			input: "SELECT 1\nDELIMITER //\n;",
+			want:  []string{"SELECT 1\nDELIMITER //"},
+			lines: []int{1},
+		},
+		{
+			name:  "delimiter inside quotes and backticks",
+			input: "SELECT 'a;b', \"c;d\", `e;f` FROM t;",
+			want:  []string{"SELECT 'a;b', \"c;d\", `e;f` FROM t"},
+			lines: []int{1},
+		},
+		{
+			name:  "multi-line string",
+			input: "INSERT INTO t VALUES ('a;\nb;\n');\nSELECT 1;",
+			want:  []string{"INSERT INTO t VALUES ('a;\nb;\n')", "SELECT 1"},
+			lines: []int{1, 4},
+		},
+		{
+			name:  "escaped quotes",
+			input: `SELECT 'it\'s;', "say \"hi;\"", 'a\\';` + "\nSELECT 2;",
+			want:  []string{`SELECT 'it\'s;', "say \"hi;\"", 'a\\'`, "SELECT 2"},
+			lines: []int{1, 2},
+		},
+		{
+			name:  "doubled quotes",
+			input: "SELECT 'it''s;', \"a\"\";b\";",
+			want:  []string{"SELECT 'it''s;', \"a\"\";b\""},
+			lines: []int{1},
+		},
+		{
+			name:  "backslash does not escape a backtick",
+			input: "SELECT `a\\`;SELECT 2;",
+			want:  []string{"SELECT `a\\`", "SELECT 2"},
+			lines: []int{1, 1},
+		},
+		{
+			name:  "line comments",
+			input: "-- header; comment\nSELECT 1 -- not; here\n, 2; # also; here\n#only\nSELECT 3;",
+			want:  []string{"SELECT 1 \n, 2", "SELECT 3"},
+			lines: []int{2, 5},
+		},
+		{
+			name:  "double dash without a space is an operator",
+			input: "SELECT 1--1;\nSELECT 2 --\n;",
+			want:  []string{"SELECT 1--1", "SELECT 2"},
+			lines: []int{1, 2},
+		},
+		{
+			name:  "block comments are dropped",
+			input: "/* header;\n   more; */\nSELECT /* a; b */ 3;",
+			want:  []string{"SELECT   3"},
+			lines: []int{3},
+		},
+		{
+			name:  "comment markers inside quotes",
+			input: "SELECT '-- x;', '# y;', '/* z; */';",
+			want:  []string{"SELECT '-- x;', '# y;', '/* z; */'"},
+			lines: []int{1},
+		},
+		{
+			name:  "delimiter comment inside a routine",
+			input: "DELIMITER //\nBEGIN -- done//\nEND /* // */ //\n",
+			want:  []string{"BEGIN \nEND"},
+			lines: []int{2},
+		},
+		{
+			name: "version comments are kept",
+			input: "/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n" +
+				"/*!50003 CREATE*/ /*!50017 DEFINER=`root`@`%`*/ /*!50003 TRIGGER t BEFORE INSERT ON x FOR EACH ROW SET NEW.a = ';' */;\n" +
+				"SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1;",
+			want: []string{
+				"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */",
+				"/*!50003 CREATE*/ /*!50017 DEFINER=`root`@`%`*/ /*!50003 TRIGGER t BEFORE INSERT ON x FOR EACH ROW SET NEW.a = ';' */",
+				"SELECT /*+ MAX_EXECUTION_TIME(1000) */ 1",
+			},
+			lines: []int{1, 2, 3},
+		},
+		{
+			name:  "multi-line version comment",
+			input: "/*!50001 CREATE VIEW v AS\nSELECT 1; */;",
+			want:  []string{"/*!50001 CREATE VIEW v AS\nSELECT 1; */"},
+			lines: []int{1},
+		},
+		{
+			name:  "only comments",
+			input: "-- nothing\n/* here */\n# at all\n",
+			want:  nil,
+			lines: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStatementScanner(strings.NewReader(tt.input))
+			var got []string
+			var lines []int
+			for s.Next() {
+				got = append(got, s.Statement())
+				lines = append(lines, s.Line())
+			}
+			if err := s.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("statements = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Fatalf("lines = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,509 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Key tuples per lookup query
+const subsetLookupBatch = 500
+
+// SubsetOptions controls WriteSubset
+type SubsetOptions struct {
+	Database  string  // schema of the tables
+	Table     string  // table the subset starts from
+	Where     string  // condition selecting the starting rows, without the WHERE keyword; empty takes them all
+	Limit     int     // at most this many starting rows, in primary key order; 0 means no limit
+	Children  bool    // also follow foreign keys downwards, to the rows that reference the selected ones
+	Depth     int     // levels of referencing rows followed from the starting rows; 0 means no limit
+	Schema    bool    // write CREATE TABLE for every table in the subset
+	DropTable bool    // precede it with DROP TABLE IF EXISTS
+	BatchSize int     // rows per INSERT; 0 means 1000
+	MaxRows   int     // give up when the subset grows past this many rows; 0 means no limit
+	Mask      *Masker // masks the rows written; nil writes them as they are
+}
+
+// SubsetTable is the number of rows a subset holds of one table
+type SubsetTable struct {
+	Name string
+	Rows int
+}
+
+// A foreign key within one schema
+type foreignKey struct {
+	Table      string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// Rows of one table collected so far
+type subsetRows struct {
+	columns []string
+	types   []*sql.ColumnType
+	index   map[string]int // column name -> position
+	key     []int          // positions of the primary key, or of every column without one
+	down    map[string]bool
+	rows    [][]string // SQL literals, in the order found
+	masks   []*MaskRule
+	written [][]string // rows as written, masked; nil when no column is masked
+}
+
+// Rows whose foreign keys are still to be followed
+type subsetStep struct {
+	table string
+	rows  [][]string
+	depth int  // referencing levels away from the starting rows
+	down  bool // reached from the start going downwards, so their referencing rows may be followed too
+}
+
+type subsetWalk struct {
+	q          Querier
+	opts       SubsetOptions
+	tables     map[string]*subsetRows
+	order      []string // tables in the order first reached
+	total      int
+	onProgress func(SubsetTable)
+}
+
+// WriteSubset writes a dependency-ordered INSERT script holding the rows of opts.Table matching opts.Where,
+// every row they reference through foreign keys, transitively, and with opts.Children the rows that reference
+// them, down to opts.Depth levels, along with what those rows reference in turn. When q reads one snapshot,
+// as in ExportSubset, every row in the script finds the rows it references in the script, so it loads with
+// foreign key checks on.
+// onProgress, when not nil, is called as rows are added. It returns the tables in script order.
+func WriteSubset(ctx context.Context, q Querier, w io.Writer, opts SubsetOptions, onProgress func(SubsetTable)) ([]SubsetTable, error) {
+	walk := &subsetWalk{q: q, opts: opts, tables: map[string]*subsetRows{}, onProgress: onProgress}
+
+	fks, err := foreignKeys(ctx, q, opts.Database)
+	if err != nil {
+		return nil, fmt.Errorf("read foreign keys: %w", err)
+	}
+
+	start, err := walk.startRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	queue := []subsetStep{{table: opts.Table, rows: start, down: true}}
+	for len(queue) > 0 {
+		step := queue[0]
+		queue = queue[1:]
+		if len(step.rows) == 0 {
+			continue
+		}
+		from := walk.tables[step.table]
+
+		for _, fk := range fks {
+			if fk.Table == step.table {
+				// Referenced rows are always taken, however far away, so nothing in the script dangles
+				found, err := walk.lookup(ctx, fk.RefTable, fk.RefColumns, from.values(step.rows, fk.Columns), false)
+				if err != nil {
+					return nil, err
+				}
+				queue = append(queue, subsetStep{table: fk.RefTable, rows: found, depth: step.depth})
+			}
+			if fk.RefTable == step.table && opts.Children && step.down && (opts.Depth == 0 || step.depth < opts.Depth) {
+				found, err := walk.lookup(ctx, fk.Table, fk.Columns, from.values(step.rows, fk.RefColumns), true)
+				if err != nil {
+					return nil, err
+				}
+				queue = append(queue, subsetStep{table: fk.Table, rows: found, depth: step.depth + 1, down: true})
+			}
+		}
+	}
+
+	// Parents first; a table referencing itself relies on the disabled foreign key checks of the header
+	deps := map[string][]string{}
+	for _, fk := range fks {
+		if fk.Table != fk.RefTable {
+			deps[fk.Table] = append(deps[fk.Table], fk.RefTable)
+		}
+	}
+	order := SortByDependencies(walk.order, deps)
+	return walk.write(ctx, w, order)
+}
+
+// ExportSubset writes the subset script to path, gzip-compressed with compress. A failed export leaves no file behind.
+// The whole walk reads one read-only snapshot, so rows changed while it runs cannot leave a reference dangling.
+func ExportSubset(ctx context.Context, db *sql.DB, path string, compress bool, opts SubsetOptions, onProgress func(SubsetTable)) ([]SubsetTable, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := startSnapshotTransaction(ctx, conn, true); err != nil {
+		return nil, fmt.Errorf("start snapshot: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	var tables []SubsetTable
+	err = writeExportFile(path, compress, func(w *bufio.Writer) error {
+		var err error
+		tables, err = WriteSubset(ctx, conn, w, opts, onProgress)
+		return err
+	})
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return tables, nil
+}
+
+// Foreign keys between tables of a schema, with their columns in key order
+func foreignKeys(ctx context.Context, q Querier, database string) ([]foreignKey, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT TABLE_NAME, CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = ?
+		  AND REFERENCED_TABLE_SCHEMA = ?
+		  AND REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION
+	`, database, database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []foreignKey
+	var lastTable, lastConstraint string
+	for rows.Next() {
+		var table, constraint, column, refTable, refColumn string
+		if err := rows.Scan(&table, &constraint, &column, &refTable, &refColumn); err != nil {
+			return nil, err
+		}
+		if len(fks) == 0 || table != lastTable || constraint != lastConstraint {
+			fks = append(fks, foreignKey{Table: table, RefTable: refTable})
+			lastTable, lastConstraint = table, constraint
+		}
+		fk := &fks[len(fks)-1]
+		fk.Columns = append(fk.Columns, column)
+		fk.RefColumns = append(fk.RefColumns, refColumn)
+	}
+	return fks, rows.Err()
+}
+
+// Rows of the starting table matching Where, up to Limit
+func (s *subsetWalk) startRows(ctx context.Context) ([][]string, error) {
+	keys, err := PrimaryKeyColumns(ctx, s.q, s.opts.Database, s.opts.Table)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT * FROM " + QuoteIdent(s.opts.Database) + "." + QuoteIdent(s.opts.Table)
+	if where := strings.TrimSpace(s.opts.Where); where != "" {
+		query += " WHERE " + where
+	}
+	if s.opts.Limit > 0 {
+		if len(keys) > 0 {
+			quoted := make([]string, len(keys))
+			for i, col := range keys {
+				quoted[i] = QuoteIdent(col)
+			}
+			query += " ORDER BY " + strings.Join(quoted, ", ")
+		}
+		query += fmt.Sprintf(" LIMIT %d", s.opts.Limit)
+	}
+	return s.fetch(ctx, s.opts.Table, query, true)
+}
+
+// Rows of table whose columns hold one of the tuples. It returns the rows to follow further: new ones, and with
+// down those found before only as referenced rows, whose referencing rows have not been looked at yet.
+func (s *subsetWalk) lookup(ctx context.Context, table string, columns []string, tuples [][]string, down bool) ([][]string, error) {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = QuoteIdent(col)
+	}
+	var found [][]string
+	for len(tuples) > 0 {
+		batch := tuples[:min(len(tuples), subsetLookupBatch)]
+		tuples = tuples[len(batch):]
+
+		list := make([]string, len(batch))
+		for i, tuple := range batch {
+			list[i] = keyTuple(tuple)
+		}
+		query := fmt.Sprintf("SELECT * FROM %s.%s WHERE %s IN (%s)", QuoteIdent(s.opts.Database), QuoteIdent(table),
+			keyTuple(quoted), strings.Join(list, ", "))
+		rows, err := s.fetch(ctx, table, query, down)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, rows...)
+	}
+	return found, nil
+}
+
+// Run a query on table and add the rows not yet in the subset
+func (s *subsetWalk) fetch(ctx context.Context, table, query string, down bool) ([][]string, error) {
+	t, err := s.table(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", table, err)
+	}
+	defer rows.Close()
+
+	if t.columns == nil {
+		if t.columns, err = rows.Columns(); err != nil {
+			return nil, err
+		}
+		t.types, _ = rows.ColumnTypes()
+		for i, col := range t.columns {
+			t.index[col] = i
+		}
+		if len(t.key) == 0 {
+			for i := range t.columns {
+				t.key = append(t.key, i)
+			}
+		}
+		t.masks = s.opts.Mask.Columns(table, t.columns)
+	}
+
+	values := make([]interface{}, len(t.columns))
+	ptrs := make([]interface{}, len(t.columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	var found [][]string
+	added := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		row := make([]string, len(values))
+		for i, val := range values {
+			var colType *sql.ColumnType
+			if i < len(t.types) {
+				colType = t.types[i]
+			}
+			row[i] = Literal(val, colType)
+		}
+		keyParts := make([]string, len(t.key))
+		for i, pos := range t.key {
+			keyParts[i] = row[pos]
+		}
+		id := strings.Join(keyParts, "\x00")
+
+		wasDown, seen := t.down[id]
+		switch {
+		case !seen:
+			t.down[id] = down
+			t.rows = append(t.rows, row)
+			if t.masks != nil {
+				t.written = append(t.written, s.maskedRow(t, values, row))
+			}
+			found = append(found, row)
+			added++
+		case down && !wasDown:
+			t.down[id] = true
+			found = append(found, row)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", table, err)
+	}
+
+	if added > 0 {
+		s.total += added
+		if s.opts.MaxRows > 0 && s.total > s.opts.MaxRows {
+			return nil, fmt.Errorf("the subset has grown past %d rows; narrow the starting rows or follow fewer levels", s.opts.MaxRows)
+		}
+		if s.onProgress != nil {
+			s.onProgress(SubsetTable{Name: table, Rows: len(t.rows)})
+		}
+	}
+	return found, nil
+}
+
+// Literals of a row with its masked columns replaced; lookups keep using the real values
+func (s *subsetWalk) maskedRow(t *subsetRows, values []interface{}, row []string) []string {
+	written := make([]string, len(row))
+	for i, val := range s.opts.Mask.RowForColumns(t.masks, values, t.types) {
+		written[i] = row[i]
+		if t.masks[i] != nil {
+			var colType *sql.ColumnType
+			if i < len(t.types) {
+				colType = t.types[i]
+			}
+			written[i] = Literal(val, colType)
+		}
+	}
+	return written
+}
+
+// Collected rows of a table, set up with its primary key on first use
+func (s *subsetWalk) table(ctx context.Context, table string) (*subsetRows, error) {
+	if t, ok := s.tables[table]; ok {
+		return t, nil
+	}
+	keys, err := PrimaryKeyColumns(ctx, s.q, s.opts.Database, table)
+	if err != nil {
+		return nil, err
+	}
+	t := &subsetRows{index: map[string]int{}, down: map[string]bool{}}
+	s.tables[table] = t
+	s.order = append(s.order, table)
+
+	// Key positions are filled in once the columns are known
+	if len(keys) > 0 {
+		rows, err := s.q.QueryContext(ctx, "SELECT * FROM "+QuoteIdent(s.opts.Database)+"."+QuoteIdent(table)+" LIMIT 0")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		columns, err := rows.Columns()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			for i, col := range columns {
+				if col == key {
+					t.key = append(t.key, i)
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// The script: header, then per table its optional CREATE TABLE and its rows as batched INSERTs
+func (s *subsetWalk) write(ctx context.Context, w io.Writer, order []string) ([]SubsetTable, error) {
+	var b strings.Builder
+	b.WriteString("-- Pheri SQL subset\n")
+	b.WriteString(fmt.Sprintf("-- Database: %s\n", s.opts.Database))
+	start := "-- Starting rows: " + s.opts.Table
+	if where := strings.TrimSpace(s.opts.Where); where != "" {
+		start += " WHERE " + strings.ReplaceAll(where, "\n", " ")
+	}
+	if s.opts.Limit > 0 {
+		start += fmt.Sprintf(" LIMIT %d", s.opts.Limit)
+	}
+	b.WriteString(start + "\n")
+	switch {
+	case !s.opts.Children:
+		b.WriteString("-- Followed: referenced rows\n")
+	case s.opts.Depth > 0:
+		b.WriteString(fmt.Sprintf("-- Followed: referenced rows, referencing rows up to %d level(s)\n", s.opts.Depth))
+	default:
+		b.WriteString("-- Followed: referenced rows, all referencing rows\n")
+	}
+	b.WriteString(fmt.Sprintf("-- Generated: %s\n", time.Now().Format(time.RFC3339)))
+	b.WriteString("-- ------------------------------------------------------\n\n")
+	b.WriteString(sessionHeader())
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return nil, err
+	}
+
+	batchSize := s.opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	var tables []SubsetTable
+	for _, name := range order {
+		t := s.tables[name]
+		if len(t.rows) == 0 && !s.opts.Schema {
+			continue
+		}
+		tables = append(tables, SubsetTable{Name: name, Rows: len(t.rows)})
+
+		var out strings.Builder
+		out.WriteString("-- ----------------------------\n")
+		out.WriteString(fmt.Sprintf("-- TABLE: %s (%d rows)\n", name, len(t.rows)))
+		out.WriteString("-- ----------------------------\n")
+		if s.opts.Schema {
+			var table, createStmt string
+			err := s.q.QueryRowContext(ctx, "SHOW CREATE TABLE "+QuoteIdent(s.opts.Database)+"."+QuoteIdent(name)).Scan(&table, &createStmt)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if s.opts.DropTable {
+				out.WriteString(fmt.Sprintf("DROP TABLE IF EXISTS %s;\n", QuoteIdent(name)))
+			}
+			out.WriteString(createStmt + ";\n\n")
+		}
+		if _, err := io.WriteString(w, out.String()); err != nil {
+			return nil, err
+		}
+		rows := t.rows
+		if t.masks != nil {
+			rows = t.written
+		}
+		if err := writeInserts(w, name, t.columns, rows, batchSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := io.WriteString(w, dumpFooter()); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// Rows of SQL literals as multi-row INSERTs of up to batchSize rows, split early past maxStatementBytes
+func writeInserts(w io.Writer, table string, columns []string, rows [][]string, batchSize int) error {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = QuoteIdent(col)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", QuoteIdent(table), strings.Join(quoted, ", "))
+
+	var batch []string
+	batchBytes := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := io.WriteString(w, prefix+strings.Join(batch, ",\n")+";\n\n")
+		batch = batch[:0]
+		batchBytes = 0
+		return err
+	}
+	for _, row := range rows {
+		tuple := "(" + strings.Join(row, ", ") + ")"
+		if len(batch) > 0 && batchBytes+len(tuple) > maxStatementBytes {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, tuple)
+		batchBytes += len(tuple)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// Distinct values of some columns over rows, as key tuples; tuples with a NULL reference nothing
+func (t *subsetRows) values(rows [][]string, columns []string) [][]string {
+	positions := make([]int, len(columns))
+	for i, col := range columns {
+		positions[i] = t.index[col]
+	}
+	seen := map[string]bool{}
+	var tuples [][]string
+	for _, row := range rows {
+		tuple := make([]string, len(positions))
+		hasNull := false
+		for i, pos := range positions {
+			tuple[i] = row[pos]
+			hasNull = hasNull || tuple[i] == "NULL"
+		}
+		id := strings.Join(tuple, "\x00")
+		if hasNull || seen[id] {
+			continue
+		}
+		seen[id] = true
+		tuples = append(tuples, tuple)
+	}
+	return tuples
+}
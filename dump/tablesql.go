@@ -0,0 +1,412 @@
+package dump
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Keep each INSERT well below the default max_allowed_packet
+const maxStatementBytes = 4 << 20
+
+// Querier runs queries for WriteTableSQL: a *sql.DB, *sql.Conn or *sql.Tx
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// TableSQLOptions controls WriteTableSQL
+type TableSQLOptions struct {
+	Database  string      // schema the table is read from; empty uses the connection's default
+	Schema    bool        // write the CREATE TABLE statement
+	DropTable bool        // precede it with DROP TABLE IF EXISTS
+	Data      bool        // write the rows as INSERT statements
+	Where     string      // condition selecting the rows, without the WHERE keyword
+	Limit     int         // maximum number of rows; 0 writes every row
+	BatchSize int         // rows per INSERT; 0 means 1000
+	OnRows    func(n int) // called after every INSERT with the number of rows it held
+	Mask      *Masker     // masks the rows written; nil writes them as they are
+}
+
+// KeyRange selects rows by primary key, in key order
+type KeyRange struct {
+	Columns []string // key columns; empty reads the rows in no particular order
+	After   []string // SQL literals of a key; only rows after it are read. nil starts at the first row
+	Upto    []string // SQL literals of the last key to read; nil reads to the end
+	Limit   int      // maximum number of rows; 0 falls back to TableSQLOptions.Limit
+}
+
+// PrimaryKeyColumns lists the primary key columns of a table in key order; empty when it has none.
+// An empty database means the connection's default.
+func PrimaryKeyColumns(ctx context.Context, q Querier, database, table string) ([]string, error) {
+	schema := "DATABASE()"
+	args := []interface{}{table}
+	if database != "" {
+		schema = "?"
+		args = []interface{}{database, table}
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT COLUMN_NAME
+		FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = `+schema+`
+		  AND TABLE_NAME = ?
+		  AND CONSTRAINT_NAME = 'PRIMARY'
+		ORDER BY ORDINAL_POSITION
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// WriteTableSQL writes a table's definition and rows as SQL that recreates it, reading the rows as a stream.
+// Rows are batched into multi-row INSERTs, split early when a statement would grow past 4 MiB.
+// It returns the number of rows written.
+func WriteTableSQL(ctx context.Context, q Querier, w io.Writer, table string, opts TableSQLOptions) (int, error) {
+	var name, createStmt string
+	if err := q.QueryRowContext(ctx, "SHOW CREATE TABLE "+tableSource(table, opts)).Scan(&name, &createStmt); err != nil {
+		return 0, err
+	}
+
+	var out strings.Builder
+	out.WriteString("-- ----------------------------\n")
+	out.WriteString(fmt.Sprintf("-- TABLE: %s\n", table))
+	out.WriteString("-- ----------------------------\n")
+	if opts.Schema {
+		if opts.DropTable {
+			out.WriteString(fmt.Sprintf("DROP TABLE IF EXISTS %s;\n", QuoteIdent(table)))
+		}
+		out.WriteString(createStmt + ";\n\n")
+	}
+	if opts.Data {
+		out.WriteString("-- DATA\n")
+	}
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return 0, err
+	}
+	if !opts.Data {
+		return 0, nil
+	}
+
+	count, _, err := WriteTableRange(ctx, q, w, table, KeyRange{}, opts)
+	return count, err
+}
+
+func tableSource(table string, opts TableSQLOptions) string {
+	if opts.Database != "" {
+		return QuoteIdent(opts.Database) + "." + QuoteIdent(table)
+	}
+	return QuoteIdent(table)
+}
+
+// WriteTableRange writes the rows of a key range as batched INSERTs, without any DDL.
+// It returns the number of rows written and the key of the last one as SQL literals, for the next range's After.
+func WriteTableRange(ctx context.Context, q Querier, w io.Writer, table string, r KeyRange, opts TableSQLOptions) (int, []string, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	var conditions []string
+	if where := strings.TrimSpace(opts.Where); where != "" {
+		conditions = append(conditions, "("+where+")")
+	}
+	keyList := make([]string, len(r.Columns))
+	for i, col := range r.Columns {
+		keyList[i] = QuoteIdent(col)
+	}
+	if len(r.After) > 0 {
+		conditions = append(conditions, keyTuple(keyList)+" > "+keyTuple(r.After))
+	}
+	if len(r.Upto) > 0 {
+		conditions = append(conditions, keyTuple(keyList)+" <= "+keyTuple(r.Upto))
+	}
+
+	query := "SELECT * FROM " + tableSource(table, opts)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(keyList) > 0 {
+		query += " ORDER BY " + strings.Join(keyList, ", ")
+	}
+	limit := r.Limit
+	if limit <= 0 {
+		limit = opts.Limit
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return 0, nil, fmt.Errorf("select data: %w", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, nil, err
+	}
+	colTypes, _ := rows.ColumnTypes()
+	quoted := make([]string, len(cols))
+	position := map[string]int{}
+	for i, col := range cols {
+		quoted[i] = QuoteIdent(col)
+		position[col] = i
+	}
+	keyIndex := make([]int, len(r.Columns))
+	for i, col := range r.Columns {
+		index, ok := position[col]
+		if !ok {
+			return 0, nil, fmt.Errorf("key column %s is not in the result", col)
+		}
+		keyIndex[i] = index
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", QuoteIdent(table), strings.Join(quoted, ", "))
+	masks := opts.Mask.Columns(table, cols)
+
+	values := make([]interface{}, len(cols))
+	valuePtrs := make([]interface{}, len(cols))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	var valueRows []string
+	var lastKey []string
+	batchBytes, count := 0, 0
+	flush := func() error {
+		if len(valueRows) == 0 {
+			return nil
+		}
+		_, err := io.WriteString(w, prefix+strings.Join(valueRows, ",\n")+";\n\n")
+		if err == nil && opts.OnRows != nil {
+			opts.OnRows(len(valueRows))
+		}
+		valueRows = valueRows[:0]
+		batchBytes = 0
+		return err
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return count, nil, fmt.Errorf("scan row: %w", err)
+		}
+		valStrings := make([]string, len(cols))
+		for i, val := range values {
+			var colType *sql.ColumnType
+			if i < len(colTypes) {
+				colType = colTypes[i]
+			}
+			valStrings[i] = Literal(val, colType)
+		}
+		// The key of the last row stays unmasked, the next range starts after it
+		written := valStrings
+		if masks != nil {
+			written = make([]string, len(cols))
+			for i, val := range opts.Mask.RowForColumns(masks, values, colTypes) {
+				written[i] = valStrings[i]
+				if masks[i] != nil {
+					var colType *sql.ColumnType
+					if i < len(colTypes) {
+						colType = colTypes[i]
+					}
+					written[i] = Literal(val, colType)
+				}
+			}
+		}
+		tuple := "(" + strings.Join(written, ", ") + ")"
+		if len(valueRows) > 0 && batchBytes+len(tuple) > maxStatementBytes {
+			if err := flush(); err != nil {
+				return count, nil, err
+			}
+		}
+		valueRows = append(valueRows, tuple)
+		batchBytes += len(tuple)
+		count++
+
+		if len(keyIndex) > 0 {
+			lastKey = make([]string, len(keyIndex))
+			for i, index := range keyIndex {
+				lastKey[i] = valStrings[index]
+			}
+		}
+		if len(valueRows) >= batchSize {
+			if err := flush(); err != nil {
+				return count, nil, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, nil, fmt.Errorf("read rows: %w", err)
+	}
+	return count, lastKey, flush()
+}
+
+// KeyBoundaries cuts a table into ranges of about rowsPerChunk rows along its key and returns the last key
+// of every range but the final, open-ended one, as SQL literals. A single integer key is split arithmetically
+// between its MIN and MAX into as many ranges as the estimated row count needs, at most maxKeyChunks; any
+// other key, or a table without a row estimate, is cut at every rowsPerChunk-th key in index order.
+func KeyBoundaries(ctx context.Context, q Querier, database, table string, columns []string, rowsPerChunk int) ([][]string, error) {
+	if len(columns) == 0 || rowsPerChunk <= 0 {
+		return nil, nil
+	}
+	source := tableSource(table, TableSQLOptions{Database: database})
+	keyList := make([]string, len(columns))
+	for i, col := range columns {
+		keyList[i] = QuoteIdent(col)
+	}
+
+	if len(columns) == 1 {
+		bounds, ok, err := integerBoundaries(ctx, q, database, table, keyList[0], rowsPerChunk)
+		if err != nil || ok {
+			return bounds, err
+		}
+	}
+
+	var bounds [][]string
+	var after []string
+	for {
+		query := "SELECT " + strings.Join(keyList, ", ") + " FROM " + source
+		if after != nil {
+			query += " WHERE " + keyTuple(keyList) + " > " + keyTuple(after)
+		}
+		query += fmt.Sprintf(" ORDER BY %s LIMIT 1 OFFSET %d", strings.Join(keyList, ", "), rowsPerChunk-1)
+
+		key, err := firstRowLiterals(ctx, q, query)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return bounds, nil
+		}
+		bounds = append(bounds, key)
+		after = key
+	}
+}
+
+// Boundaries of an integer key; ok is false when the key is not an integer or does not fit in int64
+func integerBoundaries(ctx context.Context, q Querier, database, table, key string, rowsPerChunk int) ([][]string, bool, error) {
+	source := tableSource(table, TableSQLOptions{Database: database})
+	rows, err := q.QueryContext(ctx, "SELECT MIN("+key+"), MAX("+key+") FROM "+source)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, false, err
+	}
+	if !strings.Contains(colTypes[0].DatabaseTypeName(), "INT") {
+		return nil, false, nil
+	}
+	var minKey, maxKey sql.NullString
+	if rows.Next() {
+		if err := rows.Scan(&minKey, &maxKey); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if !minKey.Valid || !maxKey.Valid {
+		return nil, true, nil // empty table
+	}
+	low, err1 := strconv.ParseInt(minKey.String, 10, 64)
+	high, err2 := strconv.ParseInt(maxKey.String, 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, false, nil
+	}
+
+	// TABLE_ROWS is an estimate; without one, a sparse key could give any number of near-empty ranges,
+	// so the key is cut by OFFSET instead
+	schema := "DATABASE()"
+	args := []interface{}{table}
+	if database != "" {
+		schema = "?"
+		args = []interface{}{database, table}
+	}
+	var tableRows sql.NullInt64
+	err = q.QueryRowContext(ctx, "SELECT TABLE_ROWS FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = "+schema+" AND TABLE_NAME = ?", args...).Scan(&tableRows)
+	if err != nil || !tableRows.Valid || tableRows.Int64 <= 0 {
+		return nil, false, nil
+	}
+
+	chunks := (uint64(tableRows.Int64) + uint64(rowsPerChunk) - 1) / uint64(rowsPerChunk)
+	return splitIntegerRange(low, high, min(chunks, maxKeyChunks)), true, nil
+}
+
+// Most ranges an integer key is split into, whatever the row estimate says
+const maxKeyChunks = 10000
+
+// Last key of each of chunks equal ranges of [low, high] but the final one. There are fewer ranges when the
+// span holds fewer keys than chunks. Computed in 128 bits, so keys near the ends of int64 are exact.
+func splitIntegerRange(low, high int64, chunks uint64) [][]string {
+	// Keys in the span: width+1, which is 2^64 for the full int64 range
+	width := uint64(high) - uint64(low)
+	if chunks > width+1 && width+1 != 0 {
+		chunks = width + 1
+	}
+	var bounds [][]string
+	for i := uint64(1); i < chunks; i++ {
+		// floor((width+1) * i / chunks), below 2^64 since i < chunks
+		hi, lo := bits.Mul64(width, i)
+		lo, carry := bits.Add64(lo, i, 0)
+		hi += carry
+		offset, _ := bits.Div64(hi, lo, chunks)
+		bounds = append(bounds, []string{strconv.FormatInt(int64(uint64(low)+offset-1), 10)})
+	}
+	return bounds
+}
+
+// Values of the first row of a query as SQL literals; nil when there is no row
+func firstRowLiterals(ctx context.Context, q Querier, query string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values := make([]interface{}, len(colTypes))
+	ptrs := make([]interface{}, len(colTypes))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	literals := make([]string, len(values))
+	for i, val := range values {
+		literals[i] = Literal(val, colTypes[i])
+	}
+	return literals, nil
+}
+
+// (a, b) for several values, a for one
+func keyTuple(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
@@ -0,0 +1,64 @@
+package dump
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestSplitIntegerRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		low, high int64
+		chunks    uint64
+		want      []string
+	}{
+		{"even", 1, 100, 4, []string{"25", "50", "75"}},
+		{"uneven", 1, 10, 3, []string{"3", "6"}},
+		{"one chunk", 1, 100, 1, nil},
+		{"more chunks than keys", 5, 7, 10, []string{"5", "6"}},
+		{"single key", 42, 42, 5, nil},
+		{"negative", -10, 9, 2, []string{"-1"}},
+		{"sparse", 1, 9000000000000000000, 2, []string{"4500000000000000000"}},
+		{"full range", math.MinInt64, math.MaxInt64, 2, []string{"-1"}},
+		{"top of range", math.MaxInt64 - 3, math.MaxInt64, 4, []string{"9223372036854775804", "9223372036854775805", "9223372036854775806"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, b := range splitIntegerRange(tt.low, tt.high, tt.chunks) {
+				got = append(got, b[0])
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// Bounds stay strictly increasing and inside the span, without float rounding near 2^63
+func TestSplitIntegerRangeOrdered(t *testing.T) {
+	spans := [][2]int64{{1, 9000000000000000000}, {math.MinInt64, math.MaxInt64}, {math.MaxInt64 - 20000, math.MaxInt64}, {0, 9999}}
+	for _, span := range spans {
+		bounds := splitIntegerRange(span[0], span[1], maxKeyChunks)
+		prev := span[0]
+		for i, b := range bounds {
+			v, err := strconv.ParseInt(b[0], 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (i > 0 && v <= prev) || v < span[0] || v >= span[1] {
+				t.Fatalf("span %v: bound %d after %d is out of order or range", span, v, prev)
+			}
+			prev = v
+		}
+		if len(bounds) > maxKeyChunks-1 {
+			t.Fatalf("span %v: %d bounds", span, len(bounds))
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package dump
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FormatXLSX writes an Excel workbook, one sheet per result set
+const FormatXLSX = "xlsx"
+
+// Limits of the Excel file format
+const (
+	xlsxMaxRows      = 1048576
+	xlsxMaxCellChars = 32767
+	xlsxMaxSheetName = 31
+	xlsxMaxDigits    = 15 // Excel keeps 15 significant digits; longer numbers are written as text
+)
+
+// Cell styles defined in styles.xml, by index
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDate
+	xlsxStyleDateTime
+	xlsxStyleTime
+)
+
+// Day 0 of the 1900 date system, as Excel counts it
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+var sheetNameReplacer = strings.NewReplacer("[", "(", "]", ")", ":", "-", "*", "-", "?", "-", "/", "-", "\\", "-")
+
+// xlsxWriter builds the workbook as a zip archive. Rows go to a temporary file first
+// because column widths have to be written before the data of a sheet.
+type xlsxWriter struct {
+	zip        *zip.Writer
+	sheetNames []string
+	names      []string // names of the sheets written so far
+	columns    []string
+	types      []string
+	baseName   string
+	part       int
+
+	tmp     *os.File
+	buf     *bufio.Writer
+	rowNum  int
+	widths  []int
+	scratch strings.Builder
+}
+
+func newXLSXWriter(w io.Writer, sheetNames []string) *xlsxWriter {
+	return &xlsxWriter{zip: zip.NewWriter(w), sheetNames: sheetNames}
+}
+
+func (x *xlsxWriter) begin(set int, columns, types []string) error {
+	x.columns, x.types = columns, types
+	x.baseName = fmt.Sprintf("Result %d", set+1)
+	if set < len(x.sheetNames) && x.sheetNames[set] != "" {
+		x.baseName = x.sheetNames[set]
+	}
+	x.part = 1
+	return x.startSheet()
+}
+
+func (x *xlsxWriter) startSheet() error {
+	tmp, err := os.CreateTemp("", "pheri-sheet-*.xml")
+	if err != nil {
+		return err
+	}
+	x.tmp = tmp
+	x.buf = bufio.NewWriter(tmp)
+	x.rowNum = 0
+	x.widths = make([]int, len(x.columns))
+
+	header := make([]interface{}, len(x.columns))
+	for i, col := range x.columns {
+		header[i] = col
+	}
+	return x.writeRow(header, true)
+}
+
+func (x *xlsxWriter) row(values []interface{}) error {
+	if x.rowNum >= xlsxMaxRows {
+		// Continue on a new sheet once Excel's row limit is reached
+		if err := x.finishSheet(); err != nil {
+			return err
+		}
+		x.part++
+		if err := x.startSheet(); err != nil {
+			return err
+		}
+	}
+	return x.writeRow(values, false)
+}
+
+func (x *xlsxWriter) writeRow(values []interface{}, header bool) error {
+	x.rowNum++
+	b := &x.scratch
+	b.Reset()
+	b.WriteString(`<row r="` + strconv.Itoa(x.rowNum) + `">`)
+	for i, val := range values {
+		ref := columnName(i) + strconv.Itoa(x.rowNum)
+		var text string
+		if header {
+			text = fmt.Sprint(val)
+			writeStringCell(b, ref, text, xlsxStyleHeader)
+		} else {
+			text = x.writeCell(b, ref, val, typeAt(x.types, i))
+		}
+		if i < len(x.widths) {
+			if n := utf8.RuneCountInString(text); n > x.widths[i] {
+				x.widths[i] = n
+			}
+		}
+	}
+	b.WriteString("</row>")
+	_, err := x.buf.WriteString(b.String())
+	return err
+}
+
+// Write one typed cell and return the text it displays (for column widths)
+func (x *xlsxWriter) writeCell(b *strings.Builder, ref string, val interface{}, typeName string) string {
+	if val == nil {
+		return ""
+	}
+	if v, ok := val.(bool); ok {
+		flag, display := "0", "FALSE"
+		if v {
+			flag, display = "1", "TRUE"
+		}
+		b.WriteString(`<c r="` + ref + `" t="b"><v>` + flag + `</v></c>`)
+		return display
+	}
+	if t, ok := val.(time.Time); ok {
+		return writeTimeCell(b, ref, t, typeName)
+	}
+
+	text, _ := textValue(val, typeName)
+	switch {
+	case IsNumericType(typeName) || isGoNumber(val):
+		if numericRegex.MatchString(text) && significantDigits(text) <= xlsxMaxDigits {
+			b.WriteString(`<c r="` + ref + `"><v>` + text + `</v></c>`)
+			return text
+		}
+	case isDateType(typeName):
+		if t, ok := parseDateValue(text, typeName); ok {
+			return writeTimeCell(b, ref, t, typeName)
+		}
+	}
+	writeStringCell(b, ref, text, xlsxStyleDefault)
+	return text
+}
+
+func isGoNumber(val interface{}) bool {
+	switch val.(type) {
+	case int64, int32, int, uint64, float64, float32:
+		return true
+	}
+	return false
+}
+
+func isDateType(typeName string) bool {
+	switch strings.ToUpper(typeName) {
+	case "DATE", "DATETIME", "TIMESTAMP", "TIME":
+		return true
+	}
+	return false
+}
+
+// Dates arrive as text unless the connection uses parseTime; zero dates stay text
+func parseDateValue(text, typeName string) (time.Time, bool) {
+	layout := "2006-01-02 15:04:05"
+	switch strings.ToUpper(typeName) {
+	case "DATE":
+		layout = "2006-01-02"
+	case "TIME":
+		layout = "15:04:05"
+	}
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "0000") {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, text)
+	if err != nil && layout != "2006-01-02" {
+		// Fractional seconds
+		t, err = time.Parse(layout+".999999", text)
+	}
+	return t, err == nil
+}
+
+func writeTimeCell(b *strings.Builder, ref string, t time.Time, typeName string) string {
+	style := xlsxStyleDateTime
+	display := t.Format("2006-01-02 15:04:05")
+	var serial float64
+	switch strings.ToUpper(typeName) {
+	case "DATE":
+		style, display = xlsxStyleDate, t.Format("2006-01-02")
+	case "TIME":
+		style, display = xlsxStyleTime, t.Format("15:04:05")
+		serial = float64(t.Hour()*3600+t.Minute()*60+t.Second()) / 86400
+	}
+	if style != xlsxStyleTime {
+		serial = t.Sub(excelEpoch).Hours() / 24
+		if serial < 1 {
+			writeStringCell(b, ref, display, xlsxStyleDefault)
+			return display
+		}
+	}
+	b.WriteString(fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(serial, 'f', -1, 64)))
+	return display
+}
+
+func writeStringCell(b *strings.Builder, ref, text string, style int) {
+	if utf8.RuneCountInString(text) > xlsxMaxCellChars {
+		text = string([]rune(text)[:xlsxMaxCellChars])
+	}
+	b.WriteString(`<c r="` + ref + `" t="inlineStr"`)
+	if style != xlsxStyleDefault {
+		b.WriteString(` s="` + strconv.Itoa(style) + `"`)
+	}
+	b.WriteString(`><is><t xml:space="preserve">` + xmlText(text) + `</t></is></c>`)
+}
+
+// Escape text for XML and drop the control characters XML 1.0 does not allow
+func xmlText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteRune(r)
+		case r < 0x20 || r == 0xFFFE || r == 0xFFFF || r == utf8.RuneError:
+			continue
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func significantDigits(number string) int {
+	mantissa := strings.SplitN(strings.ToLower(number), "e", 2)[0]
+	digits := strings.TrimLeft(strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, mantissa), "0")
+	if strings.Contains(mantissa, ".") {
+		digits = strings.TrimRight(digits, "0")
+	}
+	return len(digits)
+}
+
+// Column letters: 0 -> A, 25 -> Z, 26 -> AA
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func (x *xlsxWriter) end(set int) error {
+	return x.finishSheet()
+}
+
+// Copy the buffered rows into the archive as the next worksheet
+func (x *xlsxWriter) finishSheet() error {
+	defer x.cleanup()
+	if err := x.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := x.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	name := x.baseName
+	if x.part > 1 {
+		name = fmt.Sprintf("%s (%d)", x.baseName, x.part)
+	}
+	x.names = append(x.names, x.uniqueSheetName(name))
+
+	w, err := x.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.names)))
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Frozen header row
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(x.widths) > 0 {
+		b.WriteString("<cols>")
+		for i, width := range x.widths {
+			width += 2
+			if width < 8 {
+				width = 8
+			}
+			if width > 60 {
+				width = 60
+			}
+			b.WriteString(fmt.Sprintf(`<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width))
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, x.tmp); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "</sheetData></worksheet>")
+	return err
+}
+
+// Sheet names are limited to 31 characters, some punctuation, and must be unique
+func (x *xlsxWriter) uniqueSheetName(name string) string {
+	name = strings.Trim(sheetNameReplacer.Replace(name), "'")
+	if name == "" {
+		name = "Sheet"
+	}
+	base := name
+	for n := 2; ; n++ {
+		if utf8.RuneCountInString(name) > xlsxMaxSheetName {
+			name = string([]rune(name)[:xlsxMaxSheetName])
+		}
+		taken := false
+		for _, existing := range x.names {
+			if strings.EqualFold(existing, name) {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return name
+		}
+		suffix := fmt.Sprintf(" %d", n)
+		runes := []rune(base)
+		if len(runes)+len(suffix) > xlsxMaxSheetName {
+			runes = runes[:xlsxMaxSheetName-len(suffix)]
+		}
+		name = string(runes) + suffix
+	}
+}
+
+// Remove the temporary file of the sheet being written, if any
+func (x *xlsxWriter) cleanup() {
+	if x.tmp != nil {
+		x.tmp.Close()
+		os.Remove(x.tmp.Name())
+		x.tmp = nil
+	}
+}
+
+func (x *xlsxWriter) close() error {
+	if len(x.names) == 0 {
+		// A workbook needs at least one sheet
+		x.columns, x.types, x.baseName, x.part = nil, nil, "Result 1", 1
+		if err := x.startSheet(); err != nil {
+			return err
+		}
+		if err := x.finishSheet(); err != nil {
+			return err
+		}
+	}
+
+	files := map[string]string{
+		"[Content_Types].xml":        x.contentTypes(),
+		"_rels/.rels":                xlsxRootRels,
+		"xl/workbook.xml":            x.workbook(),
+		"xl/_rels/workbook.xml.rels": x.workbookRels(),
+		"xl/styles.xml":              xlsxStyles,
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		w, err := x.zip.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, files[name]); err != nil {
+			return err
+		}
+	}
+	return x.zip.Close()
+}
+
+func (x *xlsxWriter) contentTypes() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range x.names {
+		b.WriteString(fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1))
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func (x *xlsxWriter) workbook() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, name := range x.names {
+		b.WriteString(fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlText(name), i+1, i+1))
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func (x *xlsxWriter) workbookRels() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range x.names {
+		b.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1))
+	}
+	b.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(x.names)+1))
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// Styles in the order of the xlsxStyle constants: default, bold header, date, date-time, time
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="21" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
@@ -3,6 +3,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"mysql-tui/phhistory"
 	"mysql-tui/ui"
 	"os"
@@ -11,8 +12,21 @@ import (
 	"github.com/rivo/tview"
 )
 
+// Matches printed by pheri -history -search
+const historySearchLimit = 100
+
 func main() {
 
+	// Headless subcommands for scripts and cron; anything else starts the TUI
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			os.Exit(runExportCommand(os.Args[2:]))
+		case "import":
+			os.Exit(runImportCommand(os.Args[2:]))
+		}
+	}
+
 	user := flag.String("u", "", "Username")
 	pass := flag.String("p", "", "Password")
 	host := flag.String("host", "localhost", "Hostname")
@@ -23,6 +37,10 @@ func main() {
 	months := flag.Int("months", 12, "Number of months to keep history")
 	years := flag.Int("years", 1, "Number of years to keep history")
 	historyFile := flag.String("history_file", "", "File to import")
+	search := flag.String("search", "", "With -history, search the queries for these words, best matches first")
+	historyDB := flag.String("history_db", "", "With -history, only queries run against this database")
+	historyStatus := flag.String("history_status", "", "With -history, only queries that succeeded (ok) or failed (error)")
+	slowerThan := flag.Duration("slower_than", 0, "With -history, only queries that ran at least this long, slowest first (e.g. 2s)")
 
 	// Add more flags as needed
 	// Parse command line flags
@@ -55,7 +73,24 @@ func main() {
 	if *history {
 		// If the -history flag is provided, show the history
 		// and exit the program
-		err := phhistory.FetchHistory(*days, *months, *years, *historyFile)
+		if *historyStatus != "" && *historyStatus != phhistory.StatusOK && *historyStatus != phhistory.StatusError {
+			fmt.Fprintf(os.Stderr, "-history_status must be %s or %s\n", phhistory.StatusOK, phhistory.StatusError)
+			os.Exit(2)
+		}
+		filter := phhistory.HistoryFilter{
+			DBName:      *historyDB,
+			Status:      *historyStatus,
+			MinDuration: *slowerThan,
+			Slowest:     *slowerThan > 0,
+		}
+		var err error
+		if *search != "" {
+			filter.Text = *search
+			filter.Limit = historySearchLimit
+			err = phhistory.PrintHistory(filter, *historyFile)
+		} else {
+			err = phhistory.FetchHistory(*days, *months, *years, filter, *historyFile)
+		}
 		if err != nil {
 			panic(err)
 		}
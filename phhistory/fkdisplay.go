@@ -0,0 +1,41 @@
+package phhistory
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// GetDisplayColumn returns the column shown next to keys of a referenced table, or "" if none is configured
+func GetDisplayColumn(dbName, tableName string) (string, error) {
+	if db == nil {
+		return "", fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+	var column string
+	err := db.QueryRow(`
+		SELECT display_column FROM pheri_fk_display
+		WHERE host_ip = ? AND db_name = ? AND table_name = ?
+	`, host, dbName, tableName).Scan(&column)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read display column: %w", err)
+	}
+	return column, nil
+}
+
+// SetDisplayColumn remembers the display column of a referenced table
+func SetDisplayColumn(dbName, tableName, column string) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+	_, err := db.Exec(`
+		INSERT INTO pheri_fk_display (host_ip, db_name, table_name, display_column)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (host_ip, db_name, table_name) DO UPDATE SET display_column = excluded.display_column
+	`, host, dbName, tableName, column)
+	if err != nil {
+		return fmt.Errorf("failed to save display column: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package phhistory
+
+import (
+	"fmt"
+)
+
+// Schema versions of the history database, stored in PRAGMA user_version. Migration i brings a database
+// from version i to i+1 in one transaction. Databases created before versioning report version 0; the
+// first two migrations only create what is missing, so they are safe to run on them.
+var migrations = []struct {
+	name       string
+	statements []string
+}{
+	{"history, undo log and foreign key display tables", []string{
+		`CREATE TABLE IF NOT EXISTS pheri_phhistory (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			query_text TEXT NOT NULL,
+			host_ip VARCHAR(15) NOT NULL,
+			db_name VARCHAR(100) NOT NULL,
+			user VARCHAR(100) NOT NULL,
+			port VARCHAR(10) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS pheri_undo_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id VARCHAR(64) NOT NULL,
+			host_ip VARCHAR(15) NOT NULL,
+			db_name VARCHAR(100) NOT NULL,
+			table_name VARCHAR(100) NOT NULL,
+			operation VARCHAR(10) NOT NULL,
+			key_column VARCHAR(100) NOT NULL,
+			key_value TEXT,
+			before_image TEXT,
+			after_image TEXT,
+			undone INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS pheri_fk_display (
+			host_ip VARCHAR(15) NOT NULL,
+			db_name VARCHAR(100) NOT NULL,
+			table_name VARCHAR(100) NOT NULL,
+			display_column VARCHAR(100) NOT NULL,
+			PRIMARY KEY (host_ip, db_name, table_name)
+		)`,
+	}},
+	// Full-text index over query_text. It holds no copy of the text: the triggers keep it in step with the
+	// history table. Underscores are part of a token, so customer_id is one word. The rebuild indexes the
+	// history recorded before.
+	{"history search index", []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS pheri_phhistory_fts USING fts5(
+			query_text,
+			content = 'pheri_phhistory',
+			content_rowid = 'id',
+			tokenize = "unicode61 tokenchars '_'"
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS pheri_phhistory_fts_insert AFTER INSERT ON pheri_phhistory BEGIN
+			INSERT INTO pheri_phhistory_fts (rowid, query_text) VALUES (new.id, new.query_text);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS pheri_phhistory_fts_delete AFTER DELETE ON pheri_phhistory BEGIN
+			INSERT INTO pheri_phhistory_fts (pheri_phhistory_fts, rowid, query_text) VALUES ('delete', old.id, old.query_text);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS pheri_phhistory_fts_update AFTER UPDATE OF query_text ON pheri_phhistory BEGIN
+			INSERT INTO pheri_phhistory_fts (pheri_phhistory_fts, rowid, query_text) VALUES ('delete', old.id, old.query_text);
+			INSERT INTO pheri_phhistory_fts (rowid, query_text) VALUES (new.id, new.query_text);
+		END`,
+		`INSERT INTO pheri_phhistory_fts (pheri_phhistory_fts) VALUES ('rebuild')`,
+	}},
+	// How each query went. Queries recorded before have an empty status and no duration or row counts.
+	{"query duration, row counts, status and connection", []string{
+		`ALTER TABLE pheri_phhistory ADD COLUMN duration_ms INTEGER`,
+		`ALTER TABLE pheri_phhistory ADD COLUMN rows_returned INTEGER`,
+		`ALTER TABLE pheri_phhistory ADD COLUMN rows_affected INTEGER`,
+		`ALTER TABLE pheri_phhistory ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT ''`,
+		`ALTER TABLE pheri_phhistory ADD COLUMN error_message TEXT`,
+		`ALTER TABLE pheri_phhistory ADD COLUMN profile VARCHAR(200) NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS pheri_phhistory_created ON pheri_phhistory (created_at)`,
+	}},
+	// Named queries of the snippet library, seeded with the SQL templates earlier versions offered
+	{"snippet library", []string{
+		`CREATE TABLE IF NOT EXISTS pheri_snippets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			folder VARCHAR(200) NOT NULL DEFAULT '',
+			name VARCHAR(200) NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (folder, name)
+		)`,
+		`INSERT OR IGNORE INTO pheri_snippets (folder, name, description, tags, body) VALUES
+			('Database', 'Create database', 'Creates a database', 'ddl, database', 'CREATE DATABASE ${database:company_db}'),
+			('Database', 'Drop database', 'Drops a database and every table in it', 'ddl, database, destructive', 'DROP DATABASE ${database}'),
+			('Tables', 'Create table', 'Table with an auto-increment primary key', 'ddl, table', 'CREATE TABLE ${table:employees} (id INT PRIMARY KEY AUTO_INCREMENT, name VARCHAR(100), age INT, department_id INT, hire_date DATE)'),
+			('Tables', 'Add column', '', 'ddl, table, column', 'ALTER TABLE ${table} ADD COLUMN ${column} ${type:DECIMAL(10,2)}'),
+			('Tables', 'Drop column', '', 'ddl, table, column, destructive', 'ALTER TABLE ${table} DROP COLUMN ${column}'),
+			('Tables', 'Rename table', '', 'ddl, table', 'ALTER TABLE ${table} RENAME TO ${new_name}'),
+			('Tables', 'Change column type', '', 'ddl, table, column', 'ALTER TABLE ${table} MODIFY ${column} ${type:SMALLINT}'),
+			('Tables', 'Add foreign key', '', 'ddl, table, foreign key', 'ALTER TABLE ${table} ADD CONSTRAINT ${constraint:fk_department} FOREIGN KEY (${column:department_id}) REFERENCES ${referenced_table:departments}(${referenced_column:id})'),
+			('Tables', 'Drop table', '', 'ddl, table, destructive', 'DROP TABLE ${table}'),
+			('Tables', 'Truncate table', 'Deletes every row and resets the auto-increment counter', 'ddl, table, destructive', 'TRUNCATE TABLE ${table}'),
+			('Indexes', 'Create index', '', 'ddl, index', 'CREATE INDEX ${index:idx_emp_name} ON ${table:employees} (${columns:name})'),
+			('Indexes', 'Create unique index', '', 'ddl, index', 'CREATE UNIQUE INDEX ${index:idx_users_email} ON ${table:users} (${columns:email})'),
+			('Indexes', 'Drop index', '', 'ddl, index', 'DROP INDEX ${index} ON ${table}'),
+			('Data', 'Insert row', '', 'dml, insert', 'INSERT INTO employees (name, age, department_id) VALUES (''John Doe'', 30, 2)'),
+			('Data', 'Insert rows', 'Several rows in one statement', 'dml, insert', 'INSERT INTO departments (id, name) VALUES (1, ''HR''), (2, ''Engineering'')'),
+			('Data', 'Insert from select', '', 'dml, insert', 'INSERT INTO archive_employees (id, name) SELECT id, name FROM employees WHERE status = ''inactive'''),
+			('Data', 'Delete rows', '', 'dml, delete', 'DELETE FROM ${table} WHERE ${condition}'),
+			('Data', 'Delete all rows', '', 'dml, delete, destructive', 'DELETE FROM ${table}'),
+			('Data', 'Update rows', '', 'dml, update', 'UPDATE employees SET salary = salary + 1000 WHERE performance = ''excellent'''),
+			('Select', 'Select all', '', 'select', 'SELECT * FROM ${table}'),
+			('Select', 'Select columns', '', 'select', 'SELECT name, age FROM employees WHERE department_id = 2'),
+			('Select', 'Select ordered', '', 'select, order', 'SELECT name FROM employees ORDER BY hire_date DESC'),
+			('Select', 'Select distinct', '', 'select', 'SELECT DISTINCT ${column} FROM ${table}'),
+			('Select', 'Select page', '', 'select, limit', 'SELECT * FROM ${table} LIMIT ${limit:10} OFFSET ${offset:0}'),
+			('Select/Conditions', 'Greater than', '', 'where', 'WHERE age > 25'),
+			('Select/Conditions', 'Like', '', 'where', 'WHERE name LIKE ''J%'''),
+			('Select/Conditions', 'Between', '', 'where', 'WHERE salary BETWEEN 30000 AND 50000'),
+			('Select/Conditions', 'In list', '', 'where', 'WHERE department_id IN (1, 2, 3)'),
+			('Select/Conditions', 'Not null', '', 'where', 'WHERE hire_date IS NOT NULL'),
+			('Select/Ordering', 'Order by', '', 'order', 'ORDER BY hire_date DESC'),
+			('Select/Ordering', 'Limit', '', 'limit', 'LIMIT 10'),
+			('Select/Ordering', 'Offset', '', 'limit', 'OFFSET 20'),
+			('Aggregates', 'Count rows', '', 'aggregate', 'SELECT COUNT(*) FROM ${table}'),
+			('Aggregates', 'Average', '', 'aggregate', 'SELECT AVG(salary) FROM employees WHERE department_id = 2'),
+			('Aggregates', 'Sum per group', '', 'aggregate, group by', 'SELECT department_id, SUM(salary) FROM employees GROUP BY department_id'),
+			('Aggregates', 'Count per group', '', 'aggregate, group by', 'SELECT ${column}, COUNT(*) FROM ${table} GROUP BY ${column}'),
+			('Aggregates', 'Having', 'Groups filtered on an aggregate', 'aggregate, group by', 'SELECT department_id, AVG(salary) FROM employees GROUP BY department_id HAVING AVG(salary) > 50000'),
+			('Joins', 'Inner join', '', 'join', 'SELECT e.name, d.name FROM employees e INNER JOIN departments d ON e.department_id = d.id'),
+			('Joins', 'Left join', '', 'join', 'SELECT e.name, d.name FROM employees e LEFT JOIN departments d ON e.department_id = d.id'),
+			('Joins', 'Right join', '', 'join', 'SELECT e.name, d.name FROM employees e RIGHT JOIN departments d ON e.department_id = d.id'),
+			('Joins', 'Full outer join', 'MySQL has no FULL OUTER JOIN; this is the UNION of a left and a right join', 'join', 'SELECT e.name, d.name FROM employees e LEFT JOIN departments d ON e.department_id = d.id' || char(10) || 'UNION' || char(10) || 'SELECT e.name, d.name FROM employees e RIGHT JOIN departments d ON e.department_id = d.id'),
+			('Subqueries', 'Scalar subquery', '', 'subquery', 'SELECT name FROM employees WHERE department_id = (SELECT id FROM departments WHERE name = ''Engineering'')'),
+			('Subqueries', 'Above average', '', 'subquery, aggregate', 'SELECT name FROM employees WHERE salary > (SELECT AVG(salary) FROM employees)'),
+			('Views', 'Create view', '', 'ddl, view', 'CREATE VIEW active_employees AS SELECT id, name FROM employees WHERE status = ''active'''),
+			('Transactions', 'Start transaction', '', 'transaction', 'START TRANSACTION'),
+			('Transactions', 'Commit', '', 'transaction', 'COMMIT'),
+			('Transactions', 'Rollback', '', 'transaction', 'ROLLBACK'),
+			('Users', 'Create user', '', 'user, security', 'CREATE USER ''${user:user1}''@''${host:localhost}'' IDENTIFIED BY ''${password}'''),
+			('Users', 'Grant', '', 'user, security', 'GRANT SELECT, INSERT ON ${database:company_db}.* TO ''${user:user1}''@''${host:localhost}'''),
+			('Users', 'Revoke', '', 'user, security', 'REVOKE INSERT ON ${database:company_db}.* FROM ''${user:user1}''@''${host:localhost}'''),
+			('Users', 'Drop user', '', 'user, security, destructive', 'DROP USER ''${user:user1}''@''${host:localhost}'''),
+			('Routines', 'Stored procedure', '', 'ddl, procedure', 'DELIMITER //' || char(10) || 'CREATE PROCEDURE GetEmployeeByID(IN emp_id INT)' || char(10) || 'BEGIN' || char(10) || '' || char(9) || 'SELECT * FROM employees WHERE id = emp_id;' || char(10) || 'END //' || char(10) || 'DELIMITER ;'),
+			('Routines', 'Trigger', '', 'ddl, trigger', 'CREATE TRIGGER before_insert_employee' || char(10) || 'BEFORE INSERT ON employees' || char(10) || 'FOR EACH ROW' || char(10) || 'SET NEW.hire_date = NOW();')`,
+	}},
+	// Undo entries keyed on every primary key column; key_column and key_value hold the first part only
+	{"composite undo keys", []string{
+		`ALTER TABLE pheri_undo_log ADD COLUMN key_columns TEXT`,
+		`ALTER TABLE pheri_undo_log ADD COLUMN key_values TEXT`,
+	}},
+}
+
+// Bring the history database up to the latest schema version
+func migrate() error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read history schema version: %w", err)
+	}
+	// A newer pheri upgraded this database; its additions are left alone
+	for ; version < len(migrations); version++ {
+		m := migrations[version]
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to migrate history database to version %d (%s): %w", version+1, m.name, err)
+			}
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate history database to version %d (%s): %w", version+1, m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to migrate history database to version %d (%s): %w", version+1, m.name, err)
+		}
+	}
+	return nil
+}
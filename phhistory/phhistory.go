@@ -15,6 +15,9 @@ var db *sql.DB
 
 var user, host, port string
 
+// sessionID groups the undo log entries of one pheri run
+var sessionID string
+
 func SetUser(u string) {
 	user = u
 }
@@ -37,21 +40,10 @@ func InitPhHistory(dbPath string, userLocal, hostLocal, portLocal string) error
 	user = userLocal
 	host = hostLocal
 	port = portLocal
+	sessionID = fmt.Sprintf("%d-%d", time.Now().UnixNano(), os.Getpid())
 
-	// Create table if it does not exist
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS pheri_phhistory (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            query_text TEXT NOT NULL,
-            host_ip VARCHAR(15) NOT NULL,    
-            db_name VARCHAR(100) NOT NULL,     
-			user VARCHAR(100) NOT NULL,  
-			port VARCHAR(10) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        );
-    `)
-	if err != nil {
-		return fmt.Errorf("failed to create history table: %w", err)
+	if err := migrate(); err != nil {
+		return err
 	}
 
 	return nil
@@ -70,22 +62,75 @@ func InitPhHistory(dbPath string, userLocal, hostLocal, portLocal string) error
 // 	return nil
 // }
 
-// SaveQuery saves a query along with host IP and database name
-func SaveQuery(query, dbName string) error {
+// Statuses of a recorded query
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// QueryRun is how one execution of a query went
+type QueryRun struct {
+	Duration time.Duration
+	Rows     int64 // rows returned; -1 when it returned no result set
+	Affected int64 // rows changed by a statement without a result set; -1 when unknown
+	Err      error // nil when the query succeeded
+}
+
+// SaveQuery saves a query along with host IP, database name, connection and how it ran
+func SaveQuery(query, dbName string, run QueryRun) error {
 	if db == nil {
 		return fmt.Errorf("database not initialized, call InitPhHistory first")
 	}
 
+	status, errorMessage := StatusOK, sql.NullString{}
+	if run.Err != nil {
+		status = StatusError
+		errorMessage = sql.NullString{String: run.Err.Error(), Valid: true}
+	}
 	_, err := db.Exec(`
-		INSERT INTO pheri_phhistory (query_text, host_ip, db_name, user, port)
-		VALUES (?, ?, ?, ?, ?)
-	`, query, host, dbName, user, port)
+		INSERT INTO pheri_phhistory (query_text, host_ip, db_name, user, port,
+			duration_ms, rows_returned, rows_affected, status, error_message, profile)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, query, host, dbName, user, port,
+		run.Duration.Milliseconds(), nullCount(run.Rows), nullCount(run.Affected), status, errorMessage, Profile())
 	if err != nil {
 		return fmt.Errorf("failed to save query: %w", err)
 	}
 	return nil
 }
 
+// Profile names the current connection as user@host:port
+func Profile() string {
+	return fmt.Sprintf("%s@%s:%s", user, host, port)
+}
+
+// A row count, or NULL when it is unknown
+func nullCount(n int64) interface{} {
+	if n < 0 {
+		return nil
+	}
+	return n
+}
+
+// HistoryEntry is one query recorded by SaveQuery. Queries recorded by older versions have an empty
+// Status, no Duration, and Rows and Affected of -1.
+type HistoryEntry struct {
+	ID        int64
+	Query     string
+	Host      string
+	DBName    string
+	User      string
+	Port      string
+	CreatedAt time.Time
+	Duration  time.Duration
+	Rows      int64
+	Affected  int64
+	Status    string
+	Error     string
+	Profile   string
+	Snippet   string // matching part of the query, terms between HighlightStart and HighlightEnd; set by searches
+}
+
 // Close closes the database connection (call this on app shutdown)
 func Close() error {
 	if db != nil {
@@ -106,6 +151,8 @@ func ReplacePlaceholders(query string, args ...interface{}) string {
 				arg := args[argIndex]
 				// Replace the ? with the appropriate value
 				switch v := arg.(type) {
+				case nil:
+					replacedQuery += "NULL"
 				case string:
 					replacedQuery += "'" + v + "'"
 				case int, int64:
@@ -128,64 +175,19 @@ func ReplacePlaceholders(query string, args ...interface{}) string {
 	return replacedQuery
 }
 
-func FetchHistory(days, months, years int, file string) error {
-
-	if db == nil {
-		return fmt.Errorf("database not initialized")
-	}
-
-	var condition string
-	var args []interface{}
-
+// FetchHistory prints the queries of the last days, months or years that pass filter, newest first,
+// to file or to stdout
+func FetchHistory(days, months, years int, filter HistoryFilter, file string) error {
 	now := time.Now()
 	switch {
 	case days > 0:
-		from := now.AddDate(0, 0, -days)
-		condition = "created_at >= ?"
-		args = append(args, from.Format("2006-01-02"))
+		filter.Since = now.AddDate(0, 0, -days)
 	case months > 0:
-		from := now.AddDate(0, -months, 0)
-		condition = "created_at >= ?"
-		args = append(args, from.Format("2006-01-02"))
+		filter.Since = now.AddDate(0, -months, 0)
 	case years > 0:
-		from := now.AddDate(-years, 0, 0)
-		condition = "created_at >= ?"
-		args = append(args, from.Format("2006-01-02"))
+		filter.Since = now.AddDate(-years, 0, 0)
 	default:
 		return fmt.Errorf("please provide -days, -month, or -year")
 	}
-
-	query := fmt.Sprintf(`
-		SELECT id, query_text, host_ip, db_name, user, port, created_at
-		FROM pheri_phhistory
-		WHERE %s
-		ORDER BY created_at DESC
-	`, condition)
-
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		fmt.Println("Error executing query:", err)
-		return fmt.Errorf("query error: %w", err)
-	}
-	defer rows.Close()
-
-	output := ""
-	for rows.Next() {
-		var id int
-		var queryText, hostIP, dbName, user, port string
-		var createdAt time.Time
-
-		if err := rows.Scan(&id, &queryText, &hostIP, &dbName, &user, &port, &createdAt); err != nil {
-			return err
-		}
-		output += fmt.Sprintf("ID: %d\nQuery: %s\nHost: %s\nDB: %s\nUser: %s\nPort: %s\nDate: %s\n\n",
-			id, queryText, hostIP, dbName, user, port, createdAt.Format(time.RFC3339))
-	}
-
-	if file != "" {
-		return os.WriteFile(file, []byte(output), 0644)
-	} else {
-		fmt.Println(output)
-	}
-	return nil
+	return PrintHistory(filter, file)
 }
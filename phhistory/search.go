@@ -0,0 +1,184 @@
+package phhistory
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Markers around the matched terms of HistoryEntry.Snippet
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// HistoryFilter selects queries of the history; zero fields match anything
+type HistoryFilter struct {
+	Host        string
+	DBName      string
+	Text        string        // words that have to appear in the query, see FindHistory
+	Since       time.Time     // run at or after
+	Status      string        // StatusOK or StatusError
+	MinDuration time.Duration // ran at least this long
+	Slowest     bool          // slowest first instead of best match or newest first
+	Limit       int
+}
+
+// SearchHistory is FindHistory for the current host
+func SearchHistory(filter HistoryFilter) ([]HistoryEntry, error) {
+	filter.Host = host
+	return FindHistory(filter)
+}
+
+// FindHistory lists the queries that pass filter. Every word of filter.Text has to appear in the query,
+// as a word or the start of one, in any case: "orders join cust" finds SELECT ... FROM orders JOIN customers.
+// Matches come best first, with a snippet around the matched words; without Text the newest come first.
+func FindHistory(filter HistoryFilter) ([]HistoryEntry, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+
+	var where []string
+	var args []interface{}
+	if filter.Host != "" {
+		where = append(where, "h.host_ip = ?")
+		args = append(args, filter.Host)
+	}
+	if filter.DBName != "" {
+		where = append(where, "h.db_name = ?")
+		args = append(args, filter.DBName)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "h.created_at >= ?")
+		args = append(args, filter.Since.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if filter.Status != "" {
+		where = append(where, "h.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.MinDuration > 0 {
+		where = append(where, "h.duration_ms >= ?")
+		args = append(args, filter.MinDuration.Milliseconds())
+	}
+
+	columns := `h.id, h.query_text, h.host_ip, h.db_name, h.user, h.port, h.created_at,
+		h.duration_ms, h.rows_returned, h.rows_affected, h.status, h.error_message, h.profile`
+	from := "pheri_phhistory h"
+	order := "h.id DESC"
+	if match := matchExpression(filter.Text); match != "" {
+		columns += ", snippet(pheri_phhistory_fts, 0, char(2), char(3), '…', 16)"
+		from = "pheri_phhistory_fts JOIN pheri_phhistory h ON h.id = pheri_phhistory_fts.rowid"
+		order = "pheri_phhistory_fts.rank, h.id DESC"
+		where = append(where, "pheri_phhistory_fts MATCH ?")
+		args = append(args, match)
+	} else {
+		columns += ", ''"
+	}
+	if filter.Slowest {
+		order = "h.duration_ms IS NULL, h.duration_ms DESC, " + order
+	}
+
+	query := "SELECT " + columns + " FROM " + from
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + order
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		var duration, returned, affected sql.NullInt64
+		var errorMessage, snippet sql.NullString
+		if err := rows.Scan(&e.ID, &e.Query, &e.Host, &e.DBName, &e.User, &e.Port, &e.CreatedAt,
+			&duration, &returned, &affected, &e.Status, &errorMessage, &e.Profile, &snippet); err != nil {
+			return nil, err
+		}
+		e.Duration = time.Duration(duration.Int64) * time.Millisecond
+		e.Rows, e.Affected = -1, -1
+		if returned.Valid {
+			e.Rows = returned.Int64
+		}
+		if affected.Valid {
+			e.Affected = affected.Int64
+		}
+		e.Error = errorMessage.String
+		e.Snippet = snippet.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// FTS5 expression requiring every word of filter as a token prefix. Each word is quoted, so SQL
+// punctuation is not read as query syntax; words without letters or digits are dropped.
+func matchExpression(filter string) string {
+	var terms []string
+	for _, word := range strings.Fields(filter) {
+		if strings.IndexFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// PrintHistory writes the queries that pass filter to file or to stdout.
+// On a terminal the words matched by filter.Text are shown in bold.
+func PrintHistory(filter HistoryFilter, file string) error {
+	entries, err := FindHistory(filter)
+	if err != nil {
+		return err
+	}
+
+	start, end := "", ""
+	if file == "" {
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			start, end = "\x1b[1;33m", "\x1b[0m"
+		}
+	}
+	highlight := strings.NewReplacer(HighlightStart, start, HighlightEnd, end)
+
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(fmt.Sprintf("ID: %d\n", e.ID))
+		if e.Snippet != "" {
+			b.WriteString(fmt.Sprintf("Match: %s\n", highlight.Replace(e.Snippet)))
+		}
+		b.WriteString(fmt.Sprintf("Query: %s\nHost: %s\nDB: %s\nUser: %s\nPort: %s\nDate: %s\n",
+			e.Query, e.Host, e.DBName, e.User, e.Port, e.CreatedAt.Format(time.RFC3339)))
+		if e.Status != "" {
+			b.WriteString(fmt.Sprintf("Status: %s\nDuration: %s\n", e.Status, e.Duration))
+		}
+		if e.Rows >= 0 {
+			b.WriteString(fmt.Sprintf("Rows: %d\n", e.Rows))
+		}
+		if e.Affected >= 0 {
+			b.WriteString(fmt.Sprintf("Affected: %d\n", e.Affected))
+		}
+		if e.Error != "" {
+			b.WriteString(fmt.Sprintf("Error: %s\n", e.Error))
+		}
+		b.WriteString("\n")
+	}
+	if len(entries) == 0 {
+		b.WriteString("No queries found\n")
+	}
+
+	if file != "" {
+		return os.WriteFile(file, []byte(b.String()), 0644)
+	}
+	fmt.Print(b.String())
+	return nil
+}
@@ -0,0 +1,343 @@
+package phhistory
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snippet is a named query of the snippet library. Its body may hold placeholders, ${name} or
+// ${name:default}, filled in when the snippet is used.
+type Snippet struct {
+	ID          int64
+	Folder      string // slash-separated path, "" for the top level
+	Name        string
+	Description string
+	Tags        []string
+	Body        string
+	UpdatedAt   time.Time
+}
+
+// Placeholder is one ${name} or ${name:default} of a snippet body
+type Placeholder struct {
+	Name    string
+	Default string
+}
+
+// Escapes % and _ of a word matched with LIKE ... ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+var placeholderRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+
+// Placeholders lists the placeholders of a body in order of first use, each name once
+func Placeholders(body string) []Placeholder {
+	var out []Placeholder
+	seen := map[string]bool{}
+	for _, m := range placeholderRegex.FindAllStringSubmatch(body, -1) {
+		if seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		out = append(out, Placeholder{Name: m[1], Default: m[2]})
+	}
+	return out
+}
+
+// FillPlaceholders replaces every placeholder with its value; names missing from values keep their default
+func FillPlaceholders(body string, values map[string]string) string {
+	return placeholderRegex.ReplaceAllStringFunc(body, func(s string) string {
+		m := placeholderRegex.FindStringSubmatch(s)
+		if v, ok := values[m[1]]; ok {
+			return v
+		}
+		return m[2]
+	})
+}
+
+// Path is the folder and name of a snippet, e.g. "Reports/Monthly sales"
+func (s Snippet) Path() string {
+	if s.Folder == "" {
+		return s.Name
+	}
+	return s.Folder + "/" + s.Name
+}
+
+// ListSnippets lists the snippets, by folder and name. Only snippets whose name, folder, description, tags
+// or body contain every word of filter, in any case, are listed; an empty filter lists them all.
+func ListSnippets(filter string) ([]Snippet, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+
+	where := "1 = 1"
+	var args []interface{}
+	for _, word := range strings.Fields(filter) {
+		where += ` AND (folder || ' ' || name || ' ' || description || ' ' || tags || ' ' || body) LIKE ? ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(word)+"%")
+	}
+	rows, err := db.Query(`
+		SELECT id, folder, name, description, tags, body, updated_at
+		FROM pheri_snippets
+		WHERE `+where+`
+		ORDER BY folder, name
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snippets: %w", err)
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+	for rows.Next() {
+		var s Snippet
+		var tags string
+		if err := rows.Scan(&s.ID, &s.Folder, &s.Name, &s.Description, &tags, &s.Body, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		s.Tags = splitTags(tags)
+		snippets = append(snippets, s)
+	}
+	return snippets, rows.Err()
+}
+
+// SaveSnippet adds a snippet, or updates it when it has an ID. A snippet with the same folder and name
+// as another is refused.
+func SaveSnippet(s Snippet) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+	return saveSnippet(db, s)
+}
+
+// The statements SaveSnippet needs, run on the database or inside a transaction
+type snippetStore interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func saveSnippet(store snippetStore, s Snippet) (int64, error) {
+	s.Folder = cleanFolder(s.Folder)
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return 0, fmt.Errorf("a snippet needs a name")
+	}
+	if strings.ContainsAny(s.Name, `/\`) {
+		return 0, fmt.Errorf("a snippet name cannot contain / or \\")
+	}
+	if s.Name == "." || s.Name == ".." {
+		return 0, fmt.Errorf("a snippet cannot be named %s", s.Name)
+	}
+
+	var other int64
+	err := store.QueryRow(`SELECT id FROM pheri_snippets WHERE folder = ? AND name = ?`, s.Folder, s.Name).Scan(&other)
+	switch {
+	case err == nil && other != s.ID:
+		return 0, fmt.Errorf("there is already a snippet %s", s.Path())
+	case err != nil && err != sql.ErrNoRows:
+		return 0, fmt.Errorf("failed to save snippet: %w", err)
+	}
+
+	tags := strings.Join(cleanTags(s.Tags), ", ")
+	if s.ID == 0 {
+		res, err := store.Exec(`
+			INSERT INTO pheri_snippets (folder, name, description, tags, body)
+			VALUES (?, ?, ?, ?, ?)
+		`, s.Folder, s.Name, s.Description, tags, s.Body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save snippet: %w", err)
+		}
+		return res.LastInsertId()
+	}
+	_, err = store.Exec(`
+		UPDATE pheri_snippets
+		SET folder = ?, name = ?, description = ?, tags = ?, body = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, s.Folder, s.Name, s.Description, tags, s.Body, s.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save snippet: %w", err)
+	}
+	return s.ID, nil
+}
+
+// DeleteSnippet removes a snippet from the library
+func DeleteSnippet(id int64) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+	if _, err := db.Exec(`DELETE FROM pheri_snippets WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete snippet: %w", err)
+	}
+	return nil
+}
+
+// ExportSnippets writes every snippet to dir as <folder>/<name>.sql, with its description and tags in
+// header comments, so the library can be kept in git and shared. Names that come out as the same file,
+// such as a:b and a?b, or Report and report on a case-insensitive file system, get a " (2)" suffix.
+// It returns the number of files written.
+func ExportSnippets(dir string) (int, error) {
+	snippets, err := ListSnippets("")
+	if err != nil {
+		return 0, err
+	}
+	used := map[string]bool{}
+	for i, s := range snippets {
+		base := filepath.Join(dir, filepath.FromSlash(s.Folder), fileName(s.Name))
+		path := base + ".sql"
+		for n := 2; used[strings.ToLower(path)]; n++ {
+			path = fmt.Sprintf("%s (%d).sql", base, n)
+		}
+		used[strings.ToLower(path)] = true
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return i, err
+		}
+		var b strings.Builder
+		b.WriteString("-- name: " + s.Name + "\n")
+		if s.Description != "" {
+			b.WriteString("-- description: " + strings.Join(strings.Fields(s.Description), " ") + "\n")
+		}
+		if len(s.Tags) > 0 {
+			b.WriteString("-- tags: " + strings.Join(s.Tags, ", ") + "\n")
+		}
+		b.WriteString("\n" + strings.TrimRight(s.Body, "\n") + "\n")
+		if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+			return i, err
+		}
+	}
+	return len(snippets), nil
+}
+
+// ImportSnippets reads the .sql files under dir, as written by ExportSnippets. The folder comes from the
+// file's directory and the name from its "-- name:" header, or its file name. A snippet with the same
+// folder and name is replaced. The files are imported in one transaction, so on an error nothing is.
+// It returns the number of snippets imported.
+func ImportSnippets(dir string) (int, error) {
+	if db == nil {
+		return 0, fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".sql") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(paths)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to import snippets: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return 0, err
+		}
+		s := parseSnippetFile(string(data))
+		if rel != "." {
+			s.Folder = filepath.ToSlash(rel)
+		}
+		if s.Name == "" {
+			s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		s.Folder = cleanFolder(s.Folder)
+		if err := tx.QueryRow(`SELECT id FROM pheri_snippets WHERE folder = ? AND name = ?`, s.Folder, s.Name).Scan(&s.ID); err != nil && err != sql.ErrNoRows {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		if _, err := saveSnippet(tx, s); err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to import snippets: %w", err)
+	}
+	return len(paths), nil
+}
+
+// A snippet file: "-- name:", "-- description:" and "-- tags:" header lines, then the body
+func parseSnippetFile(text string) Snippet {
+	var s Snippet
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	i := 0
+header:
+	for ; i < len(lines); i++ {
+		key, value, ok := strings.Cut(strings.TrimPrefix(lines[i], "--"), ":")
+		if !ok || !strings.HasPrefix(lines[i], "--") {
+			break
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "name":
+			s.Name = value
+		case "description":
+			s.Description = value
+		case "tags":
+			s.Tags = splitTags(value)
+		default:
+			break header
+		}
+	}
+	s.Body = strings.TrimSpace(strings.Join(lines[i:], "\n"))
+	return s
+}
+
+func splitTags(tags string) []string {
+	return cleanTags(strings.Split(tags, ","))
+}
+
+// Trimmed, lower-case and without duplicates or empty tags
+func cleanTags(tags []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out
+}
+
+// A folder path without empty, . or .. parts
+func cleanFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(strings.ReplaceAll(folder, `\`, "/"), "/") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// A snippet name as a file name; characters most file systems refuse become _, and so do
+// . and .., which would point outside the folder
+func fileName(name string) string {
+	if name == "." || name == ".." {
+		return strings.Repeat("_", len(name))
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
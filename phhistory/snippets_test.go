@@ -0,0 +1,152 @@
+package phhistory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestHistory(t *testing.T) {
+	t.Helper()
+	if err := InitPhHistory(filepath.Join(t.TempDir(), "history.db"), "root", "localhost", "3306"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		db = nil
+	})
+}
+
+func countSnippets(t *testing.T) int {
+	t.Helper()
+	snippets, err := ListSnippets("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(snippets)
+}
+
+func TestExportSnippetsFileNameCollisions(t *testing.T) {
+	openTestHistory(t)
+	for _, name := range []string{"a:b", "a?b", "Report", "report", "a_b (2)"} {
+		if _, err := SaveSnippet(Snippet{Folder: "Clashes", Name: name, Body: "SELECT '" + name + "'"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := countSnippets(t)
+
+	dir := t.TempDir()
+	count, err := ExportSnippets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != total {
+		t.Fatalf("exported %d snippets, want %d", count, total)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "Clashes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("Clashes holds %q, want 5 files", names)
+	}
+
+	// Every snippet comes back under its own name
+	for _, s := range mustList(t, "Clashes") {
+		if err := DeleteSnippet(s.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ImportSnippets(dir); err != nil {
+		t.Fatal(err)
+	}
+	bodies := map[string]string{}
+	for _, s := range mustList(t, "Clashes") {
+		bodies[s.Name] = s.Body
+	}
+	for _, name := range []string{"a:b", "a?b", "Report", "report", "a_b (2)"} {
+		if want := "SELECT '" + name + "'"; bodies[name] != want {
+			t.Errorf("%s imported as %q, want %q", name, bodies[name], want)
+		}
+	}
+	if got := countSnippets(t); got != total {
+		t.Fatalf("library holds %d snippets after the round trip, want %d", got, total)
+	}
+}
+
+func TestImportSnippetsAllOrNothing(t *testing.T) {
+	openTestHistory(t)
+	before := countSnippets(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a_good.sql":   "-- name: Good one\n\nSELECT 1",
+		"b_good.sql":   "SELECT 2",
+		"z_broken.sql": "-- name: not/allowed\n\nSELECT 3",
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count, err := ImportSnippets(dir); err == nil {
+		t.Fatalf("a snippet named not/allowed was imported, count %d", count)
+	}
+	if got := countSnippets(t); got != before {
+		t.Fatalf("library holds %d snippets after a failed import, want %d", got, before)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "z_broken.sql")); err != nil {
+		t.Fatal(err)
+	}
+	count, err := ImportSnippets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || countSnippets(t) != before+2 {
+		t.Fatalf("imported %d snippets, library went from %d to %d", count, before, countSnippets(t))
+	}
+}
+
+func mustList(t *testing.T, filter string) []Snippet {
+	t.Helper()
+	snippets, err := ListSnippets(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snippets
+}
+
+func TestSnippetDotNames(t *testing.T) {
+	openTestHistory(t)
+	for _, name := range []string{".", "..", " .. "} {
+		if _, err := SaveSnippet(Snippet{Name: name, Body: "SELECT 1"}); err == nil {
+			t.Errorf("a snippet named %q was saved", name)
+		}
+	}
+	for name, want := range map[string]string{".": "_", "..": "__", "...": "...", ".hidden": ".hidden", "a:b": "a_b"} {
+		if got := fileName(name); got != want {
+			t.Errorf("fileName(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	// Snippets stored before the check still export inside the directory
+	if _, err := db.Exec(`INSERT INTO pheri_snippets (folder, name, description, tags, body) VALUES ('', '..', '', '', 'SELECT 1')`); err != nil {
+		t.Fatal(err)
+	}
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "export")
+	if _, err := ExportSnippets(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "__.sql")); err != nil {
+		t.Fatalf("the snippet named .. was not exported as __.sql: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, ".sql")); !os.IsNotExist(err) {
+		t.Fatalf("the export wrote outside its directory: %v", err)
+	}
+}
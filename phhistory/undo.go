@@ -0,0 +1,227 @@
+package phhistory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operations recorded in the undo log; cell edits are the only changes recorded
+const (
+	OpUpdate = "UPDATE"
+)
+
+// UndoEntry is one data change made by pheri together with its before-image.
+// Before and After map column names to values; a nil value means SQL NULL.
+type UndoEntry struct {
+	ID         int64
+	SessionID  string
+	DBName     string
+	TableName  string
+	Operation  string
+	KeyColumns []string // primary key of the changed row, in key order
+	KeyValues  []string
+	Before     map[string]*string
+	After      map[string]*string
+	Undone     bool
+	CreatedAt  time.Time
+}
+
+// SessionID returns the identifier of the current pheri session
+func SessionID() string {
+	return sessionID
+}
+
+// SaveUndo records a change in the undo log of the current session
+func SaveUndo(entry UndoEntry) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+
+	before, err := json.Marshal(entry.Before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode before-image: %w", err)
+	}
+	after, err := json.Marshal(entry.After)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode after-image: %w", err)
+	}
+
+	if len(entry.KeyColumns) == 0 || len(entry.KeyColumns) != len(entry.KeyValues) {
+		return 0, fmt.Errorf("undo entry needs a value for every key column")
+	}
+	keyColumns, err := json.Marshal(entry.KeyColumns)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode key: %w", err)
+	}
+	keyValues, err := json.Marshal(entry.KeyValues)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	// key_column and key_value keep the first key part for older versions reading the log
+	res, err := db.Exec(`
+		INSERT INTO pheri_undo_log (session_id, host_ip, db_name, table_name, operation, key_column, key_value,
+			key_columns, key_values, before_image, after_image)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, sessionID, host, entry.DBName, entry.TableName, entry.Operation, entry.KeyColumns[0], entry.KeyValues[0],
+		string(keyColumns), string(keyValues), string(before), string(after))
+	if err != nil {
+		return 0, fmt.Errorf("failed to save undo entry: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// LastUndo returns the most recent change of this session that has not been undone yet
+func LastUndo() (*UndoEntry, error) {
+	entries, err := fetchUndo(`WHERE session_id = ? AND undone = 0 ORDER BY id DESC LIMIT 1`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// RecentUndo lists the latest changes of this session, newest first
+func RecentUndo(limit int) ([]UndoEntry, error) {
+	return fetchUndo(`WHERE session_id = ? ORDER BY id DESC LIMIT ?`, sessionID, limit)
+}
+
+// MarkUndone flags an entry as reverted so it is skipped by LastUndo
+func MarkUndone(id int64) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+	_, err := db.Exec(`UPDATE pheri_undo_log SET undone = 1 WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark undo entry: %w", err)
+	}
+	return nil
+}
+
+func fetchUndo(where string, args ...interface{}) ([]UndoEntry, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized, call InitPhHistory first")
+	}
+
+	rows, err := db.Query(`
+		SELECT id, session_id, db_name, table_name, operation, key_column, key_value, key_columns, key_values,
+			before_image, after_image, undone, created_at
+		FROM pheri_undo_log
+	`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read undo log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []UndoEntry
+	for rows.Next() {
+		var e UndoEntry
+		var keyColumn, keyValue, before, after string
+		var keyColumns, keyValues sql.NullString
+		if err := rows.Scan(&e.ID, &e.SessionID, &e.DBName, &e.TableName, &e.Operation, &keyColumn,
+			&keyValue, &keyColumns, &keyValues, &before, &after, &e.Undone, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		// Entries recorded by older versions have a single key column
+		e.KeyColumns, e.KeyValues = []string{keyColumn}, []string{keyValue}
+		if keyColumns.Valid && keyValues.Valid {
+			if err := json.Unmarshal([]byte(keyColumns.String), &e.KeyColumns); err != nil {
+				return nil, fmt.Errorf("corrupt key in undo entry %d: %w", e.ID, err)
+			}
+			if err := json.Unmarshal([]byte(keyValues.String), &e.KeyValues); err != nil {
+				return nil, fmt.Errorf("corrupt key in undo entry %d: %w", e.ID, err)
+			}
+		}
+		if err := json.Unmarshal([]byte(before), &e.Before); err != nil {
+			return nil, fmt.Errorf("corrupt before-image in undo entry %d: %w", e.ID, err)
+		}
+		if err := json.Unmarshal([]byte(after), &e.After); err != nil {
+			return nil, fmt.Errorf("corrupt after-image in undo entry %d: %w", e.ID, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Inverse builds the statement (with placeholders) that reverts the change. It only matches the row while
+// the changed columns still hold their after-image, so a value changed since is never overwritten.
+func (e UndoEntry) Inverse() (string, []interface{}, error) {
+	if e.Operation != OpUpdate {
+		return "", nil, fmt.Errorf("unsupported undo operation: %s", e.Operation)
+	}
+	cols := sortedColumns(e.Before)
+	if len(cols) == 0 {
+		return "", nil, fmt.Errorf("undo entry %d has an empty before-image", e.ID)
+	}
+	// If the key itself was edited, the row is now found under its new value
+	where, whereArgs, err := e.keyCondition(true)
+	if err != nil {
+		return "", nil, err
+	}
+	var sets []string
+	var args []interface{}
+	for _, col := range cols {
+		after, ok := e.After[col]
+		if !ok {
+			return "", nil, fmt.Errorf("undo entry %d has no after-image of %s", e.ID, col)
+		}
+		sets = append(sets, fmt.Sprintf("`%s` = ?", col))
+		args = append(args, nullable(e.Before[col]))
+		where += fmt.Sprintf(" AND `%s` <=> ?", col)
+		whereArgs = append(whereArgs, nullable(after))
+	}
+	table := fmt.Sprintf("`%s`.`%s`", e.DBName, e.TableName)
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(sets, ", "), where), append(args, whereArgs...), nil
+}
+
+// Condition matching the changed row on its full primary key; afterChange takes edited key parts
+// at their new value
+func (e UndoEntry) keyCondition(afterChange bool) (string, []interface{}, error) {
+	if len(e.KeyColumns) == 0 || len(e.KeyColumns) != len(e.KeyValues) {
+		return "", nil, fmt.Errorf("undo entry %d has no usable key", e.ID)
+	}
+	var conds []string
+	var args []interface{}
+	for i, col := range e.KeyColumns {
+		value := e.KeyValues[i]
+		if v, ok := e.After[col]; afterChange && ok && v != nil {
+			value = *v
+		}
+		conds = append(conds, fmt.Sprintf("`%s` = ?", col))
+		args = append(args, value)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// Key describes the changed row's key as col=value pairs
+func (e UndoEntry) Key() string {
+	var parts []string
+	for i, col := range e.KeyColumns {
+		if i < len(e.KeyValues) {
+			parts = append(parts, col+"="+e.KeyValues[i])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sortedColumns(image map[string]*string) []string {
+	cols := make([]string, 0, len(image))
+	for col := range image {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+func nullable(v *string) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
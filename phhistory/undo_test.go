@@ -0,0 +1,169 @@
+package phhistory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestUndoEntryInverse(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     UndoEntry
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name: "single key",
+			entry: UndoEntry{DBName: "shop", TableName: "customers", Operation: OpUpdate,
+				KeyColumns: []string{"id"}, KeyValues: []string{"7"},
+				Before: map[string]*string{"name": strPtr("Ann")}, After: map[string]*string{"name": strPtr("Anne")}},
+			wantQuery: "UPDATE `shop`.`customers` SET `name` = ? WHERE `id` = ? AND `name` <=> ?",
+			wantArgs:  []interface{}{"Ann", "7", "Anne"},
+		},
+		{
+			name: "composite key",
+			entry: UndoEntry{DBName: "shop", TableName: "order_items", Operation: OpUpdate,
+				KeyColumns: []string{"order_id", "line"}, KeyValues: []string{"10", "2"},
+				Before: map[string]*string{"qty": strPtr("1")}, After: map[string]*string{"qty": strPtr("3")}},
+			wantQuery: "UPDATE `shop`.`order_items` SET `qty` = ? WHERE `order_id` = ? AND `line` = ? AND `qty` <=> ?",
+			wantArgs:  []interface{}{"1", "10", "2", "3"},
+		},
+		{
+			name: "edited key column is found under its new value",
+			entry: UndoEntry{DBName: "shop", TableName: "order_items", Operation: OpUpdate,
+				KeyColumns: []string{"order_id", "line"}, KeyValues: []string{"10", "2"},
+				Before: map[string]*string{"line": strPtr("2")}, After: map[string]*string{"line": strPtr("5")}},
+			wantQuery: "UPDATE `shop`.`order_items` SET `line` = ? WHERE `order_id` = ? AND `line` = ? AND `line` <=> ?",
+			wantArgs:  []interface{}{"2", "10", "5", "5"},
+		},
+		{
+			name: "NULL before-image",
+			entry: UndoEntry{DBName: "shop", TableName: "orders", Operation: OpUpdate,
+				KeyColumns: []string{"id"}, KeyValues: []string{"1"},
+				Before: map[string]*string{"customer_id": nil}, After: map[string]*string{"customer_id": strPtr("4")}},
+			wantQuery: "UPDATE `shop`.`orders` SET `customer_id` = ? WHERE `id` = ? AND `customer_id` <=> ?",
+			wantArgs:  []interface{}{nil, "1", "4"},
+		},
+		{
+			name: "NULL after-image",
+			entry: UndoEntry{DBName: "shop", TableName: "orders", Operation: OpUpdate,
+				KeyColumns: []string{"id"}, KeyValues: []string{"1"},
+				Before: map[string]*string{"customer_id": strPtr("4")}, After: map[string]*string{"customer_id": nil}},
+			wantQuery: "UPDATE `shop`.`orders` SET `customer_id` = ? WHERE `id` = ? AND `customer_id` <=> ?",
+			wantArgs:  []interface{}{"4", "1", nil},
+		},
+		{
+			name: "several columns in name order",
+			entry: UndoEntry{DBName: "d", TableName: "t", Operation: OpUpdate,
+				KeyColumns: []string{"id"}, KeyValues: []string{"1"},
+				Before: map[string]*string{"b": strPtr("b0"), "a": strPtr("a0")},
+				After:  map[string]*string{"b": strPtr("b1"), "a": strPtr("a1")}},
+			wantQuery: "UPDATE `d`.`t` SET `a` = ?, `b` = ? WHERE `id` = ? AND `a` <=> ? AND `b` <=> ?",
+			wantArgs:  []interface{}{"a0", "b0", "1", "a1", "b1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := tt.entry.Inverse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.wantQuery {
+				t.Fatalf("query = %s\nwant    %s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestUndoEntryInverseErrors(t *testing.T) {
+	key := func(e UndoEntry) UndoEntry {
+		e.DBName, e.TableName = "d", "t"
+		if e.Operation == "" {
+			e.Operation = OpUpdate
+		}
+		return e
+	}
+	tests := []struct {
+		name  string
+		entry UndoEntry
+	}{
+		{"unknown operation", key(UndoEntry{Operation: "DELETE", KeyColumns: []string{"id"}, KeyValues: []string{"1"},
+			Before: map[string]*string{"a": strPtr("x")}})},
+		{"empty before-image", key(UndoEntry{KeyColumns: []string{"id"}, KeyValues: []string{"1"}})},
+		{"no key", key(UndoEntry{Before: map[string]*string{"a": strPtr("x")}, After: map[string]*string{"a": strPtr("y")}})},
+		{"key values missing", key(UndoEntry{KeyColumns: []string{"a", "b"}, KeyValues: []string{"1"},
+			Before: map[string]*string{"c": strPtr("x")}, After: map[string]*string{"c": strPtr("y")}})},
+		{"no after-image", key(UndoEntry{KeyColumns: []string{"id"}, KeyValues: []string{"1"},
+			Before: map[string]*string{"a": strPtr("x")}})},
+	}
+	for _, tt := range tests {
+		if query, _, err := tt.entry.Inverse(); err == nil {
+			t.Errorf("%s: built %s, want an error", tt.name, query)
+		}
+	}
+}
+
+func TestUndoEntryKeyCondition(t *testing.T) {
+	e := UndoEntry{
+		KeyColumns: []string{"tenant", "id"},
+		KeyValues:  []string{"acme", "42"},
+		After:      map[string]*string{"id": strPtr("43"), "tenant": nil},
+	}
+	tests := []struct {
+		afterChange bool
+		want        []interface{}
+	}{
+		{false, []interface{}{"acme", "42"}},
+		// A key part changed to NULL cannot have been stored, so the recorded value is kept
+		{true, []interface{}{"acme", "43"}},
+	}
+	for _, tt := range tests {
+		where, args, err := e.keyCondition(tt.afterChange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "`tenant` = ? AND `id` = ?"; where != want {
+			t.Errorf("keyCondition(%v) = %s, want %s", tt.afterChange, where, want)
+		}
+		if !reflect.DeepEqual(args, tt.want) {
+			t.Errorf("keyCondition(%v) args = %#v, want %#v", tt.afterChange, args, tt.want)
+		}
+	}
+	if got := e.Key(); got != "tenant=acme, id=42" {
+		t.Errorf("Key() = %s", got)
+	}
+}
+
+func TestUndoLogRoundTrip(t *testing.T) {
+	openTestHistory(t)
+	entry := UndoEntry{DBName: "shop", TableName: "order_items", Operation: OpUpdate,
+		KeyColumns: []string{"order_id", "line"}, KeyValues: []string{"10", "2"},
+		Before: map[string]*string{"note": nil}, After: map[string]*string{"note": strPtr("gift")}}
+	id, err := SaveUndo(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := LastUndo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.ID != id {
+		t.Fatalf("LastUndo = %+v, want entry %d", last, id)
+	}
+	if !reflect.DeepEqual(last.KeyColumns, entry.KeyColumns) || !reflect.DeepEqual(last.KeyValues, entry.KeyValues) ||
+		last.Before["note"] != nil || *last.After["note"] != "gift" {
+		t.Fatalf("read back %+v, want %+v", last, entry)
+	}
+
+	if err := MarkUndone(id); err != nil {
+		t.Fatal(err)
+	}
+	if last, err := LastUndo(); err != nil || last != nil {
+		t.Fatalf("LastUndo after MarkUndone = %+v, %v", last, err)
+	}
+}
@@ -2,22 +2,20 @@
 package ui
 
 import (
-	"bufio"
-	"compress/gzip"
+	"context"
 	"database/sql"
 	"fmt"
 	"io/fs"
 	"log"
+	"mysql-tui/dump"
 	"mysql-tui/phhistory"
 	"mysql-tui/util"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/atotto/clipboard"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
@@ -27,10 +25,7 @@ var dataBaseList *tview.List
 var allDatabases []string
 
 // var allTables []string
-type DBObject struct {
-	Name string
-	Type string
-}
+type DBObject = dump.Object
 
 var allTables []DBObject
 
@@ -38,6 +33,10 @@ var mainFlex *tview.Flex
 var fileNameInput *tview.InputField
 
 var isEditingEnabled bool = false
+var lastExecutedQuery string
+var lastExecutedArgs []interface{}
+var lastResultColumns []*sql.ColumnType
+var lastQueryRun phhistory.QueryRun // how the latest ExecuteQuery went, for the history
 var searchFiltertext string
 var IsSearchStateEnabled = false
 
@@ -98,6 +97,8 @@ func filterTableList(
 						"VIEW":      1,
 						"FUNCTION":  2,
 						"PROCEDURE": 3,
+						"TRIGGER":   4,
+						"EVENT":     5,
 					}
 
 					sort.Slice(allTables, func(i, j int) bool {
@@ -105,135 +106,7 @@ func filterTableList(
 					})
 					app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 						if event.Key() == tcell.KeyCtrlX {
-							if objType == "TABLE" {
-								// Step 1: Get the table's DDL (definition)
-
-								query := "SHOW CREATE TABLE " + objName
-								row, err := db.Query(query)
-								if err != nil {
-									showErrorModal(app, mainFlex, "Failed to fetch table definition: "+err.Error())
-									return nil
-								}
-								defer row.Close()
-
-								var tableName, createStatement string
-								if row.Next() {
-									err := row.Scan(&tableName, &createStatement)
-									if err != nil {
-										showErrorModal(app, mainFlex, "Scan failed: "+err.Error())
-										return nil
-									}
-
-									// Step 2: Copy the table's DDL (definition) to the clipboard
-									err = clipboard.WriteAll(createStatement + ";")
-									if err != nil {
-										showErrorModal(app, mainFlex, "Failed to copy DDL to clipboard: "+err.Error())
-										return nil
-									}
-
-									// Step 3: Get the table data (rows)
-									db.Exec("USE " + dbName)
-									dataQuery := "SELECT * FROM " + objName
-									rows, err := db.Query(dataQuery)
-									if err != nil {
-										showErrorModal(app, mainFlex, "Failed to fetch table data: "+err.Error())
-										return nil
-									}
-									defer rows.Close()
-
-									// Fetch column names
-									columns, err := rows.Columns()
-									if err != nil {
-										showErrorModal(app, mainFlex, "Failed to get columns: "+err.Error())
-										return nil
-									}
-
-									var insertStatements []string
-									for rows.Next() {
-										values := make([]interface{}, len(columns))
-										pointers := make([]interface{}, len(columns))
-										for i := range values {
-											pointers[i] = &values[i]
-										}
-
-										err := rows.Scan(pointers...)
-										if err != nil {
-											showErrorModal(app, mainFlex, "Failed to scan row: "+err.Error())
-											return nil
-										}
-
-										// Build the insert statement for the current row
-										var valuesList []string
-										for _, val := range values {
-											if val != nil {
-												switch v := val.(type) {
-												case []byte:
-													valuesList = append(valuesList, fmt.Sprintf("'%s'", string(v)))
-												default:
-													valuesList = append(valuesList, fmt.Sprintf("'%v'", v))
-												}
-											} else {
-												valuesList = append(valuesList, "NULL")
-											}
-										}
-
-										insertStatement := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", objName, strings.Join(columns, ", "), strings.Join(valuesList, ", "))
-										insertStatements = append(insertStatements, insertStatement)
-									}
-
-									// Step 4: Join all insert statements and copy them to clipboard
-									dataString := strings.Join(insertStatements, "\n")
-
-									clipboardText := util.GetClipboardText()
-									err = clipboard.WriteAll(clipboardText + "\n" + dataString)
-									if err != nil {
-										showErrorModal(app, mainFlex, "Failed to copy data to clipboard: "+err.Error())
-										return nil
-									}
-
-									// Optional: Show a confirmation modal
-									modal := tview.NewModal().
-										SetText("Table definition and data copied to clipboard as SQL INSERT statements.").
-										AddButtons([]string{"OK"}).
-										SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-											layout := CreateLayoutWithFooter(app, mainFlex)
-											app.SetRoot(layout, true)
-										})
-									app.SetRoot(modal, true)
-								}
-							}
-
-							if objType == "VIEW" {
-								query := "SHOW CREATE VIEW " + objName
-								row, err := db.Query(query)
-								if err != nil {
-									showErrorModal(app, mainFlex, "Failed to fetch view definition: "+err.Error())
-									return nil
-								}
-								defer row.Close()
-
-								var viewName, createStatement, charset, collation string
-								if row.Next() {
-									err := row.Scan(&viewName, &createStatement, &charset, &collation)
-									if err != nil {
-										showErrorModal(app, mainFlex, "Scan failed: "+err.Error())
-										return nil
-									}
-
-									// Copy the CREATE VIEW statement to clipboard
-									clipboard.WriteAll(createStatement)
-
-									modal := tview.NewModal().
-										SetText("View definition copied to clipboard.").
-										AddButtons([]string{"OK"}).
-										SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-											layout := CreateLayoutWithFooter(app, mainFlex)
-											app.SetRoot(layout, true)
-										})
-									app.SetRoot(modal, true)
-								}
-							}
-
+							copyObjectSQL(app, db, dbName, objName, objType)
 							return nil
 						}
 						return event
@@ -271,6 +144,9 @@ func filterTableList(
 								app.SetRoot(modal, true)
 								return
 							}
+							startGridTrail(db, dbName, objName, query, dataTable)
+						} else {
+							clearGridTrail()
 						}
 						app.SetFocus(dataTable)
 					case "PROCEDURE":
@@ -321,6 +197,14 @@ func filterTableList(
 
 						queryBox.SetText(routineDefinition, true)
 						app.SetFocus(queryBox)
+					case "TRIGGER", "EVENT":
+						create, err := dump.ShowCreate(db, objType, objName)
+						if err != nil {
+							showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "Failed to read definition: "+err.Error())
+							return
+						}
+						queryBox.SetText(create.Statement, true)
+						app.SetFocus(queryBox)
 					}
 				})
 			}
@@ -519,101 +403,6 @@ func buildCreateProcedureSQL(metadata RoutineMetadata, params []Parameter, db *s
 	return sqlStmt
 }
 
-var sqlTemplates = []string{
-	// --- DATABASE CREATION ---
-	"CREATE DATABASE company_db",
-	"DROP DATABASE old_company_db",
-
-	// --- TABLE CREATION & MODIFICATION ---
-	"CREATE TABLE employees (id INT PRIMARY KEY AUTO_INCREMENT, name VARCHAR(100), age INT, department_id INT, hire_date DATE)",
-	"ALTER TABLE employees ADD COLUMN salary DECIMAL(10,2)",
-	"ALTER TABLE employees DROP COLUMN middle_name",
-	"ALTER TABLE employees RENAME TO staff",
-	"ALTER TABLE employees MODIFY age SMALLINT",
-	"ALTER TABLE employees ADD CONSTRAINT fk_department FOREIGN KEY (department_id) REFERENCES departments(id)",
-	"DROP TABLE employees",
-	"TRUNCATE TABLE logs",
-
-	// --- INDEXES ---
-	"CREATE INDEX idx_emp_name ON employees (name)",
-	"CREATE UNIQUE INDEX idx_users_email ON users (email)",
-	"DROP INDEX idx_emp_name ON employees",
-
-	// --- INSERT DATA ---
-	"INSERT INTO employees (name, age, department_id) VALUES ('John Doe', 30, 2)",
-	"INSERT INTO departments (id, name) VALUES (1, 'HR'), (2, 'Engineering')",
-	"INSERT INTO archive_employees (id, name) SELECT id, name FROM employees WHERE status = 'inactive'",
-
-	// --- DELETE & UPDATE DATA ---
-	"DELETE FROM employees WHERE department_id = 5",
-	"DELETE FROM employees",
-	"UPDATE employees SET salary = salary + 1000 WHERE performance = 'excellent'",
-
-	// --- SIMPLE SELECT ---
-	"SELECT * FROM employees",
-	"SELECT name, age FROM employees WHERE department_id = 2",
-	"SELECT name FROM employees ORDER BY hire_date DESC",
-	"SELECT DISTINCT job_title FROM employees",
-	"SELECT * FROM employees LIMIT 10 OFFSET 5",
-
-	// --- SELECT WITH CONDITIONS ---
-	"WHERE age > 25",
-	"WHERE name LIKE 'J%'",
-	"WHERE salary BETWEEN 30000 AND 50000",
-	"WHERE department_id IN (1, 2, 3)",
-	"WHERE hire_date IS NOT NULL",
-
-	// --- AGGREGATES & GROUPING ---
-	"SELECT COUNT(*) FROM employees",
-	"SELECT AVG(salary) FROM employees WHERE department_id = 2",
-	"SELECT department_id, SUM(salary) FROM employees GROUP BY department_id",
-	"SELECT department_id, COUNT(*) FROM employees GROUP BY department_id",
-	"SELECT department_id, AVG(salary) FROM employees GROUP BY department_id HAVING AVG(salary) > 50000",
-
-	// --- JOIN OPERATIONS ---
-	"SELECT e.name, d.name FROM employees e INNER JOIN departments d ON e.department_id = d.id",
-	"SELECT e.name, d.name FROM employees e LEFT JOIN departments d ON e.department_id = d.id",
-	"SELECT e.name, d.name FROM employees e RIGHT JOIN departments d ON e.department_id = d.id",
-	"SELECT e.name, d.name FROM employees e FULL OUTER JOIN departments d ON e.department_id = d.id", // (if supported)
-
-	// --- SUBQUERIES ---
-	"SELECT name FROM employees WHERE department_id = (SELECT id FROM departments WHERE name = 'Engineering')",
-	"SELECT name FROM employees WHERE salary > (SELECT AVG(salary) FROM employees)",
-
-	// --- ORDER / LIMIT / OFFSET ---
-	"ORDER BY hire_date DESC",
-	"LIMIT 10",
-	"OFFSET 20",
-
-	// --- VIEWS ---
-	"CREATE VIEW active_employees AS SELECT id, name FROM employees WHERE status = 'active'",
-
-	// --- TRANSACTIONS ---
-	"START TRANSACTION",
-	"COMMIT",
-	"ROLLBACK",
-
-	// --- USER & PERMISSIONS (MySQL Specific) ---
-	"CREATE USER 'user1'@'localhost' IDENTIFIED BY 'password123'",
-	"GRANT SELECT, INSERT ON company_db.* TO 'user1'@'localhost'",
-	"REVOKE INSERT ON company_db.* FROM 'user1'@'localhost'",
-	"DROP USER 'user1'@'localhost'",
-
-	// --- STORED PROCEDURE TEMPLATE ---
-	`DELIMITER //
-	CREATE PROCEDURE GetEmployeeByID(IN emp_id INT)
-	BEGIN
-		SELECT * FROM employees WHERE id = emp_id;
-	END //
-	DELIMITER ;`,
-
-	// --- TRIGGER TEMPLATE ---
-	`CREATE TRIGGER before_insert_employee
-	BEFORE INSERT ON employees
-	FOR EACH ROW
-	SET NEW.hire_date = NOW();`,
-}
-
 var sqlKeywords = []string{
 	// DML (Data Manipulation Language)
 	"SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "CALL", "EXPLAIN", "LOCK",
@@ -686,311 +475,6 @@ func showErrorModal(app *tview.Application, layout tview.Primitive, message stri
 	app.SetRoot(modal, true)
 }
 
-func exportAllObjects(outputFile string, progressChan chan string, dbName string) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", User, Pass, Host, Port, dbName)
-
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		progressChan <- fmt.Sprintf("[red]Failed to connect to DB: %v", err)
-		close(progressChan)
-		return
-	}
-	defer db.Close()
-
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Minute * 5)
-
-	// Set up multiple writers
-	type fileWriters struct {
-		table, view, viewddl, procedure, function *bufio.Writer
-		tableFile, viewFile, viewddlFile          *os.File
-		procedureFile, functionFile               *os.File
-		tableGzip, viewGzip, viewddlGzip          *gzip.Writer
-		procedureGzip, functionGzip               *gzip.Writer
-	}
-
-	fw := &fileWriters{}
-
-	openGz := func(suffix string) (*os.File, *gzip.Writer, *bufio.Writer, error) {
-		f, err := os.Create(fmt.Sprintf("%s_%s.gz", outputFile, suffix))
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		gz := gzip.NewWriter(f)
-		buf := bufio.NewWriter(gz)
-		return f, gz, buf, nil
-	}
-
-	if fw.tableFile, fw.tableGzip, fw.table, err = openGz("table"); err != nil {
-		progressChan <- fmt.Sprintf("[red]Failed to open table file: %v", err)
-		close(progressChan)
-		return
-	}
-	if fw.viewFile, fw.viewGzip, fw.view, err = openGz("view"); err != nil {
-		progressChan <- fmt.Sprintf("[red]Failed to open view file: %v", err)
-		close(progressChan)
-		return
-	}
-	if fw.viewddlFile, fw.viewddlGzip, fw.viewddl, err = openGz("viewddl"); err != nil {
-		progressChan <- fmt.Sprintf("[red]Failed to open viewddl file: %v", err)
-		close(progressChan)
-		return
-	}
-
-	if fw.procedureFile, fw.procedureGzip, fw.procedure, err = openGz("procedure"); err != nil {
-		progressChan <- fmt.Sprintf("[red]Failed to open procedure file: %v", err)
-		close(progressChan)
-		return
-	}
-	if fw.functionFile, fw.functionGzip, fw.function, err = openGz("function"); err != nil {
-		progressChan <- fmt.Sprintf("[red]Failed to open function file: %v", err)
-		close(progressChan)
-		return
-	}
-
-	defer func() {
-		fw.table.Flush()
-		fw.tableGzip.Close()
-		fw.tableFile.Close()
-
-		fw.view.Flush()
-		fw.viewGzip.Close()
-		fw.viewFile.Close()
-
-		fw.viewddl.Flush()
-		fw.viewddlGzip.Close()
-		fw.viewddlFile.Close()
-
-		fw.procedure.Flush()
-		fw.procedureGzip.Close()
-		fw.procedureFile.Close()
-
-		fw.function.Flush()
-		fw.functionGzip.Close()
-		fw.functionFile.Close()
-	}()
-
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-
-	workerCount := 10
-	tasks := make(chan DBObject, len(allTables))
-
-	for w := 0; w < workerCount; w++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for obj := range tasks {
-				var ddl string
-				var writer *bufio.Writer
-				var writerddl *bufio.Writer
-
-				for i := 0; i < 3; i++ {
-					if err := db.Ping(); err == nil {
-						break
-					}
-					time.Sleep(2 * time.Second)
-				}
-
-				switch obj.Type {
-				case "TABLE":
-					writer = fw.table
-					const insertBatchSize = 1000
-					var table, createStmt string
-					row := db.QueryRow(fmt.Sprintf("SHOW CREATE TABLE `%s`", obj.Name))
-					if err := row.Scan(&table, &createStmt); err != nil {
-						progressChan <- fmt.Sprintf("[yellow]Failed to export TABLE: %s - %v", obj.Name, err)
-						continue
-					}
-					ddl = createStmt
-
-					rows, err := db.Query(fmt.Sprintf("SELECT * FROM `%s`", obj.Name))
-					if err != nil {
-						progressChan <- fmt.Sprintf("[yellow]Failed to select data from TABLE: %s - %v", obj.Name, err)
-						continue
-					}
-					defer rows.Close()
-
-					cols, _ := rows.Columns()
-					colCount := len(cols)
-					values := make([]interface{}, colCount)
-					valuePtrs := make([]interface{}, colCount)
-					colList := "`" + strings.Join(cols, "`, `") + "`"
-
-					var valueRows []string
-					rowCount := 0
-
-					mu.Lock()
-					writer.WriteString("-- ----------------------------\n")
-					writer.WriteString(fmt.Sprintf("-- TABLE: %s\n", obj.Name))
-					writer.WriteString("-- ----------------------------\n")
-					writer.WriteString(ddl + ";\n\n")
-					writer.WriteString("-- DATA\n")
-					mu.Unlock()
-
-					for rows.Next() {
-						for i := range values {
-							valuePtrs[i] = &values[i]
-						}
-						err := rows.Scan(valuePtrs...)
-						if err != nil {
-							continue
-						}
-
-						var valStrings []string
-						for _, val := range values {
-							switch v := val.(type) {
-							case nil:
-								valStrings = append(valStrings, "NULL")
-							case []byte:
-								valStrings = append(valStrings, fmt.Sprintf("'%s'", escapeString(string(v))))
-							case string:
-								valStrings = append(valStrings, fmt.Sprintf("'%s'", escapeString(v)))
-							default:
-								valStrings = append(valStrings, fmt.Sprintf("'%v'", v))
-							}
-						}
-
-						valueRows = append(valueRows, fmt.Sprintf("(%s)", strings.Join(valStrings, ", ")))
-						rowCount++
-
-						if rowCount >= insertBatchSize {
-							mu.Lock()
-							writer.WriteString(fmt.Sprintf("INSERT INTO `%s` (%s) VALUES\n", obj.Name, colList))
-							writer.WriteString(strings.Join(valueRows, ",\n") + ";\n\n")
-							mu.Unlock()
-
-							valueRows = valueRows[:0]
-							rowCount = 0
-						}
-					}
-
-					if len(valueRows) > 0 {
-						mu.Lock()
-						writer.WriteString(fmt.Sprintf("INSERT INTO `%s` (%s) VALUES\n", obj.Name, colList))
-						writer.WriteString(strings.Join(valueRows, ",\n") + ";\n\n")
-						mu.Unlock()
-					}
-
-				case "VIEW":
-					writerddl = fw.viewddl
-					columnQuery := fmt.Sprintf("SELECT * FROM `%s` LIMIT 0", obj.Name)
-					rowsddl, err := db.Query(columnQuery)
-					if err != nil {
-						progressChan <- fmt.Sprintf("[yellow]Failed to select data from VIEW: %s - %v", obj.Name, err)
-						continue
-					}
-					cols, err := rowsddl.ColumnTypes()
-					rowsddl.Close()
-					if err != nil {
-						progressChan <- fmt.Sprintf("[yellow]Failed to get column types from VIEW: %s - %v", obj.Name, err)
-						continue
-					}
-					var structBuilder strings.Builder
-					structBuilder.WriteString("-- ----------------------------\n")
-					structBuilder.WriteString(fmt.Sprintf("--  STRUCTURE (DUMMY TABLE FOR VIEW): %s\n", obj.Name))
-					structBuilder.WriteString("-- ----------------------------\n")
-					structBuilder.WriteString(fmt.Sprintf("CREATE TABLE `%s` (\n", obj.Name))
-					for i, col := range cols {
-						colName := col.Name()
-						colType := col.DatabaseTypeName()
-						nullable, _ := col.Nullable()
-						nullStr := "NOT NULL"
-						if nullable {
-							nullStr = "NULL"
-						}
-
-						colDef := fmt.Sprintf("  `%s` %s %s", colName, mapSQLType(colType), nullStr)
-
-						if i < len(cols)-1 {
-							colDef += ",\n"
-
-						} else {
-							colDef += "\n"
-						}
-						structBuilder.WriteString(colDef)
-					}
-					structBuilder.WriteString(");\n\n")
-					writer = fw.view
-					var view, createStmt, charset, collation string
-					row := db.QueryRow(fmt.Sprintf("SHOW CREATE VIEW `%s`", obj.Name))
-					if err := row.Scan(&view, &createStmt, &charset, &collation); err != nil {
-						progressChan <- fmt.Sprintf("[yellow]Failed to export VIEW: %s - %v", obj.Name, err)
-						continue
-					}
-					ddl = createStmt
-
-					mu.Lock()
-					writerddl.WriteString(structBuilder.String())
-					writerddl.Flush()
-					writer.WriteString("-- ----------------------------\n")
-					writer.WriteString(fmt.Sprintf("-- VIEW: %s\n", obj.Name))
-					writer.WriteString("-- ----------------------------\n")
-					writer.WriteString("DROP TABLE IF EXISTS `" + obj.Name + "`;\n")
-					writer.WriteString(ddl + ";\n\n")
-					writer.Flush()
-					mu.Unlock()
-
-				case "PROCEDURE", "FUNCTION":
-					if obj.Type == "PROCEDURE" {
-						writer = fw.procedure
-					} else {
-						writer = fw.function
-					}
-
-					var name, sqlMode, createStmt, charset, collation, dbCollation string
-					row := db.QueryRow(fmt.Sprintf("SHOW CREATE %s `%s`", obj.Type, obj.Name))
-					if err := row.Scan(&name, &sqlMode, &createStmt, &charset, &collation, &dbCollation); err != nil {
-						progressChan <- fmt.Sprintf("[yellow]Failed to export %s: %s - %v", obj.Type, obj.Name, err)
-						continue
-					}
-					ddl = createStmt
-
-					mu.Lock()
-					writer.WriteString("-- ----------------------------\n")
-					writer.WriteString(fmt.Sprintf("-- %s: %s\n", obj.Type, obj.Name))
-					writer.WriteString("-- ----------------------------\n")
-					writer.WriteString("DELIMITER //\n")
-					writer.WriteString(ddl + ";\n\n")
-					writer.WriteString("// \nDELIMITER ;\n")
-					mu.Unlock()
-				}
-
-				progressChan <- fmt.Sprintf("[green]Exported %s: %s", obj.Type, obj.Name)
-				time.Sleep(50 * time.Millisecond)
-			}
-		}()
-	}
-
-	for _, obj := range allTables {
-		tasks <- obj
-	}
-	close(tasks)
-
-	wg.Wait()
-	close(progressChan)
-}
-
-func mapSQLType(mysqlType string) string {
-	switch strings.ToUpper(mysqlType) {
-	case "VARCHAR", "TEXT", "CHAR":
-		return "VARCHAR(1)"
-	case "INT", "INTEGER", "SMALLINT", "TINYINT", "MEDIUMINT", "BIGINT":
-		return "INT(11)"
-	case "DECIMAL", "NUMERIC", "FLOAT", "DOUBLE":
-		return "DECIMAL(10,2)"
-	case "DATE":
-		return "DATE"
-	case "DATETIME", "TIMESTAMP":
-		return "DATETIME"
-	case "BLOB", "LONGBLOB", "MEDIUMBLOB":
-		return "BLOB"
-	default:
-		return "VARCHAR(1)"
-	}
-}
-
 // func exportAllObjects(outputFile string, progressChan chan string, dbName string) {
 // 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", User, Pass, Host, Port, dbName)
 
@@ -1261,14 +745,6 @@ func mapSQLType(mysqlType string) string {
 // 	return str
 // }
 
-func escapeString(str string) string {
-	str = strings.ReplaceAll(str, "'", "''") // Escape single quotes
-	str = strings.ReplaceAll(str, "\n", "")  // Remove newlines (Unix-style)
-	str = strings.ReplaceAll(str, "\r", "")  // Remove carriage returns (Windows-style)
-	str = strings.ReplaceAll(str, "\t", "")  // Optional: remove tabs if present
-	return str
-}
-
 // func exportAllObjects(outputFile string, progressChan chan string, dbName string) {
 // 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", "root", "12345678", "127.0.0.1", "3306", dbName)
 
@@ -1678,7 +1154,15 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 						UNION ALL
 						SELECT routine_name AS name, 'FUNCTION' AS type 
 						FROM information_schema.routines 
-						WHERE routine_schema = '` + dbName + `' AND routine_type = 'FUNCTION';`
+						WHERE routine_schema = '` + dbName + `' AND routine_type = 'FUNCTION'
+						UNION ALL
+						SELECT trigger_name AS name, 'TRIGGER' AS type 
+						FROM information_schema.triggers 
+						WHERE trigger_schema = '` + dbName + `'
+						UNION ALL
+						SELECT event_name AS name, 'EVENT' AS type 
+						FROM information_schema.events 
+						WHERE event_schema = '` + dbName + `';`
 	util.SaveLog("queryAllStructure: " + queryAllStructure)
 	rows, err := db.Query(queryAllStructure)
 	if err != nil {
@@ -1754,6 +1238,8 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 					"VIEW":      1,
 					"FUNCTION":  2,
 					"PROCEDURE": 3,
+					"TRIGGER":   4,
+					"EVENT":     5,
 				}
 
 				sort.Slice(allTables, func(i, j int) bool {
@@ -1762,176 +1248,12 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 				app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 
 					if event.Key() == tcell.KeyCtrlY {
-
-						go func() {
-							progressChan := make(chan string)
-
-							go func() {
-								for msg := range progressChan {
-									util.SaveLog(msg)
-								}
-							}()
-							app.QueueUpdateDraw(func() {
-								progressView.SetText("[blue]Starting export...\n")
-								app.SetRoot(progressView, true)
-							})
-
-							util.SaveLog(fmt.Sprintf("Exporting %d objects...\n", len(allTables)))
-
-							go exportAllObjects("backup.sql", progressChan, dbName)
-
-							// Read from progress channel and update UI
-							go func() {
-								for msg := range progressChan {
-									app.QueueUpdateDraw(func() {
-										fmt.Fprintln(progressView, msg)
-									})
-								}
-
-								// After export is done
-								app.QueueUpdateDraw(func() {
-									modal := tview.NewModal().
-										SetText("Export completed successfully!").
-										AddButtons([]string{"OK"}).
-										SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-											app.SetRoot(mainFlex, true)
-										})
-									app.SetRoot(modal, true)
-								})
-							}()
-						}()
+						showExportDialog(app, progressView, dbName)
 						return nil
 					}
 
 					if event.Key() == tcell.KeyCtrlX {
-						if currentobjectType == "TABLE" {
-							// Step 1: Get the table's DDL (definition)
-
-							query := "SHOW CREATE TABLE " + currentName
-							row, err := db.Query(query)
-							if err != nil {
-								showErrorModal(app, mainFlex, "Failed to fetch table definition: "+err.Error())
-								return nil
-							}
-							defer row.Close()
-
-							var tableName, createStatement string
-							if row.Next() {
-								err := row.Scan(&tableName, &createStatement)
-								if err != nil {
-									showErrorModal(app, mainFlex, "Scan failed: "+err.Error())
-									return nil
-								}
-
-								// Step 2: Copy the table's DDL (definition) to the clipboard
-								err = clipboard.WriteAll(createStatement)
-								if err != nil {
-									showErrorModal(app, mainFlex, "Failed to copy DDL to clipboard: "+err.Error())
-									return nil
-								}
-
-								// Step 3: Get the table data (rows)
-								db.Exec("USE " + dbName)
-								dataQuery := "SELECT * FROM " + currentName
-								rows, err := db.Query(dataQuery)
-								if err != nil {
-									showErrorModal(app, mainFlex, "Failed to fetch table data: "+err.Error())
-									return nil
-								}
-								defer rows.Close()
-
-								// Fetch column names
-								columns, err := rows.Columns()
-								if err != nil {
-									showErrorModal(app, mainFlex, "Failed to get columns: "+err.Error())
-									return nil
-								}
-
-								var insertStatements []string
-								for rows.Next() {
-									values := make([]interface{}, len(columns))
-									pointers := make([]interface{}, len(columns))
-									for i := range values {
-										pointers[i] = &values[i]
-									}
-
-									err := rows.Scan(pointers...)
-									if err != nil {
-										showErrorModal(app, mainFlex, "Failed to scan row: "+err.Error())
-										return nil
-									}
-
-									// Build the insert statement for the current row
-									var valuesList []string
-									for _, val := range values {
-										if val != nil {
-											switch v := val.(type) {
-											case []byte:
-												valuesList = append(valuesList, fmt.Sprintf("'%s'", string(v)))
-											default:
-												valuesList = append(valuesList, fmt.Sprintf("'%v'", v))
-											}
-										} else {
-											valuesList = append(valuesList, "NULL")
-										}
-									}
-
-									insertStatement := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", currentName, strings.Join(columns, ", "), strings.Join(valuesList, ", "))
-									insertStatements = append(insertStatements, insertStatement)
-								}
-
-								// Step 4: Join all insert statements and copy them to clipboard
-								dataString := strings.Join(insertStatements, "\n")
-
-								clipboardText := util.GetClipboardText()
-								err = clipboard.WriteAll(clipboardText + "\n" + dataString)
-								if err != nil {
-									showErrorModal(app, mainFlex, "Failed to copy data to clipboard: "+err.Error())
-									return nil
-								}
-
-								// Optional: Show a confirmation modal
-								modal := tview.NewModal().
-									SetText("Table definition and data copied to clipboard as SQL INSERT statements.").
-									AddButtons([]string{"OK"}).
-									SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-										layout := CreateLayoutWithFooter(app, mainFlex)
-										app.SetRoot(layout, true)
-									})
-								app.SetRoot(modal, true)
-							}
-						}
-
-						if currentobjectType == "VIEW" {
-							query := "SHOW CREATE VIEW " + currentName
-							row, err := db.Query(query)
-							if err != nil {
-								showErrorModal(app, mainFlex, "Failed to fetch view definition: "+err.Error())
-								return nil
-							}
-							defer row.Close()
-
-							var viewName, createStatement, charset, collation string
-							if row.Next() {
-								err := row.Scan(&viewName, &createStatement, &charset, &collation)
-								if err != nil {
-									showErrorModal(app, mainFlex, "Scan failed: "+err.Error())
-									return nil
-								}
-
-								// Copy the CREATE VIEW statement to clipboard
-								clipboard.WriteAll(createStatement)
-
-								modal := tview.NewModal().
-									SetText("View definition copied to clipboard.").
-									AddButtons([]string{"OK"}).
-									SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-										layout := CreateLayoutWithFooter(app, mainFlex)
-										app.SetRoot(layout, true)
-									})
-								app.SetRoot(modal, true)
-							}
-						}
+						copyObjectSQL(app, db, dbName, currentName, currentobjectType)
 						return nil
 					}
 					return event
@@ -1978,6 +1300,14 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 					}
 					queryBox.SetText(routineDefinition, true)
 					app.SetFocus(queryBox)
+				case "TRIGGER", "EVENT":
+					create, err := dump.ShowCreate(db, currentobjectType, currentName)
+					if err != nil {
+						showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "Failed to read definition: "+err.Error())
+						return
+					}
+					queryBox.SetText(create.Statement, true)
+					app.SetFocus(queryBox)
 				case "TABLE", "VIEW":
 					query := "SELECT * FROM " + currentName + " LIMIT 100"
 					queryBox.SetText(query, true)
@@ -1994,7 +1324,7 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 						app.SetRoot(modal, true)
 					}
 
-					phhistory.SaveQuery(query, dbName)
+					phhistory.SaveQuery(query, dbName, lastQueryRun)
 
 					if currentobjectType == "TABLE" {
 						isEditingEnabled = true
@@ -2010,6 +1340,9 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 							app.SetRoot(modal, true)
 							return
 						}
+						startGridTrail(db, dbName, currentName, query, dataTable)
+					} else {
+						clearGridTrail()
 					}
 					app.SetFocus(dataTable)
 				}
@@ -2021,8 +1354,9 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 			SetSelectedFunc(func() {
 				query := queryBox.GetText()
 				err := ExecuteQuery(app, db, query, dataTable)
-				phhistory.SaveQuery(query, dbName)
+				phhistory.SaveQuery(query, dbName, lastQueryRun)
 				isEditingEnabled = false
+				clearGridTrail()
 				if err != nil {
 					modal := tview.NewModal().
 						SetText("Failed to execute query: " + err.Error()).
@@ -2034,6 +1368,7 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 					app.SetRoot(modal, true)
 					return
 				}
+				enableEditingForQuery(app, db, dbName, query, dataTable)
 				app.SetFocus(dataTable)
 			})
 
@@ -2054,12 +1389,35 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 		queryBox = tview.NewTextArea()
 		queryBox.
 			SetBorder(true).
-			SetTitle(" [::b]Query Editor[::-] - [green]Ctrl+R:[-]Run  [green]Ctrl+F11:[-]FullScreen  [green]Ctrl+T:[-]Table  [green]Ctrl+S:[-]Keywords  [green]Ctrl+_:[-]Templates").
+			SetTitle(" [::b]Query Editor[::-] - [green]Ctrl+R:[-]Run  [green]Ctrl+F11:[-]FullScreen  [green]Ctrl+T:[-]Table  [green]Ctrl+S:[-]Keywords  [green]Ctrl+_:[-]Snippets  [green]Ctrl+O:[-]History").
 			SetTitleAlign(tview.AlignCenter).
 			SetBorderColor(tcell.ColorLightCyan).
 			SetTitleColor(tcell.ColorAqua).
 			Blur()
 
+		// Run the editor's query into the grid
+		runEditorQuery := func() {
+			query := queryBox.GetText()
+			err := ExecuteQuery(app, db, query, dataTable)
+			phhistory.SaveQuery(query, dbName, lastQueryRun)
+			isEditingEnabled = false
+			clearGridTrail()
+			if err != nil {
+				modal := tview.NewModal().
+					SetText("Failed to execute query: " + err.Error()).
+					AddButtons([]string{"OK"}).
+					SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+						layout := CreateLayoutWithFooter(app, mainFlex)
+						app.SetRoot(layout, true)
+					})
+				app.SetRoot(modal, true)
+				return
+			}
+			enableEditingForQuery(app, db, dbName, query, dataTable)
+			app.SetRoot(mainFlex, true)
+			app.SetFocus(dataTable)
+		}
+
 		queryBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 			switch event.Key() {
 			case tcell.KeyCtrlU:
@@ -2074,23 +1432,10 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 			case tcell.KeyF11:
 				app.SetRoot(queryBox, true)
 			case tcell.KeyCtrlR:
-				query := queryBox.GetText()
-				err := ExecuteQuery(app, db, query, dataTable)
-				phhistory.SaveQuery(query, dbName)
-				isEditingEnabled = false
-				if err != nil {
-					modal := tview.NewModal().
-						SetText("Failed to execute query: " + err.Error()).
-						AddButtons([]string{"OK"}).
-						SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-							layout := CreateLayoutWithFooter(app, mainFlex)
-							app.SetRoot(layout, true)
-						})
-					app.SetRoot(modal, true)
-					return nil
-				}
-				app.SetRoot(mainFlex, true)
-				app.SetFocus(dataTable)
+				runEditorQuery()
+				return nil
+			case tcell.KeyCtrlO:
+				showQueryHistory(app, dbName, queryBox, runEditorQuery)
 				return nil
 
 			case tcell.KeyCtrlP:
@@ -2099,52 +1444,7 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 				app.SetFocus(queryBox)
 				return nil
 			case tcell.KeyCtrlUnderscore:
-				// Get current word at cursor
-				row, col, _, _ := queryBox.GetCursor()
-				text := queryBox.GetText()
-				lines := strings.Split(text, "\n")
-
-				if row >= len(lines) {
-					return nil
-				}
-				currentLine := lines[row]
-
-				prefix := currentLine[:col]
-				words := strings.Fields(prefix)
-				if len(words) == 0 {
-					return nil
-				}
-				currentWord := words[len(words)-1]
-				matches := []string{}
-				for _, kw := range sqlTemplates {
-					if strings.HasPrefix(strings.ToUpper(kw), strings.ToUpper(currentWord)) {
-						matches = append(matches, kw)
-					}
-				}
-				if len(matches) == 0 {
-					return nil
-				}
-
-				util.SaveLog("matches: " + fmt.Sprint(matches))
-				suggestionList := tview.NewList()
-				suggestionList.ShowSecondaryText(false).
-					SetBorder(true).SetTitle("Suggestions")
-				for _, match := range matches {
-					kw := match
-					suggestionList.AddItem(kw, "", 0, func() {
-						before := currentLine[:col]
-						after := currentLine[col:]
-						idx := strings.LastIndex(before, currentWord)
-						newLine := before[:idx] + kw + after
-						lines[row] = newLine
-						linesText := strings.Join(lines, "\n")
-
-						queryBox.SetText(linesText, true)
-
-						app.SetRoot(queryBox, true).SetFocus(queryBox)
-					})
-				}
-				app.SetRoot(suggestionList, true).SetFocus(suggestionList)
+				showSnippetLibrary(app, queryBox)
 				return nil
 
 			case tcell.KeyCtrlT:
@@ -2456,6 +1756,35 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 			if event.Key() == tcell.KeyF11 {
 				app.SetRoot(dataTable, true)
 			}
+			if event.Key() == tcell.KeyCtrlZ {
+				undoLastChange(app, db, dataTable)
+				return nil
+			}
+			if event.Key() == tcell.KeyCtrlL {
+				showUndoLog(app, db, dataTable)
+				return nil
+			}
+			if event.Key() == tcell.KeyCtrlG {
+				followForeignKey(app, db, dataTable)
+				return nil
+			}
+			if event.Key() == tcell.KeyCtrlO {
+				openReferencingRows(app, db, dataTable)
+				return nil
+			}
+			if event.Key() == tcell.KeyCtrlB {
+				popGridLocation(app, db, dataTable)
+				return nil
+			}
+			if event.Key() == tcell.KeyCtrlD {
+				row, _ := dataTable.GetSelection()
+				showRecordView(app, db, dataTable, row)
+				return nil
+			}
+			if event.Key() == tcell.KeyCtrlE {
+				showResultExport(app, db, dataTable)
+				return nil
+			}
 
 			return event
 		})
@@ -2496,6 +1825,34 @@ func UseDatabase(app *tview.Application, db *sql.DB, dbName string) {
 				app.SetFocus(searchInput)
 				return nil
 			}
+			if event.Key() == tcell.KeyCtrlR {
+				showRestoreDialog(app, db, dbName)
+				return nil
+			}
+			if event.Key() == tcell.KeyCtrlL {
+				// Import into the selected table, or into a new one when no table is selected
+				table := ""
+				if tableList.GetItemCount() > 0 {
+					mainText, _ := tableList.GetItemText(tableList.GetCurrentItem())
+					if name, ok := strings.CutPrefix(mainText, "🧮 TABLE "); ok {
+						table = name
+					}
+				}
+				showCSVImport(app, db, dbName, table)
+				return nil
+			}
+			if event.Key() == tcell.KeyCtrlK {
+				// Start the subset from the selected table
+				table := ""
+				if tableList.GetItemCount() > 0 {
+					mainText, _ := tableList.GetItemText(tableList.GetCurrentItem())
+					if name, ok := strings.CutPrefix(mainText, "🧮 TABLE "); ok {
+						table = name
+					}
+				}
+				showSubsetExport(app, db, dbName, table)
+				return nil
+			}
 
 			return event
 		})
@@ -2552,10 +1909,41 @@ func GetPrimaryKeyColumn(db *sql.DB, dbName, tableName string) (string, error) {
 	return primaryKey, nil
 }
 
+// Get every primary key column of a table, in key order; a table without a primary key is an error
+func GetPrimaryKeyColumns(db *sql.DB, dbName, tableName string) ([]string, error) {
+	columns, err := dump.PrimaryKeyColumns(context.Background(), db, dbName, tableName)
+	if err != nil {
+		util.SaveLog("Error getting primary key columns of " + dbName + "." + tableName + ": " + err.Error())
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%s.%s has no primary key", dbName, tableName)
+	}
+	return columns, nil
+}
+
 // Fetch data and show in table
-func ExecuteQuery(app *tview.Application, db *sql.DB, query string, table *tview.Table) error {
-	rows, err := db.Query(query)
+func ExecuteQuery(app *tview.Application, db *sql.DB, query string, table *tview.Table, args ...interface{}) error {
+	started := time.Now()
+	lastQueryRun = phhistory.QueryRun{Rows: -1, Affected: -1}
+	defer func() {
+		lastQueryRun.Duration = time.Since(started)
+	}()
+
+	// One connection, so ROW_COUNT() reports on this statement
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
 	if err != nil {
+		lastQueryRun.Err = err
+		table.Clear()
+		table.SetCell(0, 0, tview.NewTableCell("[red::b]Error: "+err.Error()))
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		lastQueryRun.Err = err
 		table.Clear()
 		table.SetCell(0, 0, tview.NewTableCell("[red::b]Error: "+err.Error()))
 		return err
@@ -2564,11 +1952,17 @@ func ExecuteQuery(app *tview.Application, db *sql.DB, query string, table *tview
 
 	columns, err := rows.Columns()
 	if err != nil {
+		lastQueryRun.Err = err
 		table.Clear()
 		table.SetCell(0, 0, tview.NewTableCell("[red::b]Error: "+err.Error()))
 		return err
 	}
 
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		columnTypes = nil
+	}
+
 	table.Clear()
 	table.SetBorders(false)
 
@@ -2614,9 +2008,21 @@ func ExecuteQuery(app *tview.Application, db *sql.DB, query string, table *tview
 		}
 		rowIndex++
 	}
+	if err := rows.Err(); err != nil {
+		lastQueryRun.Err = err
+	}
+	rows.Close()
+	if len(columns) > 0 {
+		lastQueryRun.Rows = int64(rowIndex - 1)
+	} else if err := conn.QueryRowContext(ctx, "SELECT ROW_COUNT()").Scan(&lastQueryRun.Affected); err != nil {
+		lastQueryRun.Affected = -1
+	}
 
 	// Add a title row (optional)
 	table.SetTitle(" [::b]Query Result ").SetTitleAlign(tview.AlignLeft).SetBorder(true)
+	lastExecutedQuery = query
+	lastExecutedArgs = args
+	lastResultColumns = columnTypes
 
 	return nil
 }
@@ -2666,13 +2072,17 @@ func ExecuteQuery(app *tview.Application, db *sql.DB, query string, table *tview
 
 // Enable editing and database update
 func EnableCellEditing(app *tview.Application, table *tview.Table, db *sql.DB, dbName, tableName string) error {
-	primaryKeyColumn, err := GetPrimaryKeyColumn(db, dbName, tableName)
+	primaryKeyColumns, err := GetPrimaryKeyColumns(db, dbName, tableName)
 	if err != nil {
 		util.SaveLog("tableName: " + tableName)
 		util.SaveLog("dbName: " + dbName)
 		util.SaveLog("Error getting primary key column: " + err.Error())
 		return err
 	}
+	foreignKeys, err := GetForeignKeys(db, dbName, tableName)
+	if err != nil {
+		util.SaveLog("Error getting foreign keys: " + err.Error())
+	}
 
 	table.SetSelectable(true, true)
 	// table.SetSelectedStyle(tcell.StyleDefault.Background(tcell.ColorLightYellow).Foreground(tcell.ColorBlack))
@@ -2691,14 +2101,17 @@ func EnableCellEditing(app *tview.Application, table *tview.Table, db *sql.DB, d
 		headerCell := table.GetCell(0, column)
 		columnName := util.StripFormatting(headerCell.Text)
 		// columnName = util.StripFormatting(columnName)
-		// Now don't assume primary key is always 0 column
-		var primaryKeyValue string
-		for col := 0; col < table.GetColumnCount(); col++ {
-			colHeader := util.StripFormatting(table.GetCell(0, col).Text)
-			if colHeader == primaryKeyColumn {
-				primaryKeyValue = table.GetCell(row, col).Text
-				break
-			}
+		// Now don't assume primary key is always 0 column, nor a single column
+		primaryKeyValues, err := gridRowKey(table, row, primaryKeyColumns)
+		if err != nil {
+			showErrorModal(app, mainFlex, "Cannot edit this row: "+err.Error())
+			return
+		}
+
+		// Foreign key columns get a lookup picker instead of free text
+		if fk, ok := foreignKeyForColumn(foreignKeys, columnName); ok && len(fk.Columns) == 1 {
+			showForeignKeyPicker(app, table, db, dbName, tableName, fk, primaryKeyColumns, primaryKeyValues, cell, nil)
+			return
 		}
 
 		// Use TextArea now
@@ -2730,15 +2143,14 @@ func EnableCellEditing(app *tview.Application, table *tview.Table, db *sql.DB, d
 				cell.SetText(newValue)
 
 				columnName = util.StripFormatting(columnName)
-				// Update database
-				query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?", tableName, columnName, primaryKeyColumn)
-				_, err := db.Exec(query, newValue, primaryKeyValue)
+				// Update database, keeping the before-image for undo
+				err := updateCell(db, dbName, tableName, primaryKeyColumns, primaryKeyValues, columnName, newValue)
 				if err != nil {
-					fmt.Println("Update error:", err)
+					cell.SetText(currentValue)
+					util.SaveLog("Update error: " + err.Error())
+					showErrorModal(app, mainFlex, "Update failed: "+err.Error())
+					return nil
 				}
-				fullQuery := phhistory.ReplacePlaceholders(query, newValue, primaryKeyValue)
-				phhistory.SaveQuery(fullQuery, dbName)
-				util.SaveLog(fullQuery)
 				app.SetRoot(mainFlex, true)
 				util.SetFocusWithBorder(app, table)
 				return nil
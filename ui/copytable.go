@@ -0,0 +1,199 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mysql-tui/dump"
+	"mysql-tui/util"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Larger output is offered as a file instead of going to the clipboard
+const clipboardLimit = 4 << 20
+
+var errClipboardLimit = errors.New("output is larger than the clipboard limit")
+
+// A buffer that refuses to grow past max bytes
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && b.Len()+len(p) > b.max {
+		return 0, errClipboardLimit
+	}
+	return b.Buffer.Write(p)
+}
+
+// Ctrl+X on an opened object: a table is copied as CREATE TABLE and INSERTs, a view as its definition
+func copyObjectSQL(app *tview.Application, db *sql.DB, dbName, objName, objType string) {
+	back := CreateLayoutWithFooter(app, mainFlex)
+	switch objType {
+	case "TABLE":
+		showCopyTable(app, db, dbName, objName)
+	case "VIEW":
+		var viewName, createStatement, charset, collation string
+		err := db.QueryRow("SHOW CREATE VIEW "+dump.QuoteIdent(dbName)+"."+dump.QuoteIdent(objName)).
+			Scan(&viewName, &createStatement, &charset, &collation)
+		if err != nil {
+			showErrorModal(app, back, "Failed to fetch view definition: "+err.Error())
+			return
+		}
+		if err := clipboard.WriteAll(createStatement + ";"); err != nil {
+			showErrorModal(app, back, "Failed to copy to clipboard: "+err.Error())
+			return
+		}
+		showDoneModal(app, "View definition copied to clipboard.")
+	}
+}
+
+// Choose what to copy of a table and where to put it
+func showCopyTable(app *tview.Application, db *sql.DB, dbName, table string) {
+	back := func() {
+		app.SetRoot(CreateLayoutWithFooter(app, mainFlex), true)
+	}
+
+	form := tview.NewForm().
+		AddDropDown("Include", []string{"Structure and data", "Structure only", "Data only"}, 0, nil).
+		AddCheckbox("DROP TABLE IF EXISTS", false, nil).
+		AddInputField("WHERE", "", 40, nil, nil).
+		AddInputField("Row limit (0 = all)", "0", 10, tview.InputFieldInteger, nil).
+		AddInputField("Rows per INSERT", "1000", 10, tview.InputFieldInteger, nil).
+		AddDropDown("Destination", []string{"Clipboard", "File"}, 0, nil).
+		AddInputField("File", table+".sql", 40, nil, nil)
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).SetTitle(" Copy table " + table + " as SQL ").SetTitleAlign(tview.AlignLeft)
+	form.SetCancelFunc(back)
+
+	text := func(label string) string {
+		return strings.TrimSpace(form.GetFormItemByLabel(label).(*tview.InputField).GetText())
+	}
+	option := func(label string) int {
+		index, _ := form.GetFormItemByLabel(label).(*tview.DropDown).GetCurrentOption()
+		return index
+	}
+
+	form.AddButton("Copy", func() {
+		include := option("Include")
+		opts := dump.TableSQLOptions{
+			Database:  dbName,
+			Schema:    include != 2,
+			Data:      include != 1,
+			DropTable: form.GetFormItemByLabel("DROP TABLE IF EXISTS").(*tview.Checkbox).IsChecked(),
+			Where:     text("WHERE"),
+		}
+		var err error
+		if opts.Limit, err = strconv.Atoi(text("Row limit (0 = all)")); err != nil || opts.Limit < 0 {
+			showErrorModal(app, form, "Row limit must be 0 or a positive number.")
+			return
+		}
+		if opts.BatchSize, err = strconv.Atoi(text("Rows per INSERT")); err != nil || opts.BatchSize < 1 {
+			showErrorModal(app, form, "Rows per INSERT must be a positive number.")
+			return
+		}
+
+		path := text("File")
+		if path == "" {
+			path = table + ".sql"
+		}
+		if option("Destination") == 1 {
+			copyTableToFile(app, db, table, opts, path, form)
+			return
+		}
+		copyTableToClipboard(app, db, table, opts, path, form)
+	})
+	form.AddButton("Cancel", back)
+
+	app.SetRoot(form, true).SetFocus(form)
+}
+
+// Generate into memory up to clipboardLimit; past it, offer a file instead
+func copyTableToClipboard(app *tview.Application, db *sql.DB, table string, opts dump.TableSQLOptions, path string, returnTo *tview.Form) {
+	generateTableSQL(app, func() (string, error) {
+		buf := &limitedBuffer{max: clipboardLimit}
+		count, err := dump.WriteTableSQL(context.Background(), db, buf, table, opts)
+		if err != nil {
+			return "", err
+		}
+		if err := clipboard.WriteAll(buf.String()); err != nil {
+			return "", fmt.Errorf("copy to clipboard: %w", err)
+		}
+		return fmt.Sprintf("Copied %s as SQL (%d row(s), %s) to the clipboard.", table, count, dump.FormatBytes(int64(buf.Len()))), nil
+	}, func(err error) {
+		if !errors.Is(err, errClipboardLimit) {
+			showErrorModal(app, returnTo, "Copy failed: "+err.Error())
+			return
+		}
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("The SQL for %s is larger than %s, too large for the clipboard.\n\nWrite it to %s instead?", table, dump.FormatBytes(clipboardLimit), path)).
+			AddButtons([]string{"Write to file", "Cancel"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				if buttonLabel == "Write to file" {
+					copyTableToFile(app, db, table, opts, path, returnTo)
+					return
+				}
+				app.SetRoot(returnTo, true)
+			})
+		app.SetRoot(modal, true)
+	})
+}
+
+// Stream the SQL straight into a file
+func copyTableToFile(app *tview.Application, db *sql.DB, table string, opts dump.TableSQLOptions, path string, returnTo *tview.Form) {
+	generateTableSQL(app, func() (string, error) {
+		f, err := os.Create(path)
+		if err != nil {
+			return "", err
+		}
+		count, err := dump.WriteTableSQL(context.Background(), db, f, table, opts)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Wrote %s as SQL (%d row(s)) to %s.", table, count, path), nil
+	}, func(err error) {
+		showErrorModal(app, returnTo, "Copy failed: "+err.Error())
+	})
+}
+
+// Run generate in the background behind a waiting message, then report its outcome
+func generateTableSQL(app *tview.Application, generate func() (string, error), onError func(error)) {
+	waiting := tview.NewModal().SetText("Generating SQL...")
+	app.SetRoot(waiting, true)
+
+	go func() {
+		message, err := generate()
+		if err != nil && !errors.Is(err, errClipboardLimit) {
+			util.SaveLog("Copy table as SQL failed: " + err.Error())
+		}
+		app.QueueUpdateDraw(func() {
+			if err != nil {
+				onError(err)
+				return
+			}
+			showDoneModal(app, message)
+		})
+	}()
+}
+
+func showDoneModal(app *tview.Application, message string) {
+	modal := tview.NewModal().
+		SetText(message).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			app.SetRoot(CreateLayoutWithFooter(app, mainFlex), true)
+		})
+	app.SetRoot(modal, true)
+}
@@ -0,0 +1,514 @@
+package ui
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"mysql-tui/dump"
+	"mysql-tui/util"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Delimiters and quote characters offered by the import wizard
+var csvDelimiters = []struct {
+	Label string
+	Rune  rune
+}{
+	{"Comma (,)", ','},
+	{"Semicolon (;)", ';'},
+	{"Tab", '\t'},
+	{"Pipe (|)", '|'},
+}
+
+var csvQuotes = []struct {
+	Label string
+	Rune  rune
+}{
+	{`Double (")`, '"'},
+	{"Single (')", '\''},
+	{"None", 0},
+}
+
+// Rows shown in the preview, and rows read to infer the types of a new table
+const (
+	csvPreviewRows = 20
+	csvSampleRows  = 1000
+)
+
+// A CSV import being set up by the wizard
+type csvImport struct {
+	app      *tview.Application
+	db       *sql.DB
+	dbName   string
+	returnTo tview.Primitive
+
+	opts     dump.CSVImportOptions
+	table    string // table selected in the object list, "" when none
+	newTable bool
+	header   []string // CSV column names
+	sample   [][]sql.NullString
+	types    []string          // column types of a new table, per CSV column
+	columns  []string          // columns of an existing table
+	colTypes map[string]string // their full types
+}
+
+// Load a CSV file into the table selected in the object list, or into a new table
+func showCSVImport(app *tview.Application, db *sql.DB, dbName, table string) {
+	returnTo := CreateLayoutWithFooter(app, mainFlex)
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "."
+	}
+
+	pickFile(app, cwd, []string{".csv", ".tsv", ".txt", ".csv.gz", ".tsv.gz"}, "Import CSV into "+dbName, returnTo, func(path string) {
+		imp := &csvImport{app: app, db: db, dbName: dbName, returnTo: returnTo, table: table}
+		imp.opts.File = path
+		imp.opts.Database = dbName
+		imp.opts.Header = true
+		imp.opts.Quote = '"'
+		imp.opts.Delimiter = ','
+		if strings.Contains(strings.ToLower(filepath.Base(path)), ".tsv") {
+			imp.opts.Delimiter = '\t'
+		}
+		imp.showOptions()
+	})
+}
+
+// File format, target and batch options next to a live preview of the first rows
+func (imp *csvImport) showOptions() {
+	app := imp.app
+	form := tview.NewForm()
+	preview := tview.NewTable().SetFixed(1, 0)
+	preview.SetBorder(true).SetTitleAlign(tview.AlignLeft)
+
+	layout := tview.NewFlex().
+		AddItem(form, 50, 0, true).
+		AddItem(preview, 0, 1, false)
+
+	ready := false
+	option := func(label string) int {
+		index, _ := form.GetFormItemByLabel(label).(*tview.DropDown).GetCurrentOption()
+		return index
+	}
+	text := func(label string) string {
+		return strings.TrimSpace(form.GetFormItemByLabel(label).(*tview.InputField).GetText())
+	}
+	readFormat := func() {
+		imp.opts.Delimiter = csvDelimiters[option("Delimiter")].Rune
+		imp.opts.Quote = csvQuotes[option("Quote")].Rune
+		imp.opts.Header = form.GetFormItemByLabel("First row is a header").(*tview.Checkbox).IsChecked()
+		imp.opts.Encoding = dump.CSVEncodings[option("Encoding")]
+		imp.opts.NullToken = form.GetFormItemByLabel("NULL token").(*tview.InputField).GetText()
+	}
+	refresh := func() {
+		if !ready {
+			return
+		}
+		readFormat()
+		preview.Clear()
+		header, rows, err := dump.PreviewCSV(imp.opts.CSVOptions, csvPreviewRows)
+		if err != nil {
+			preview.SetTitle(" Preview - [red]" + tview.Escape(err.Error()) + " ")
+			return
+		}
+		preview.SetTitle(fmt.Sprintf(" Preview - %s, first %d row(s) ", filepath.Base(imp.opts.File), len(rows)))
+		for col, name := range header {
+			preview.SetCell(0, col, tview.NewTableCell("[::b]"+tview.Escape(name)).
+				SetTextColor(tcell.ColorYellow).
+				SetMaxWidth(30))
+		}
+		for r, fields := range rows {
+			for col, f := range fields {
+				value := "[gray]NULL"
+				if f.Valid {
+					value = tview.Escape(f.String)
+				}
+				preview.SetCell(r+1, col, tview.NewTableCell(value).SetMaxWidth(30))
+			}
+		}
+	}
+
+	delimiters := make([]string, len(csvDelimiters))
+	initialDelimiter := 0
+	for i, d := range csvDelimiters {
+		delimiters[i] = d.Label
+		if d.Rune == imp.opts.Delimiter {
+			initialDelimiter = i
+		}
+	}
+	quotes := make([]string, len(csvQuotes))
+	for i, q := range csvQuotes {
+		quotes[i] = q.Label
+	}
+	targets := []string{"New table"}
+	if imp.table != "" {
+		targets = []string{"Table " + imp.table, "New table"}
+	}
+	tableName := dump.TableNameForFile(imp.opts.File)
+
+	form.AddDropDown("Delimiter", delimiters, initialDelimiter, func(string, int) { refresh() }).
+		AddDropDown("Quote", quotes, 0, func(string, int) { refresh() }).
+		AddCheckbox("First row is a header", imp.opts.Header, func(bool) { refresh() }).
+		AddDropDown("Encoding", dump.CSVEncodings, 0, func(string, int) { refresh() }).
+		AddInputField("NULL token", "", 10, nil, func(string) { refresh() }).
+		AddDropDown("Import into", targets, 0, nil).
+		AddInputField("New table name", tableName, 30, nil, nil).
+		AddInputField("Batch size", "1000", 10, tview.InputFieldInteger, nil).
+		AddDropDown("Rejected rows", []string{"Skip and report", "Roll back the import"}, 0, nil)
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).SetTitle(" Import CSV ").SetTitleAlign(tview.AlignLeft)
+	form.SetCancelFunc(func() {
+		app.SetRoot(imp.returnTo, true)
+	})
+
+	form.AddButton("Next", func() {
+		readFormat()
+		var err error
+		if imp.opts.BatchSize, err = strconv.Atoi(text("Batch size")); err != nil || imp.opts.BatchSize < 1 {
+			showErrorModal(app, layout, "Batch size must be a positive number.")
+			return
+		}
+		imp.opts.RollbackOnReject = option("Rejected rows") == 1
+		imp.newTable = targets[option("Import into")] == "New table"
+		imp.opts.Table = imp.table
+		if imp.newTable {
+			if imp.opts.Table = text("New table name"); imp.opts.Table == "" {
+				showErrorModal(app, layout, "Enter a name for the new table.")
+				return
+			}
+		}
+
+		imp.header, imp.sample, err = dump.PreviewCSV(imp.opts.CSVOptions, csvSampleRows)
+		if err != nil {
+			showErrorModal(app, layout, "Cannot read the file: "+err.Error())
+			return
+		}
+		if len(imp.header) == 0 {
+			showErrorModal(app, layout, "The file has no rows to import.")
+			return
+		}
+		if err := imp.defaultMapping(); err != nil {
+			showErrorModal(app, layout, "Failed to read columns: "+err.Error())
+			return
+		}
+		imp.showMapping(layout)
+	})
+	form.AddButton("Cancel", func() {
+		app.SetRoot(imp.returnTo, true)
+	})
+
+	ready = true
+	refresh()
+	app.SetRoot(layout, true).SetFocus(form)
+}
+
+// Map CSV columns to table columns by header name, or by position without a header.
+// A new table gets a column per CSV column with the inferred type.
+func (imp *csvImport) defaultMapping() error {
+	if imp.newTable {
+		imp.opts.Columns = dump.ColumnNames(imp.header)
+		imp.types = dump.InferColumnTypes(len(imp.header), imp.sample)
+		return nil
+	}
+
+	columns, err := dump.TableColumns(context.Background(), imp.db, imp.dbName, imp.opts.Table)
+	if err != nil {
+		return err
+	}
+	imp.columns = columns
+	imp.colTypes = tableColumnTypes(imp.db, imp.dbName, imp.opts.Table)
+
+	imp.opts.Columns = make([]string, len(imp.header))
+	for i, name := range imp.header {
+		if !imp.opts.Header {
+			if i < len(columns) {
+				imp.opts.Columns[i] = columns[i]
+			}
+			continue
+		}
+		for _, col := range columns {
+			if strings.EqualFold(strings.TrimSpace(name), col) {
+				imp.opts.Columns[i] = col
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// One row per CSV column: Enter changes its target, Ctrl+S starts the import
+func (imp *csvImport) showMapping(back tview.Primitive) {
+	app := imp.app
+	grid := tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	grid.SetBorder(true).
+		SetTitle(fmt.Sprintf(" Import %s into %s  (Enter: change  Ctrl+S: import  Esc: back) ", filepath.Base(imp.opts.File), imp.opts.Table)).
+		SetTitleAlign(tview.AlignLeft)
+
+	render := func() {
+		for col, title := range []string{"CSV column", "Sample", "Target column", "Type"} {
+			grid.SetCell(0, col, tview.NewTableCell("[::b]"+title).
+				SetTextColor(tcell.ColorYellow).
+				SetSelectable(false))
+		}
+		for i, name := range imp.header {
+			sample := ""
+			for _, row := range imp.sample {
+				if i < len(row) && row[i].Valid && row[i].String != "" {
+					sample = row[i].String
+					break
+				}
+			}
+			target, typ := "[gray](skip)", ""
+			if col := imp.opts.Columns[i]; col != "" {
+				target = tview.Escape(col)
+				if imp.newTable {
+					typ = imp.types[i]
+				} else {
+					typ = imp.colTypes[col]
+				}
+			}
+			grid.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(name)).SetMaxWidth(30))
+			grid.SetCell(i+1, 1, tview.NewTableCell(tview.Escape(sample)).SetMaxWidth(30).SetTextColor(tcell.ColorGray))
+			grid.SetCell(i+1, 2, tview.NewTableCell(target))
+			grid.SetCell(i+1, 3, tview.NewTableCell(tview.Escape(typ)))
+		}
+	}
+	render()
+
+	grid.SetSelectedFunc(func(row, col int) {
+		if row < 1 {
+			return
+		}
+		imp.editMapping(row-1, grid, func() {
+			render()
+			app.SetRoot(grid, true).SetFocus(grid)
+		})
+	})
+	grid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			app.SetRoot(back, true)
+			return nil
+		case tcell.KeyCtrlS:
+			imp.confirm(grid)
+			return nil
+		}
+		return event
+	})
+	grid.Select(1, 0)
+	app.SetRoot(grid, true).SetFocus(grid)
+}
+
+// Choose the target of one CSV column; a new table also takes the column type
+func (imp *csvImport) editMapping(index int, returnTo tview.Primitive, done func()) {
+	app := imp.app
+	title := fmt.Sprintf(" Target for CSV column %s ", imp.header[index])
+
+	if !imp.newTable {
+		list := tview.NewList()
+		list.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+		list.AddItem("(skip)", "Do not import this column", 0, func() {
+			imp.opts.Columns[index] = ""
+			done()
+		})
+		for i, col := range imp.columns {
+			column := col
+			list.AddItem(tview.Escape(column), imp.colTypes[column], 0, func() {
+				imp.opts.Columns[index] = column
+				done()
+			})
+			if column == imp.opts.Columns[index] {
+				list.SetCurrentItem(i + 1)
+			}
+		}
+		list.SetDoneFunc(func() {
+			app.SetRoot(returnTo, true)
+		})
+		app.SetRoot(list, true).SetFocus(list)
+		return
+	}
+
+	form := tview.NewForm().
+		AddInputField("Column name (empty skips it)", imp.opts.Columns[index], 40, nil, nil).
+		AddInputField("Type", imp.types[index], 30, nil, nil)
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+	form.AddButton("Save", func() {
+		name := strings.TrimSpace(form.GetFormItemByLabel("Column name (empty skips it)").(*tview.InputField).GetText())
+		typ := strings.TrimSpace(form.GetFormItemByLabel("Type").(*tview.InputField).GetText())
+		if name != "" && typ == "" {
+			showErrorModal(app, form, "Enter a column type.")
+			return
+		}
+		imp.opts.Columns[index] = name
+		imp.types[index] = typ
+		done()
+	})
+	form.AddButton("Cancel", func() {
+		app.SetRoot(returnTo, true)
+	})
+	form.SetCancelFunc(func() {
+		app.SetRoot(returnTo, true)
+	})
+	app.SetRoot(form, true).SetFocus(form)
+}
+
+// Check the mapping and ask before creating anything
+func (imp *csvImport) confirm(returnTo tview.Primitive) {
+	app := imp.app
+	var columns, types []string
+	seen := map[string]bool{}
+	for i, col := range imp.opts.Columns {
+		if col == "" {
+			continue
+		}
+		if seen[strings.ToLower(col)] {
+			showErrorModal(app, returnTo, fmt.Sprintf("Column %s is mapped more than once.", col))
+			return
+		}
+		seen[strings.ToLower(col)] = true
+		columns = append(columns, col)
+		if imp.newTable {
+			types = append(types, imp.types[i])
+		}
+	}
+	if len(columns) == 0 {
+		showErrorModal(app, returnTo, "Map at least one column.")
+		return
+	}
+
+	imp.opts.CreateTable = ""
+	message := fmt.Sprintf("Import %s into %s?\n\n%d of %d CSV column(s) are mapped.",
+		filepath.Base(imp.opts.File), imp.opts.Table, len(columns), len(imp.header))
+	if imp.newTable {
+		imp.opts.CreateTable = dump.CreateTableSQL(imp.opts.Table, columns, types)
+		message = fmt.Sprintf("Create table %s with %d column(s) and import %s into it?",
+			imp.opts.Table, len(columns), filepath.Base(imp.opts.File))
+	}
+
+	modal := tview.NewModal().
+		SetText(message).
+		AddButtons([]string{"Import", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			if buttonLabel == "Import" {
+				imp.run()
+				return
+			}
+			app.SetRoot(returnTo, true)
+		})
+	app.SetRoot(modal, true)
+}
+
+// Run the import in the background with a progress bar; Esc stops it
+func (imp *csvImport) run() {
+	app := imp.app
+	opts := imp.opts
+	ctx, cancel := context.WithCancel(context.Background())
+
+	status := tview.NewTextView().SetDynamicColors(true)
+	status.SetBorder(true).SetTitle(" Import " + filepath.Base(opts.File) + " into " + opts.Table + " ").SetTitleAlign(tview.AlignLeft)
+
+	rejectedView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+	rejectedView.SetBorder(true).SetTitle(" Rejected rows ").SetTitleAlign(tview.AlignLeft)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(status, 7, 0, false).
+		AddItem(rejectedView, 0, 1, true)
+
+	started := time.Now()
+	done := false
+	render := func(p dump.ImportProgress, state string) {
+		fraction := 0.0
+		if p.TotalBytes > 0 {
+			fraction = float64(p.BytesRead) / float64(p.TotalBytes)
+		}
+		status.SetText(fmt.Sprintf("%s\n%s [white]%.1f%%  %s of %s\nRows: %d  Inserted: %d  [red]Rejected: %d[-]\nElapsed: %s",
+			state, progressBar(fraction, 40), fraction*100, dump.FormatBytes(p.BytesRead), dump.FormatBytes(p.TotalBytes),
+			p.Rows, p.Inserted, p.Rejected, time.Since(started).Round(time.Second)))
+	}
+	render(dump.ImportProgress{}, "[blue]Importing... (Esc: Stop)")
+
+	// Rejected rows go to <file>.rejected.csv with their line and the reason, ready to fix and re-import
+	report := &dump.RejectedReport{Path: opts.File + ".rejected.csv", Header: imp.header, NullToken: opts.NullToken}
+	onReject := func(r dump.RejectedRow) {
+		report.Add(r)
+		app.QueueUpdateDraw(func() {
+			fmt.Fprintf(rejectedView, "[yellow]line %d:[-] %s\n", r.Line, tview.Escape(r.Err.Error()))
+		})
+	}
+
+	var lastDraw time.Time
+	onProgress := func(p dump.ImportProgress) {
+		if time.Since(lastDraw) < 200*time.Millisecond {
+			return
+		}
+		lastDraw = time.Now()
+		app.QueueUpdateDraw(func() {
+			if !done {
+				render(p, "[blue]Importing... (Esc: Stop)")
+			}
+		})
+	}
+
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			if !done {
+				cancel()
+				return nil
+			}
+			// Reload the object list, the import may have created a table
+			UseDatabase(app, imp.db, imp.dbName)
+			return nil
+		}
+		return event
+	})
+
+	go func() {
+		progress, err := dump.ImportCSV(ctx, imp.db, opts, onProgress, onReject)
+		cancel()
+
+		if reportErr := report.Close(); reportErr != nil {
+			util.SaveLog("Failed to write rejected rows: " + reportErr.Error())
+		}
+
+		state := "[green]Import completed."
+		switch {
+		case err == context.Canceled:
+			state = "[yellow]Import stopped, nothing was committed."
+		case err != nil:
+			state = "[red]Import failed: " + tview.Escape(err.Error())
+		}
+		if progress.Rejected > 0 {
+			state += fmt.Sprintf(" [yellow]%d rejected row(s) written to %s", progress.Rejected, tview.Escape(report.Path))
+		}
+		util.SaveLog(fmt.Sprintf("CSV import of %s into %s.%s: %d rows, %d inserted, %d rejected, err=%v",
+			opts.File, imp.dbName, opts.Table, progress.Rows, progress.Inserted, progress.Rejected, err))
+
+		app.QueueUpdateDraw(func() {
+			done = true
+			render(progress, state+"\n[white]Esc: Back")
+		})
+	}()
+
+	app.SetRoot(layout, true).SetFocus(layout)
+}
+
+func progressBar(fraction float64, width int) string {
+	filled := int(fraction * float64(width))
+	if filled < 0 {
+		filled = 0
+	}
+	if filled > width {
+		filled = width
+	}
+	return "[green]" + strings.Repeat("█", filled) + "[gray]" + strings.Repeat("░", width-filled) + "[-]"
+}
@@ -0,0 +1,165 @@
+package ui
+
+import (
+	"database/sql"
+	"mysql-tui/util"
+	"regexp"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+const sqlIdent = "(?:`[^`]+`|[A-Za-z0-9_$]+)"
+
+var (
+	quotedLiteralRegex = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"`)
+	sqlCommentRegex    = regexp.MustCompile(`(?s)/\*.*?\*/|(?:--\s|#)[^\n]*`)
+	simpleSelectRegex  = regexp.MustCompile(`(?is)^SELECT\s+(.+?)\s+FROM\s+(` + sqlIdent + `(?:\.` + sqlIdent + `)?)` +
+		`(?:\s+(?:AS\s+)?(` + sqlIdent + `))?` +
+		`(?:\s+((?:WHERE|ORDER\s+BY|LIMIT|FOR\s+UPDATE|LOCK\s+IN)\b.*))?$`)
+	qualifiedNameRegex = regexp.MustCompile(`^(` + sqlIdent + `)(?:\.(` + sqlIdent + `))?$`)
+	selectColumnRegex  = regexp.MustCompile(`(?is)^(?:(` + sqlIdent + `)\.)?(` + sqlIdent + `|\*)(?:\s+(?:AS\s+)?(` + sqlIdent + `))?$`)
+	nonEditableRegex   = regexp.MustCompile(`(?i)\b(JOIN|GROUP\s+BY|HAVING|UNION|DISTINCT|INTO|WINDOW|OVER)\b`)
+)
+
+var selectTailKeywords = map[string]bool{"WHERE": true, "ORDER": true, "LIMIT": true, "FOR": true, "LOCK": true}
+
+// A SELECT whose rows all come from one base table
+type selectSource struct {
+	DBName  string
+	Table   string
+	Alias   string
+	Columns []string // nil means every column (SELECT *)
+}
+
+// Parse a single-table SELECT; ok is false for anything the grid cannot safely edit
+func parseSimpleSelect(query, defaultDB string) (selectSource, bool) {
+	masked := quotedLiteralRegex.ReplaceAllString(query, "''")
+	masked = sqlCommentRegex.ReplaceAllString(masked, " ")
+	masked = strings.TrimSpace(masked)
+	masked = strings.TrimSpace(strings.TrimRight(masked, "; \t\r\n"))
+
+	if strings.Contains(masked, ";") || nonEditableRegex.MatchString(masked) {
+		return selectSource{}, false
+	}
+
+	m := simpleSelectRegex.FindStringSubmatch(masked)
+	if m == nil {
+		return selectSource{}, false
+	}
+
+	src := selectSource{DBName: defaultDB, Alias: unquoteIdent(m[3])}
+	if selectTailKeywords[strings.ToUpper(src.Alias)] {
+		return selectSource{}, false
+	}
+	name := qualifiedNameRegex.FindStringSubmatch(m[2])
+	if name[2] != "" {
+		src.DBName = unquoteIdent(name[1])
+		src.Table = unquoteIdent(name[2])
+	} else {
+		src.Table = unquoteIdent(name[1])
+	}
+
+	star := false
+	for _, item := range strings.Split(m[1], ",") {
+		cm := selectColumnRegex.FindStringSubmatch(strings.TrimSpace(item))
+		if cm == nil {
+			return selectSource{}, false
+		}
+		qualifier, column, alias := unquoteIdent(cm[1]), unquoteIdent(cm[2]), unquoteIdent(cm[3])
+		if qualifier != "" && qualifier != src.Table && qualifier != src.Alias {
+			return selectSource{}, false
+		}
+		if column == "*" {
+			if alias != "" {
+				return selectSource{}, false
+			}
+			star = true
+			continue
+		}
+		// The grid addresses columns by header, so aliases must not rename them
+		if alias != "" && alias != column {
+			return selectSource{}, false
+		}
+		src.Columns = append(src.Columns, column)
+	}
+	if star {
+		src.Columns = nil
+	}
+	return src, true
+}
+
+func unquoteIdent(ident string) string {
+	return strings.Trim(strings.TrimSpace(ident), "`")
+}
+
+// Check the parsed source against the schema: a base table whose primary key columns are all selected
+func resolveEditableSource(db *sql.DB, src selectSource) bool {
+	var tableType string
+	err := db.QueryRow(`
+		SELECT TABLE_TYPE FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+	`, src.DBName, src.Table).Scan(&tableType)
+	if err != nil || tableType != "BASE TABLE" {
+		return false
+	}
+
+	primaryKey, err := GetPrimaryKeyColumns(db, src.DBName, src.Table)
+	if err != nil {
+		return false
+	}
+	if src.Columns == nil {
+		return true
+	}
+
+	var count int
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(src.Columns)), ", ")
+	args := []interface{}{src.DBName, src.Table}
+	for _, col := range src.Columns {
+		args = append(args, col)
+	}
+	err = db.QueryRow(`
+		SELECT COUNT(DISTINCT COLUMN_NAME) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME IN (`+placeholders+`)
+	`, args...).Scan(&count)
+	if err != nil || count != len(uniqueStrings(src.Columns)) {
+		return false
+	}
+
+	selected := map[string]bool{}
+	for _, col := range src.Columns {
+		selected[col] = true
+	}
+	for _, col := range primaryKey {
+		if !selected[col] {
+			return false
+		}
+	}
+	return true
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Turn on the browse-view editing workflow when a query result maps onto one table
+func enableEditingForQuery(app *tview.Application, db *sql.DB, dbName, query string, table *tview.Table) {
+	src, ok := parseSimpleSelect(query, dbName)
+	if !ok || !resolveEditableSource(db, src) {
+		return
+	}
+	if err := EnableCellEditing(app, table, db, src.DBName, src.Table); err != nil {
+		util.SaveLog("Result not editable: " + err.Error())
+		return
+	}
+	isEditingEnabled = true
+	startGridTrail(db, src.DBName, src.Table, query, table)
+}
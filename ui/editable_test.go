@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSimpleSelect(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		ok    bool
+		want  selectSource
+	}{
+		{"star", "SELECT * FROM users", true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"lower case and semicolon", "select * from users;", true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"columns", "SELECT id, name FROM users", true,
+			selectSource{DBName: "app", Table: "users", Columns: []string{"id", "name"}}},
+		{"qualified table", "SELECT id FROM shop.orders", true,
+			selectSource{DBName: "shop", Table: "orders", Columns: []string{"id"}}},
+		{"backtick-quoted names", "SELECT `id`, `full name` FROM `my db`.`order items`", true,
+			selectSource{DBName: "my db", Table: "order items", Columns: []string{"id", "full name"}}},
+		{"table alias", "SELECT u.id, u.name FROM users u", true,
+			selectSource{DBName: "app", Table: "users", Alias: "u", Columns: []string{"id", "name"}}},
+		{"AS table alias", "SELECT u.id FROM users AS u WHERE u.id > 3", true,
+			selectSource{DBName: "app", Table: "users", Alias: "u", Columns: []string{"id"}}},
+		{"columns qualified by the table", "SELECT users.id, `users`.`name` FROM users", true,
+			selectSource{DBName: "app", Table: "users", Columns: []string{"id", "name"}}},
+		{"alias equal to the column", "SELECT id AS id, name `name` FROM users", true,
+			selectSource{DBName: "app", Table: "users", Columns: []string{"id", "name"}}},
+		{"star mixed with columns", "SELECT *, name FROM users", true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"qualified star mixed with columns", "SELECT u.id, u.* FROM users u", true,
+			selectSource{DBName: "app", Table: "users", Alias: "u"}},
+		{"where, order and limit", "SELECT * FROM users WHERE id > 3 ORDER BY name LIMIT 10, 20", true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"limit only", "SELECT id FROM users LIMIT 5", true,
+			selectSource{DBName: "app", Table: "users", Columns: []string{"id"}}},
+		{"for update", "SELECT * FROM users WHERE id = 1 FOR UPDATE", true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"lock in share mode", "SELECT * FROM users LOCK IN SHARE MODE", true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"comments", "/* list */ SELECT id -- the key\n, name # and name\nFROM users", true,
+			selectSource{DBName: "app", Table: "users", Columns: []string{"id", "name"}}},
+		{"literal with a semicolon", "SELECT * FROM users WHERE note = 'a;b'", true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"literal with a comment marker", "SELECT * FROM users WHERE note = '-- no' OR note = \"# no\" OR note = '/* no */'", true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"literal with quotes", `SELECT * FROM users WHERE name = 'O''Brien' OR name = 'O\'Hara' OR name = "say ""hi"""`, true,
+			selectSource{DBName: "app", Table: "users"}},
+		{"literal hiding a keyword", "SELECT * FROM users WHERE note = 'a JOIN b UNION c'", true,
+			selectSource{DBName: "app", Table: "users"}},
+
+		{"join", "SELECT * FROM users JOIN orders ON orders.user_id = users.id", false, selectSource{}},
+		{"left join", "SELECT u.id FROM users u LEFT JOIN orders o ON o.user_id = u.id", false, selectSource{}},
+		{"comma join", "SELECT * FROM users, orders", false, selectSource{}},
+		{"comma join with aliases", "SELECT u.id FROM users u, orders o WHERE o.user_id = u.id", false, selectSource{}},
+		{"union", "SELECT id FROM users UNION SELECT id FROM admins", false, selectSource{}},
+		{"distinct", "SELECT DISTINCT name FROM users", false, selectSource{}},
+		{"group by", "SELECT name FROM users GROUP BY name", false, selectSource{}},
+		{"having", "SELECT name FROM users HAVING name > 'a'", false, selectSource{}},
+		{"renamed column", "SELECT name AS n FROM users", false, selectSource{}},
+		{"renamed column without AS", "SELECT id, name full_name FROM users", false, selectSource{}},
+		{"renamed star", "SELECT * AS x FROM users", false, selectSource{}},
+		{"expression", "SELECT id, UPPER(name) FROM users", false, selectSource{}},
+		{"aggregate", "SELECT COUNT(*) FROM users", false, selectSource{}},
+		{"literal column", "SELECT id, 'x' FROM users", false, selectSource{}},
+		{"other table's column", "SELECT o.id FROM users u", false, selectSource{}},
+		{"subquery", "SELECT * FROM (SELECT * FROM users) x", false, selectSource{}},
+		{"into", "SELECT * FROM users INTO OUTFILE '/tmp/u'", false, selectSource{}},
+		{"window", "SELECT id, ROW_NUMBER() OVER () FROM users", false, selectSource{}},
+		{"two statements", "SELECT * FROM users; DELETE FROM users", false, selectSource{}},
+		{"keyword as alias", "SELECT * FROM users LIMIT", false, selectSource{}},
+		{"not a select", "UPDATE users SET name = 'x'", false, selectSource{}},
+		{"show", "SHOW TABLES", false, selectSource{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSimpleSelect(tt.query, "app")
+			if ok != tt.ok {
+				t.Fatalf("parseSimpleSelect(%q) ok = %v, want %v (parsed %+v)", tt.query, ok, tt.ok, got)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseSimpleSelect(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"fmt"
+	"mysql-tui/dump"
+	"mysql-tui/util"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Run dump.Export in the background, streaming its progress into progressView
+func runExport(app *tview.Application, progressView *tview.TextView, dbName string, opts dump.ExportOptions) {
+	progressChan := make(chan string)
+	progress := dump.NewExportProgress(dbName, opts)
+
+	// Live totals above the scrolling log
+	statusView := tview.NewTextView().SetDynamicColors(true)
+	statusView.SetBorder(true).SetTitle(" Export " + dbName + " ").SetTitleAlign(tview.AlignLeft)
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(statusView, 0, 1, false).
+		AddItem(progressView, 0, 2, true)
+
+	progressView.SetText("[blue]Starting export...\n")
+	statusView.SetText(renderExportProgress(progress))
+	app.SetRoot(layout, true)
+
+	util.SaveLog(fmt.Sprintf("Exporting %d objects...\n", len(opts.Objects)))
+
+	var failed []dump.ManifestObject
+	var exportErr error
+	go func() {
+		conn := dump.Connection{User: User, Password: Pass, Host: Host, Port: Port}
+		failed, exportErr = dump.Export(conn, dbName, opts, progressChan, progress)
+		close(progressChan)
+	}()
+
+	stopTicker := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				app.QueueUpdateDraw(func() {
+					statusView.SetText(renderExportProgress(progress))
+				})
+			case <-stopTicker:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for msg := range progressChan {
+			util.SaveLog(msg)
+			app.QueueUpdateDraw(func() {
+				fmt.Fprintln(progressView, msg)
+			})
+		}
+		close(stopTicker)
+
+		// After export is done
+		message := progress.Summary(exportErr, len(failed))
+		util.SaveLog(progress.Report())
+		app.QueueUpdateDraw(func() {
+			statusView.SetText(renderExportProgress(progress))
+
+			modal := tview.NewModal().SetText(message)
+			modal.AddButtons([]string{"OK", "View log", "Save report"}).
+				SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+					switch buttonLabel {
+					case "View log":
+						// Esc brings the summary back
+						layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+							if event.Key() == tcell.KeyEscape {
+								app.SetRoot(modal, true)
+								return nil
+							}
+							return event
+						})
+						app.SetRoot(layout, true)
+					case "Save report":
+						saveExportReport(app, progress, opts.OutputFile, modal)
+					default:
+						app.SetRoot(mainFlex, true)
+					}
+				})
+			app.SetRoot(modal, true)
+		})
+	}()
+}
@@ -0,0 +1,283 @@
+package ui
+
+import (
+	"fmt"
+	"mysql-tui/dump"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Object groups of the export tree, in display order
+var exportGroups = []struct {
+	Type  string
+	Label string
+}{
+	{"TABLE", "Tables"},
+	{"VIEW", "Views"},
+	{"PROCEDURE", "Procedures"},
+	{"FUNCTION", "Functions"},
+	{"TRIGGER", "Triggers"},
+	{"EVENT", "Events"},
+}
+
+// Masking rules file last entered in an export dialog, offered again by the others
+var lastMaskFile string
+
+// Check a masking rules file entered in a dialog and remember it; an empty path masks nothing
+func loadMaskFile(path string) (*dump.Masker, error) {
+	lastMaskFile = path
+	if path == "" {
+		return nil, nil
+	}
+	return dump.LoadMasker(path)
+}
+
+// Choose what to export and how, then run the export
+func showExportDialog(app *tview.Application, progressView *tview.TextView, dbName string) {
+	opts := dump.DefaultExportOptions()
+
+	selected := map[DBObject]bool{}
+	for _, obj := range allTables {
+		selected[obj] = true
+	}
+
+	root := tview.NewTreeNode(dbName).SetColor(tcell.ColorYellow)
+	tree := tview.NewTreeView().SetRoot(root).SetCurrentNode(root)
+	tree.SetBorder(true).SetTitle(" Objects ").SetTitleAlign(tview.AlignLeft)
+
+	// Leaves reference their DBObject, groups and the root reference nothing
+	var leaves func(node *tview.TreeNode) []*tview.TreeNode
+	leaves = func(node *tview.TreeNode) []*tview.TreeNode {
+		if _, ok := node.GetReference().(DBObject); ok {
+			return []*tview.TreeNode{node}
+		}
+		var out []*tview.TreeNode
+		for _, child := range node.GetChildren() {
+			out = append(out, leaves(child)...)
+		}
+		return out
+	}
+
+	labels := map[*tview.TreeNode]string{}
+	refresh := func(node *tview.TreeNode, label string) {
+		nodeLeaves := leaves(node)
+		checked := 0
+		for _, leaf := range nodeLeaves {
+			if selected[leaf.GetReference().(DBObject)] {
+				checked++
+			}
+		}
+		mark := "[ ]"
+		switch {
+		case len(nodeLeaves) > 0 && checked == len(nodeLeaves):
+			mark = "[x]"
+		case checked > 0:
+			mark = "[-]"
+		}
+		if _, ok := node.GetReference().(DBObject); ok {
+			node.SetText(tview.Escape(mark + " " + label))
+		} else {
+			node.SetText(tview.Escape(fmt.Sprintf("%s %s (%d/%d)", mark, label, checked, len(nodeLeaves))))
+		}
+	}
+	refreshAll := func() {
+		for node, label := range labels {
+			refresh(node, label)
+		}
+	}
+
+	labels[root] = dbName
+	for _, group := range exportGroups {
+		groupNode := tview.NewTreeNode("").SetColor(tcell.ColorAqua).SetExpanded(false)
+		for _, obj := range allTables {
+			if obj.Type != group.Type {
+				continue
+			}
+			leaf := tview.NewTreeNode("").SetReference(obj)
+			labels[leaf] = obj.Name
+			groupNode.AddChild(leaf)
+		}
+		if len(groupNode.GetChildren()) == 0 {
+			continue
+		}
+		labels[groupNode] = group.Label
+		root.AddChild(groupNode)
+	}
+	refreshAll()
+
+	toggle := func(node *tview.TreeNode) {
+		nodeLeaves := leaves(node)
+		check := false
+		for _, leaf := range nodeLeaves {
+			if !selected[leaf.GetReference().(DBObject)] {
+				check = true
+				break
+			}
+		}
+		for _, leaf := range nodeLeaves {
+			selected[leaf.GetReference().(DBObject)] = check
+		}
+		refreshAll()
+	}
+
+	form := tview.NewForm().
+		AddInputField("Directory", ".", 40, nil, nil).
+		AddInputField("File name", opts.OutputFile, 40, nil, nil).
+		AddDropDown("Layout", []string{"Single file", "Split files", "XLSX workbook (rows only)"}, 0, nil).
+		AddDropDown("Content", []string{"Schema and data", "Schema only", "Data only"}, 0, nil).
+		AddCheckbox("Compress (gzip)", opts.Compress, nil).
+		AddInputField("Batch size", strconv.Itoa(opts.BatchSize), 8, tview.InputFieldInteger, nil).
+		AddInputField("Workers", strconv.Itoa(opts.Workers), 8, tview.InputFieldInteger, nil).
+		AddCheckbox("DROP TABLE IF EXISTS", opts.DropTables, nil).
+		AddCheckbox("DROP VIEW IF EXISTS", opts.DropViews, nil).
+		AddCheckbox("DROP ROUTINE/TRIGGER/EVENT IF EXISTS", opts.DropRoutines, nil).
+		AddCheckbox("Consistent snapshot", opts.Consistent, nil).
+		AddCheckbox("Users and grants", opts.Grants, nil).
+		AddInputField("Masking rules", lastMaskFile, 40, nil, nil)
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).SetTitle(" Export " + dbName + " ").SetTitleAlign(tview.AlignLeft)
+
+	help := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText("[green]Space/Enter:[-] Toggle  [green]Tab:[-] Options  [green]Esc:[-] Back to objects / Cancel")
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(tview.NewFlex().
+			AddItem(tree, 0, 1, true).
+			AddItem(form, 0, 1, false), 0, 1, true).
+		AddItem(help, 1, 0, false)
+
+	cancel := func() {
+		app.SetRoot(mainFlex, true)
+	}
+
+	tree.SetSelectedFunc(toggle)
+	tree.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyTab:
+			app.SetFocus(form)
+			return nil
+		case event.Key() == tcell.KeyEscape:
+			cancel()
+			return nil
+		case event.Rune() == ' ':
+			if node := tree.GetCurrentNode(); node != nil {
+				toggle(node)
+			}
+			return nil
+		case event.Key() == tcell.KeyRight || event.Key() == tcell.KeyLeft:
+			if node := tree.GetCurrentNode(); node != nil && len(node.GetChildren()) > 0 {
+				node.SetExpanded(event.Key() == tcell.KeyRight)
+			}
+			return nil
+		}
+		return event
+	})
+	form.SetCancelFunc(func() {
+		app.SetFocus(tree)
+	})
+
+	text := func(label string) string {
+		return strings.TrimSpace(form.GetFormItemByLabel(label).(*tview.InputField).GetText())
+	}
+	checked := func(label string) bool {
+		return form.GetFormItemByLabel(label).(*tview.Checkbox).IsChecked()
+	}
+	option := func(label string) int {
+		index, _ := form.GetFormItemByLabel(label).(*tview.DropDown).GetCurrentOption()
+		return index
+	}
+
+	form.AddButton("Export", func() {
+		opts.Objects = nil
+		for _, obj := range allTables {
+			if selected[obj] {
+				opts.Objects = append(opts.Objects, obj)
+			}
+		}
+		if len(opts.Objects) == 0 {
+			showErrorModal(app, layout, "Select at least one object to export.")
+			return
+		}
+
+		dir, fileName := text("Directory"), text("File name")
+		if fileName == "" {
+			showErrorModal(app, layout, "Enter a file name.")
+			return
+		}
+		if dir == "" {
+			dir = "."
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			showErrorModal(app, layout, "Cannot create directory: "+err.Error())
+			return
+		}
+		opts.OutputFile = filepath.Join(dir, fileName)
+
+		var err error
+		if opts.BatchSize, err = strconv.Atoi(text("Batch size")); err != nil || opts.BatchSize < 1 {
+			showErrorModal(app, layout, "Batch size must be a positive number.")
+			return
+		}
+		if opts.Workers, err = strconv.Atoi(text("Workers")); err != nil || opts.Workers < 1 {
+			showErrorModal(app, layout, "Workers must be a positive number.")
+			return
+		}
+
+		opts.Layout = []string{dump.ExportLayoutSingle, dump.ExportLayoutSplit, dump.ExportLayoutXLSX}[option("Layout")]
+		opts.Content = []string{dump.ExportContentBoth, dump.ExportContentSchema, dump.ExportContentData}[option("Content")]
+		opts.Compress = checked("Compress (gzip)")
+		opts.DropTables = checked("DROP TABLE IF EXISTS")
+		opts.DropViews = checked("DROP VIEW IF EXISTS")
+		opts.DropRoutines = checked("DROP ROUTINE/TRIGGER/EVENT IF EXISTS")
+		opts.Consistent = checked("Consistent snapshot")
+		opts.Grants = checked("Users and grants")
+		opts.MaskFile = text("Masking rules")
+		if _, err := loadMaskFile(opts.MaskFile); err != nil {
+			showErrorModal(app, layout, "Cannot load the masking rules: "+err.Error())
+			return
+		}
+
+		if opts.Layout == dump.ExportLayoutXLSX {
+			runExport(app, progressView, dbName, opts)
+			return
+		}
+
+		// A manifest left behind means an earlier export to this file did not finish
+		manifest, err := dump.LoadManifest(opts.OutputFile)
+		if err != nil {
+			showErrorModal(app, layout, "Cannot read the manifest of an earlier export: "+err.Error())
+			return
+		}
+		if manifest == nil {
+			runExport(app, progressView, dbName, opts)
+			return
+		}
+		done, failed := manifest.Counts()
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("An unfinished export of %s to %s was found (started %s): %d object(s) done, %d failed.\n\nResume it with its original settings, or start over?",
+				manifest.Database, opts.OutputFile, manifest.Started.Format("2006-01-02 15:04"), done, failed)).
+			AddButtons([]string{"Resume", "Start over", "Cancel"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				switch buttonLabel {
+				case "Resume":
+					resumed := manifest.Options
+					resumed.Resume = true
+					runExport(app, progressView, dbName, resumed)
+				case "Start over":
+					runExport(app, progressView, dbName, opts)
+				default:
+					app.SetRoot(layout, true)
+				}
+			})
+		app.SetRoot(modal, true)
+	})
+	form.AddButton("Cancel", cancel)
+
+	app.SetRoot(layout, true).SetFocus(tree)
+}
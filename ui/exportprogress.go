@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"fmt"
+	"mysql-tui/dump"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// Status panel of an export: the totals, then a bar per running object
+func renderExportProgress(p *dump.ExportProgress) string {
+	t := p.Totals()
+
+	var b strings.Builder
+	finished := t.Done + t.Skipped + t.Failed
+	b.WriteString(fmt.Sprintf("Objects: [green]%d[-]/%d done", t.Done+t.Skipped, t.Objects))
+	if t.Failed > 0 {
+		b.WriteString(fmt.Sprintf(", [red]%d failed[-]", t.Failed))
+	}
+	b.WriteString(fmt.Sprintf("   Elapsed: %s", t.Elapsed.Round(time.Second)))
+	if finished < t.Objects && !t.Ended {
+		eta := "calculating"
+		if t.ETA > 0 {
+			eta = t.ETA.Round(time.Second).String()
+		}
+		b.WriteString("   ETA: " + eta)
+	}
+	b.WriteString("\n")
+
+	fraction := 1.0
+	if t.Estimated > 0 {
+		fraction = min(float64(t.Rows)/float64(t.Estimated), 1)
+	}
+	b.WriteString(fmt.Sprintf("Rows: %s %d / ~%d   %s written   %.0f rows/s, %s/s\n",
+		progressBar(fraction, 30), t.Rows, t.Estimated, dump.FormatBytes(t.Bytes),
+		t.RowsPerSecond, dump.FormatBytes(int64(t.BytesPerSecond))))
+
+	for _, entry := range p.Running() {
+		name := tview.Escape(entry.Type + " " + entry.Name)
+		if entry.Estimated > 0 {
+			fraction := min(float64(entry.Rows)/float64(entry.Estimated), 1)
+			b.WriteString(fmt.Sprintf("  %s %s: %d / ~%d rows, %s\n", progressBar(fraction, 20), name, entry.Rows, entry.Estimated, dump.FormatBytes(entry.Bytes)))
+		} else {
+			b.WriteString(fmt.Sprintf("  %s: %d rows, %s\n", name, entry.Rows, dump.FormatBytes(entry.Bytes)))
+		}
+	}
+	return b.String()
+}
+
+// Ask for a file name and write the report there
+func saveExportReport(app *tview.Application, progress *dump.ExportProgress, outputFile string, returnTo tview.Primitive) {
+	form := tview.NewForm().
+		AddInputField("Report file", outputFile+".report.txt", 50, nil, nil)
+	form.SetBorder(true).SetTitle(" Save export report ").SetTitleAlign(tview.AlignLeft)
+	form.SetCancelFunc(func() {
+		app.SetRoot(returnTo, true)
+	})
+	form.AddButton("Save", func() {
+		path := strings.TrimSpace(form.GetFormItemByLabel("Report file").(*tview.InputField).GetText())
+		if path == "" {
+			showErrorModal(app, form, "Enter a file name.")
+			return
+		}
+		if err := os.WriteFile(path, []byte(progress.Report()), 0644); err != nil {
+			showErrorModal(app, form, "Failed to save report: "+err.Error())
+			return
+		}
+		modal := tview.NewModal().
+			SetText("Report saved to " + path).
+			AddButtons([]string{"OK"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				app.SetRoot(returnTo, true)
+			})
+		app.SetRoot(modal, true)
+	})
+	form.AddButton("Cancel", func() {
+		app.SetRoot(returnTo, true)
+	})
+	app.SetRoot(form, true).SetFocus(form)
+}
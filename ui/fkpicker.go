@@ -0,0 +1,340 @@
+package ui
+
+import (
+	"database/sql"
+	"fmt"
+	"mysql-tui/phhistory"
+	"mysql-tui/util"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// How long the search waits for typing to pause before querying the referenced table
+const foreignKeySearchDelay = 300 * time.Millisecond
+
+// Column names that usually describe a row better than its key
+var preferredDisplayColumns = []string{"name", "title", "label", "username", "email", "code", "description"}
+
+// Pick a value for a foreign key cell from the referenced table; onDone (if set) replaces the return to the grid
+func showForeignKeyPicker(app *tview.Application, table *tview.Table, db *sql.DB, dbName, tableName string,
+	fk ForeignKey, keyColumns, keyValues []string, cell *tview.TableCell, onDone func()) {
+
+	column := fk.Columns[0]
+	refSchema := fk.RefSchema
+	refTable := fk.RefTable
+	refName := trailTableName(dbName, refSchema, refTable)
+	refColumn := fk.RefColumns[0]
+
+	displayColumn, err := phhistory.GetDisplayColumn(refSchema, refTable)
+	if err != nil {
+		util.SaveLog("Display column lookup failed: " + err.Error())
+	}
+	if displayColumn == "" {
+		displayColumn = guessDisplayColumn(db, refSchema, refTable, refColumn)
+	}
+	nullable, err := columnIsNullable(db, dbName, tableName, column)
+	if err != nil {
+		util.SaveLog("Nullability lookup failed: " + err.Error())
+	}
+
+	searchInput := tview.NewInputField().
+		SetLabel("Search: ").
+		SetFieldWidth(40).
+		SetFieldBackgroundColor(tcell.ColorBlack)
+
+	results := tview.NewTable().
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+
+	status := tview.NewTextView().SetDynamicColors(true)
+
+	var searchTimer *time.Timer
+	back := func() {
+		if searchTimer != nil {
+			searchTimer.Stop()
+		}
+		if onDone != nil {
+			onDone()
+			return
+		}
+		app.SetRoot(mainFlex, true)
+		util.SetFocusWithBorder(app, table)
+	}
+
+	load := func(filter string) {
+		results.Clear()
+		results.SetCell(0, 0, tview.NewTableCell("[::b]"+refColumn).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+		if displayColumn != "" {
+			results.SetCell(0, 1, tview.NewTableCell("[::b]"+displayColumn).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+		}
+
+		values, labels, err := lookupForeignKeyValues(db, refSchema, refTable, refColumn, displayColumn, filter)
+		if err != nil {
+			status.SetText("[red]" + tview.Escape(err.Error()))
+			return
+		}
+		row := 1
+		if nullable {
+			results.SetCell(row, 0, tview.NewTableCell("[gray](NULL)").SetReference(sql.NullString{}))
+			row++
+		}
+		for i, v := range values {
+			results.SetCell(row+i, 0, tview.NewTableCell(tview.Escape(v)).SetReference(sql.NullString{String: v, Valid: true}))
+			if displayColumn != "" {
+				results.SetCell(row+i, 1, tview.NewTableCell(tview.Escape(labels[i])))
+			}
+		}
+		status.SetText(fmt.Sprintf("[gray]%d match(es) in %s • Enter: Choose • Ctrl+D: Display column • Esc: Cancel", len(values), refName))
+	}
+
+	choose := func(value sql.NullString) {
+		if !isEditingEnabled {
+			showErrorModal(app, mainFlex, "Not allowed to update in Run Query mode")
+			return
+		}
+		if value.Valid {
+			exists, err := foreignKeyValueExists(db, refSchema, refTable, refColumn, value.String)
+			if err != nil {
+				status.SetText("[red]" + tview.Escape(err.Error()))
+				return
+			}
+			if !exists {
+				status.SetText(fmt.Sprintf("[red]%s = %s does not exist in %s", refColumn, tview.Escape(value.String), refName))
+				return
+			}
+		}
+		if err := updateCellValue(db, dbName, tableName, keyColumns, keyValues, column, value); err != nil {
+			showErrorModal(app, mainFlex, "Update failed: "+err.Error())
+			return
+		}
+		if value.Valid {
+			cell.SetText(value.String)
+		} else {
+			cell.SetText("[gray]NULL")
+		}
+		back()
+	}
+
+	var layout *tview.Flex
+
+	// Search once typing pauses instead of querying on every keystroke
+	searchInput.SetChangedFunc(func(text string) {
+		if searchTimer != nil {
+			searchTimer.Stop()
+		}
+		searchTimer = time.AfterFunc(foreignKeySearchDelay, func() {
+			app.QueueUpdateDraw(func() {
+				if searchInput.GetText() == text {
+					load(text)
+				}
+			})
+		})
+	})
+	searchInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyDown, tcell.KeyTab, tcell.KeyEnter:
+			// Leaving the field runs a search still waiting for its delay
+			if searchTimer != nil && searchTimer.Stop() {
+				load(searchInput.GetText())
+			}
+			app.SetFocus(results)
+			return nil
+		case tcell.KeyEscape:
+			back()
+			return nil
+		}
+		return event
+	})
+
+	results.SetSelectedFunc(func(row, col int) {
+		if row < 1 {
+			return
+		}
+		if value, ok := results.GetCell(row, 0).GetReference().(sql.NullString); ok {
+			choose(value)
+		}
+	})
+	results.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyTab:
+			app.SetFocus(searchInput)
+			return nil
+		case tcell.KeyEscape:
+			back()
+			return nil
+		case tcell.KeyCtrlD:
+			pickDisplayColumn(app, db, refSchema, refTable, layout, func(col string) {
+				displayColumn = col
+				if err := phhistory.SetDisplayColumn(refSchema, refTable, col); err != nil {
+					util.SaveLog("Failed to save display column: " + err.Error())
+				}
+				load(searchInput.GetText())
+				app.SetRoot(layout, true).SetFocus(results)
+			})
+			return nil
+		}
+		return event
+	})
+
+	layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(searchInput, 1, 0, true).
+		AddItem(results, 0, 1, false).
+		AddItem(status, 1, 0, false)
+	layout.SetBorder(true).
+		SetTitle(fmt.Sprintf(" Choose %s -> %s.%s (current: %s) ", column, refName, refColumn, tview.Escape(cell.Text))).
+		SetTitleAlign(tview.AlignLeft)
+
+	load("")
+	app.SetRoot(layout, true).SetFocus(searchInput)
+}
+
+// Fetch candidate keys (and their display values) from the referenced table
+func lookupForeignKeyValues(db *sql.DB, dbName, refTable, refColumn, displayColumn, filter string) ([]string, []string, error) {
+	columns := fmt.Sprintf("`%s`", refColumn)
+	if displayColumn != "" {
+		columns += fmt.Sprintf(", `%s`", displayColumn)
+	}
+	query := fmt.Sprintf("SELECT %s FROM `%s`.`%s`", columns, dbName, refTable)
+
+	var args []interface{}
+	if filter != "" {
+		like := "%" + filter + "%"
+		query += fmt.Sprintf(" WHERE CAST(`%s` AS CHAR) LIKE ?", refColumn)
+		args = append(args, like)
+		if displayColumn != "" {
+			query += fmt.Sprintf(" OR CAST(`%s` AS CHAR) LIKE ?", displayColumn)
+			args = append(args, like)
+		}
+	}
+	query += fmt.Sprintf(" ORDER BY `%s` LIMIT 200", refColumn)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var values, labels []string
+	for rows.Next() {
+		var value, label sql.NullString
+		dest := []interface{}{&value}
+		if displayColumn != "" {
+			dest = append(dest, &label)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		if !value.Valid {
+			continue
+		}
+		values = append(values, value.String)
+		labels = append(labels, label.String)
+	}
+	return values, labels, rows.Err()
+}
+
+func foreignKeyValueExists(db *sql.DB, dbName, refTable, refColumn, value string) (bool, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM `%s`.`%s` WHERE `%s` = ?", dbName, refTable, refColumn)
+	if err := db.QueryRow(query, value).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Choose a sensible text column to show next to the referenced key
+func guessDisplayColumn(db *sql.DB, dbName, tableName, keyColumn string) string {
+	columns, err := textColumns(db, dbName, tableName)
+	if err != nil {
+		util.SaveLog("Failed to read columns of " + tableName + ": " + err.Error())
+		return ""
+	}
+	for _, preferred := range preferredDisplayColumns {
+		for _, col := range columns {
+			if strings.EqualFold(col, preferred) && col != keyColumn {
+				return col
+			}
+		}
+	}
+	for _, col := range columns {
+		if col != keyColumn {
+			return col
+		}
+	}
+	return ""
+}
+
+func columnIsNullable(db *sql.DB, dbName, tableName, column string) (bool, error) {
+	var nullable string
+	err := db.QueryRow(`
+		SELECT IS_NULLABLE
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ?
+		  AND TABLE_NAME = ?
+		  AND COLUMN_NAME = ?
+	`, dbName, tableName, column).Scan(&nullable)
+	if err != nil {
+		return false, err
+	}
+	return nullable == "YES", nil
+}
+
+func textColumns(db *sql.DB, dbName, tableName string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT COLUMN_NAME
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ?
+		  AND TABLE_NAME = ?
+		  AND DATA_TYPE IN ('char', 'varchar', 'tinytext', 'text', 'mediumtext', 'enum')
+		ORDER BY ORDINAL_POSITION
+	`, dbName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+func pickDisplayColumn(app *tview.Application, db *sql.DB, dbName, tableName string, returnTo tview.Primitive, onSelect func(string)) {
+	rows, err := db.Query(`
+		SELECT COLUMN_NAME, COLUMN_TYPE
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ?
+		  AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`, dbName, tableName)
+	if err != nil {
+		showErrorModal(app, returnTo, "Failed to read columns: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	list := tview.NewList()
+	list.SetBorder(true).SetTitle(" Display column for " + tableName + " ").SetTitleAlign(tview.AlignLeft)
+	for rows.Next() {
+		var name, colType string
+		if err := rows.Scan(&name, &colType); err != nil {
+			continue
+		}
+		col := name
+		list.AddItem(col, colType, 0, func() {
+			onSelect(col)
+		})
+	}
+	list.SetDoneFunc(func() {
+		app.SetRoot(returnTo, true)
+	})
+	app.SetRoot(list, true).SetFocus(list)
+}
@@ -0,0 +1,344 @@
+package ui
+
+import (
+	"database/sql"
+	"fmt"
+	"mysql-tui/util"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ForeignKey describes one (possibly composite) foreign key constraint
+type ForeignKey struct {
+	Name       string
+	Schema     string
+	Table      string
+	Columns    []string
+	RefSchema  string // may differ from Schema: keys can point into another database
+	RefTable   string
+	RefColumns []string
+}
+
+func (fk ForeignKey) String() string {
+	refTable := fk.RefTable
+	if fk.RefSchema != fk.Schema {
+		refTable = fk.RefSchema + "." + refTable
+	}
+	return fmt.Sprintf("%s(%s) -> %s(%s)", fk.Table, strings.Join(fk.Columns, ", "), refTable, strings.Join(fk.RefColumns, ", "))
+}
+
+// A table name for the breadcrumb trail, qualified when it lies outside the database browsed
+func trailTableName(dbName, schema, table string) string {
+	if schema == dbName {
+		return table
+	}
+	return schema + "." + table
+}
+
+// A table query shown in the grid, kept in the breadcrumb trail
+type gridLocation struct {
+	DBName string
+	Table  string
+	Label  string
+	Query  string
+	Args   []interface{}
+}
+
+var gridTrail []gridLocation
+var gridForeignKeys []ForeignKey
+
+// Get the foreign keys declared on a table
+func GetForeignKeys(db *sql.DB, dbName, tableName string) ([]ForeignKey, error) {
+	return queryForeignKeys(db, `
+		SELECT CONSTRAINT_NAME, TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME,
+			REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = ?
+		  AND TABLE_NAME = ?
+		  AND REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION
+	`, dbName, tableName)
+}
+
+// Get the foreign keys of other tables, in any database, that point at this table
+func GetReferencingKeys(db *sql.DB, dbName, tableName string) ([]ForeignKey, error) {
+	return queryForeignKeys(db, `
+		SELECT CONSTRAINT_NAME, TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME,
+			REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE REFERENCED_TABLE_SCHEMA = ?
+		  AND REFERENCED_TABLE_NAME = ?
+		ORDER BY TABLE_SCHEMA <> REFERENCED_TABLE_SCHEMA, TABLE_SCHEMA, TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION
+	`, dbName, tableName)
+}
+
+func queryForeignKeys(db *sql.DB, query string, args ...interface{}) ([]ForeignKey, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		util.SaveLog("Error fetching foreign keys: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []ForeignKey
+	for rows.Next() {
+		var name, schema, table, column, refSchema, refTable, refColumn string
+		if err := rows.Scan(&name, &schema, &table, &column, &refSchema, &refTable, &refColumn); err != nil {
+			return nil, err
+		}
+		// Consecutive rows of the same constraint form a composite key
+		if n := len(keys); n > 0 && keys[n-1].Name == name && keys[n-1].Schema == schema && keys[n-1].Table == table {
+			keys[n-1].Columns = append(keys[n-1].Columns, column)
+			keys[n-1].RefColumns = append(keys[n-1].RefColumns, refColumn)
+			continue
+		}
+		keys = append(keys, ForeignKey{
+			Name:       name,
+			Schema:     schema,
+			Table:      table,
+			Columns:    []string{column},
+			RefSchema:  refSchema,
+			RefTable:   refTable,
+			RefColumns: []string{refColumn},
+		})
+	}
+	return keys, rows.Err()
+}
+
+// Find the foreign key a column belongs to, if any
+func foreignKeyForColumn(keys []ForeignKey, column string) (ForeignKey, bool) {
+	for _, fk := range keys {
+		for _, col := range fk.Columns {
+			if col == column {
+				return fk, true
+			}
+		}
+	}
+	return ForeignKey{}, false
+}
+
+// Highlight foreign key columns in the grid header and cells
+func markForeignKeyColumns(table *tview.Table, keys []ForeignKey) {
+	for col := 0; col < table.GetColumnCount(); col++ {
+		name := util.StripFormatting(table.GetCell(0, col).Text)
+		if _, ok := foreignKeyForColumn(keys, name); !ok {
+			continue
+		}
+		table.GetCell(0, col).SetText(fmt.Sprintf("[::b][aqua::u]%s", name))
+		for row := 1; row < table.GetRowCount(); row++ {
+			table.GetCell(row, col).SetTextColor(tcell.ColorAqua)
+		}
+	}
+}
+
+// Index of a column in the grid header, or -1
+func gridColumnIndex(table *tview.Table, column string) int {
+	for col := 0; col < table.GetColumnCount(); col++ {
+		if util.StripFormatting(table.GetCell(0, col).Text) == column {
+			return col
+		}
+	}
+	return -1
+}
+
+// Raw value of a grid cell; ExecuteQuery renders NULL as a gray marker
+func gridCellValue(table *tview.Table, row, col int) (string, bool) {
+	text := table.GetCell(row, col).Text
+	if text == "[gray]NULL" {
+		return "", false
+	}
+	return text, true
+}
+
+// Build "WHERE a = ? AND b = ?" from the values of the given grid columns
+func gridRowCondition(table *tview.Table, row int, gridColumns, whereColumns []string) (string, []interface{}, string, error) {
+	var conds, labels []string
+	var args []interface{}
+	for i, gridCol := range gridColumns {
+		idx := gridColumnIndex(table, gridCol)
+		if idx < 0 {
+			return "", nil, "", fmt.Errorf("column %s is not part of the result", gridCol)
+		}
+		value, ok := gridCellValue(table, row, idx)
+		if !ok {
+			return "", nil, "", fmt.Errorf("%s is NULL, nothing to follow", gridCol)
+		}
+		conds = append(conds, fmt.Sprintf("`%s` = ?", whereColumns[i]))
+		labels = append(labels, whereColumns[i]+"="+value)
+		args = append(args, value)
+	}
+	return strings.Join(conds, " AND "), args, strings.Join(labels, ", "), nil
+}
+
+// Start a new breadcrumb trail from a table or view opened in the object list
+func startGridTrail(db *sql.DB, dbName, tableName, query string, table *tview.Table) {
+	gridTrail = []gridLocation{{DBName: dbName, Table: tableName, Label: tableName, Query: query}}
+	applyGridLocation(db, gridTrail[0], table)
+}
+
+// Forget the trail when the grid shows a free-form query
+func clearGridTrail() {
+	gridTrail = nil
+	gridForeignKeys = nil
+}
+
+// Decorate the grid for the location currently on top of the trail
+func applyGridLocation(db *sql.DB, loc gridLocation, table *tview.Table) {
+	gridForeignKeys = nil
+	if loc.Table != "" {
+		keys, err := GetForeignKeys(db, loc.DBName, loc.Table)
+		if err == nil {
+			gridForeignKeys = keys
+			markForeignKeyColumns(table, keys)
+		}
+	}
+
+	var crumbs []string
+	for _, l := range gridTrail {
+		crumbs = append(crumbs, l.Label)
+	}
+	table.SetTitle(" [::b]" + tview.Escape(strings.Join(crumbs, " › ")) + "[::-] - [green]Ctrl+G:[-]Parent  [green]Ctrl+O:[-]Children  [green]Ctrl+B:[-]Back ")
+}
+
+// Run a location's query and make its table editable in the grid
+func openGridLocation(app *tview.Application, db *sql.DB, loc gridLocation, table *tview.Table) error {
+	if err := ExecuteQuery(app, db, loc.Query, table, loc.Args...); err != nil {
+		return err
+	}
+	isEditingEnabled = false
+	if err := EnableCellEditing(app, table, db, loc.DBName, loc.Table); err == nil {
+		isEditingEnabled = true
+	}
+	applyGridLocation(db, loc, table)
+	return nil
+}
+
+// Push a new location on the trail and show it
+func pushGridLocation(app *tview.Application, db *sql.DB, loc gridLocation, table *tview.Table) {
+	gridTrail = append(gridTrail, loc)
+	if err := openGridLocation(app, db, loc, table); err != nil {
+		gridTrail = gridTrail[:len(gridTrail)-1]
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "Navigation failed: "+err.Error())
+		return
+	}
+	layout := CreateLayoutWithFooter(app, mainFlex)
+	app.SetRoot(layout, true)
+	app.SetFocus(table)
+}
+
+// Go back to the previous location of the breadcrumb trail
+func popGridLocation(app *tview.Application, db *sql.DB, table *tview.Table) {
+	if len(gridTrail) < 2 {
+		return
+	}
+	gridTrail = gridTrail[:len(gridTrail)-1]
+	if err := openGridLocation(app, db, gridTrail[len(gridTrail)-1], table); err != nil {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "Navigation failed: "+err.Error())
+	}
+}
+
+// Open the row referenced by the selected foreign key cell
+func followForeignKey(app *tview.Application, db *sql.DB, table *tview.Table) {
+	if len(gridTrail) == 0 {
+		return
+	}
+	current := gridTrail[len(gridTrail)-1]
+	row, col := table.GetSelection()
+	if row < 1 {
+		return
+	}
+
+	var candidates []ForeignKey
+	if fk, ok := foreignKeyForColumn(gridForeignKeys, util.StripFormatting(table.GetCell(0, col).Text)); ok {
+		candidates = append(candidates, fk)
+	} else {
+		candidates = gridForeignKeys
+	}
+	if len(candidates) == 0 {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "No foreign keys on "+current.Table+".")
+		return
+	}
+
+	open := func(fk ForeignKey) {
+		cond, args, label, err := gridRowCondition(table, row, fk.Columns, fk.RefColumns)
+		if err != nil {
+			showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), err.Error())
+			return
+		}
+		pushGridLocation(app, db, gridLocation{
+			DBName: fk.RefSchema,
+			Table:  fk.RefTable,
+			Label:  fmt.Sprintf("%s(%s)", trailTableName(current.DBName, fk.RefSchema, fk.RefTable), label),
+			Query:  fmt.Sprintf("SELECT * FROM `%s`.`%s` WHERE %s LIMIT 100", fk.RefSchema, fk.RefTable, cond),
+			Args:   args,
+		}, table)
+	}
+
+	if len(candidates) == 1 {
+		open(candidates[0])
+		return
+	}
+	pickForeignKey(app, table, "Referenced table", candidates, open)
+}
+
+// List rows of other tables that reference the selected row
+func openReferencingRows(app *tview.Application, db *sql.DB, table *tview.Table) {
+	if len(gridTrail) == 0 {
+		return
+	}
+	current := gridTrail[len(gridTrail)-1]
+	row, _ := table.GetSelection()
+	if row < 1 || current.Table == "" {
+		return
+	}
+
+	keys, err := GetReferencingKeys(db, current.DBName, current.Table)
+	if err != nil {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "Failed to fetch referencing keys: "+err.Error())
+		return
+	}
+	if len(keys) == 0 {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "No tables reference "+current.Table+".")
+		return
+	}
+
+	open := func(fk ForeignKey) {
+		cond, args, label, err := gridRowCondition(table, row, fk.RefColumns, fk.Columns)
+		if err != nil {
+			showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), err.Error())
+			return
+		}
+		pushGridLocation(app, db, gridLocation{
+			DBName: fk.Schema,
+			Table:  fk.Table,
+			Label:  fmt.Sprintf("%s[%s]", trailTableName(current.DBName, fk.Schema, fk.Table), label),
+			Query:  fmt.Sprintf("SELECT * FROM `%s`.`%s` WHERE %s LIMIT 100", fk.Schema, fk.Table, cond),
+			Args:   args,
+		}, table)
+	}
+
+	if len(keys) == 1 {
+		open(keys[0])
+		return
+	}
+	pickForeignKey(app, table, "Referencing tables", keys, open)
+}
+
+func pickForeignKey(app *tview.Application, table *tview.Table, title string, keys []ForeignKey, onSelect func(ForeignKey)) {
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(" " + title + " ").SetTitleAlign(tview.AlignLeft)
+	for _, fk := range keys {
+		key := fk
+		list.AddItem(tview.Escape(key.String()), "", 0, func() {
+			onSelect(key)
+		})
+	}
+	list.SetDoneFunc(func() {
+		layout := CreateLayoutWithFooter(app, mainFlex)
+		app.SetRoot(layout, true)
+		app.SetFocus(table)
+	})
+	app.SetRoot(list, true).SetFocus(list)
+}
@@ -0,0 +1,234 @@
+package ui
+
+import (
+	"fmt"
+	"mysql-tui/phhistory"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Queries listed by the history browser
+const historyBrowserLimit = 500
+
+// Browse the queries run against the current database, searched as you type (best matches first).
+// Enter loads the selected query into the editor, Ctrl+R loads and runs it.
+func showQueryHistory(app *tview.Application, dbName string, queryBox *tview.TextArea, run func()) {
+	back := func() {
+		app.SetRoot(CreateLayoutWithFooter(app, mainFlex), true)
+		app.SetFocus(queryBox)
+	}
+
+	filter := tview.NewInputField().
+		SetLabel("Search: ").
+		SetFieldBackgroundColor(tcell.ColorBlack)
+	list := tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	list.SetBorder(true).SetTitleAlign(tview.AlignLeft)
+	preview := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(true)
+	preview.SetBorder(true).SetTitle(" Query ").SetTitleAlign(tview.AlignLeft)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(filter, 1, 0, true).
+		AddItem(list, 0, 2, false).
+		AddItem(preview, 0, 1, false)
+
+	// Ctrl+F cycles through the statuses shown, Ctrl+S puts the slowest queries first
+	statuses := []struct{ status, label string }{{"", "all"}, {phhistory.StatusOK, "succeeded"}, {phhistory.StatusError, "failed"}}
+	statusIndex, slowest := 0, false
+	setTitle := func() {
+		order := "best match / newest first"
+		if slowest {
+			order = "slowest first"
+		}
+		list.SetTitle(fmt.Sprintf(" [::b]Query History[::-] %s (%s, %s) - [green]Enter:[-]Load  [green]Ctrl+R:[-]Run  [green]Ctrl+F:[-]Status  [green]Ctrl+S:[-]Slowest  [green]Tab:[-]Search  [green]Esc:[-]Back ",
+			tview.Escape(dbName), statuses[statusIndex].label, order))
+	}
+
+	var entries []phhistory.HistoryEntry
+	load := func() {
+		setTitle()
+		var err error
+		entries, err = phhistory.SearchHistory(phhistory.HistoryFilter{
+			DBName:  dbName,
+			Text:    filter.GetText(),
+			Status:  statuses[statusIndex].status,
+			Slowest: slowest,
+			Limit:   historyBrowserLimit,
+		})
+		list.Clear()
+		for i, h := range []string{"#", "Time", "Duration", "Rows", "Status", "Query"} {
+			list.SetCell(0, i, tview.NewTableCell("[::b]"+h).
+				SetTextColor(tcell.ColorYellow).
+				SetSelectable(false))
+		}
+		if err != nil {
+			list.SetCell(1, 0, tview.NewTableCell("[red]"+tview.Escape(err.Error())).SetSelectable(false))
+			preview.SetText("")
+			return
+		}
+		for i, e := range entries {
+			row := i + 1
+			list.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("%d", e.ID)))
+			list.SetCell(row, 1, tview.NewTableCell(e.CreatedAt.Local().Format("2006-01-02 15:04:05")))
+			list.SetCell(row, 2, tview.NewTableCell(historyDuration(e)).SetAlign(tview.AlignRight))
+			list.SetCell(row, 3, tview.NewTableCell(historyRows(e)).SetAlign(tview.AlignRight))
+			list.SetCell(row, 4, tview.NewTableCell(historyStatus(e)))
+			text := tview.Escape(strings.Join(strings.Fields(e.Query), " "))
+			if e.Snippet != "" {
+				text = highlightSnippet(e.Snippet)
+			}
+			list.SetCell(row, 5, tview.NewTableCell(text).
+				SetMaxWidth(100).
+				SetExpansion(1))
+		}
+		if len(entries) == 0 {
+			list.SetCell(1, 0, tview.NewTableCell("[gray]No queries found").SetSelectable(false))
+			preview.SetText("")
+			return
+		}
+		list.Select(1, 0)
+		list.ScrollToBeginning()
+		preview.SetText(historyDetails(entries[0]))
+	}
+
+	selected := func() (phhistory.HistoryEntry, bool) {
+		row, _ := list.GetSelection()
+		if row < 1 || row > len(entries) {
+			return phhistory.HistoryEntry{}, false
+		}
+		return entries[row-1], true
+	}
+	use := func(andRun bool) {
+		entry, ok := selected()
+		if !ok {
+			return
+		}
+		back()
+		queryBox.SetText(entry.Query, true)
+		if andRun {
+			run()
+		}
+	}
+
+	list.SetSelectionChangedFunc(func(row, column int) {
+		if entry, ok := selected(); ok {
+			preview.SetText(historyDetails(entry))
+			preview.ScrollToBeginning()
+		}
+	})
+	list.SetSelectedFunc(func(row, column int) {
+		use(false)
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			back()
+			return nil
+		case tcell.KeyTab:
+			app.SetFocus(filter)
+			return nil
+		case tcell.KeyCtrlR:
+			use(true)
+			return nil
+		case tcell.KeyCtrlF:
+			statusIndex = (statusIndex + 1) % len(statuses)
+			load()
+			return nil
+		case tcell.KeyCtrlS:
+			slowest = !slowest
+			load()
+			return nil
+		}
+		return event
+	})
+
+	filter.SetChangedFunc(func(text string) {
+		load()
+	})
+	filter.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			back()
+			return nil
+		case tcell.KeyTab, tcell.KeyDown:
+			app.SetFocus(list)
+			return nil
+		case tcell.KeyEnter:
+			use(false)
+			return nil
+		case tcell.KeyCtrlR:
+			use(true)
+			return nil
+		case tcell.KeyCtrlF:
+			statusIndex = (statusIndex + 1) % len(statuses)
+			load()
+			return nil
+		case tcell.KeyCtrlS:
+			slowest = !slowest
+			load()
+			return nil
+		}
+		return event
+	})
+
+	load()
+	app.SetRoot(layout, true).SetFocus(filter)
+}
+
+// A search snippet on one line with its matched words highlighted
+func highlightSnippet(snippet string) string {
+	text := tview.Escape(strings.Join(strings.Fields(snippet), " "))
+	text = strings.ReplaceAll(text, phhistory.HighlightStart, "[yellow::b]")
+	return strings.ReplaceAll(text, phhistory.HighlightEnd, "[-::-]")
+}
+
+// Columns of a history entry; queries recorded by older versions show blanks
+func historyDuration(e phhistory.HistoryEntry) string {
+	if e.Status == "" {
+		return ""
+	}
+	if e.Duration < time.Second {
+		return fmt.Sprintf("%d ms", e.Duration.Milliseconds())
+	}
+	return fmt.Sprintf("%.1f s", e.Duration.Seconds())
+}
+
+func historyRows(e phhistory.HistoryEntry) string {
+	switch {
+	case e.Rows >= 0:
+		return fmt.Sprintf("%d", e.Rows)
+	case e.Affected >= 0:
+		return fmt.Sprintf("%d affected", e.Affected)
+	}
+	return ""
+}
+
+func historyStatus(e phhistory.HistoryEntry) string {
+	switch e.Status {
+	case phhistory.StatusOK:
+		return "[green]ok"
+	case phhistory.StatusError:
+		return "[red]error"
+	}
+	return ""
+}
+
+// The full query under the list, with the error of a failed one
+func historyDetails(e phhistory.HistoryEntry) string {
+	var b strings.Builder
+	if e.Error != "" {
+		b.WriteString("[red]" + tview.Escape(e.Error) + "[-]\n\n")
+	}
+	b.WriteString(tview.Escape(e.Query))
+	if e.Profile != "" {
+		b.WriteString("\n\n[gray]" + tview.Escape(e.Profile) + "[-]")
+	}
+	return b.String()
+}
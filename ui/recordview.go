@@ -0,0 +1,185 @@
+package ui
+
+import (
+	"database/sql"
+	"fmt"
+	"mysql-tui/util"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Show one grid row as a vertical record (\G style): column, type and value per line
+func showRecordView(app *tview.Application, db *sql.DB, dataTable *tview.Table, row int) {
+	rowCount := dataTable.GetRowCount()
+	if row < 1 || row >= rowCount {
+		return
+	}
+
+	// Editing needs the table on top of the breadcrumb trail and its primary key
+	var editTable, editDB string
+	var keyColumns []string
+	var foreignKeys []ForeignKey
+	columnTypes := map[string]string{}
+	if isEditingEnabled && len(gridTrail) > 0 {
+		loc := gridTrail[len(gridTrail)-1]
+		if pk, err := GetPrimaryKeyColumns(db, loc.DBName, loc.Table); err == nil {
+			editDB, editTable, keyColumns = loc.DBName, loc.Table, pk
+			foreignKeys = gridForeignKeys
+			columnTypes = tableColumnTypes(db, loc.DBName, loc.Table)
+		}
+	}
+
+	record := tview.NewTable().
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	record.SetBorder(true).SetTitleAlign(tview.AlignLeft)
+
+	current := row
+
+	back := func() {
+		dataTable.Select(current, 0)
+		layout := CreateLayoutWithFooter(app, mainFlex)
+		app.SetRoot(layout, true)
+		app.SetFocus(dataTable)
+	}
+
+	render := func() {
+		selected, _ := record.GetSelection()
+		record.Clear()
+		for i, h := range []string{"Column", "Type", "Value"} {
+			record.SetCell(0, i, tview.NewTableCell("[::b]"+h).
+				SetTextColor(tcell.ColorYellow).
+				SetSelectable(false))
+		}
+		for col := 0; col < dataTable.GetColumnCount(); col++ {
+			name := util.StripFormatting(dataTable.GetCell(0, col).Text)
+			colType := columnTypes[name]
+			if colType == "" && col < len(lastResultColumns) {
+				colType = resultTypeName(lastResultColumns[col])
+			}
+			nameCell := tview.NewTableCell(tview.Escape(name)).SetTextColor(tcell.ColorWhite)
+			if _, ok := foreignKeyForColumn(foreignKeys, name); ok {
+				nameCell.SetTextColor(tcell.ColorAqua)
+			}
+			record.SetCell(col+1, 0, nameCell)
+			record.SetCell(col+1, 1, tview.NewTableCell(colType).SetTextColor(tcell.ColorGray))
+			record.SetCell(col+1, 2, tview.NewTableCell(dataTable.GetCell(current, col).Text).SetExpansion(1))
+		}
+
+		editHint := ""
+		if editTable != "" {
+			editHint = "  [green]Enter:[-]Edit"
+		}
+		record.SetTitle(fmt.Sprintf(" [::b]Row %d of %d[::-] - [green]n/PgDn:[-]Next  [green]p/PgUp:[-]Previous%s  [green]Esc:[-]Back ",
+			current, rowCount-1, editHint))
+		if selected < 1 {
+			selected = 1
+		}
+		record.Select(selected, 0)
+	}
+
+	record.SetSelectedFunc(func(r, c int) {
+		if editTable == "" || r < 1 {
+			return
+		}
+		col := r - 1
+		columnName := util.StripFormatting(dataTable.GetCell(0, col).Text)
+		keyValues, err := gridRowKey(dataTable, current, keyColumns)
+		if err != nil {
+			showErrorModal(app, record, "Cannot edit this row: "+err.Error())
+			return
+		}
+		cell := dataTable.GetCell(current, col)
+
+		returnToRecord := func() {
+			render()
+			app.SetRoot(record, true).SetFocus(record)
+		}
+
+		if fk, ok := foreignKeyForColumn(foreignKeys, columnName); ok && len(fk.Columns) == 1 {
+			showForeignKeyPicker(app, dataTable, db, editDB, editTable, fk, keyColumns, keyValues, cell, returnToRecord)
+			return
+		}
+
+		textArea := tview.NewTextArea()
+		textArea.
+			SetBorder(true).
+			SetTitle(fmt.Sprintf("Edit %s (Enter=Save, Esc=Cancel)", columnName))
+		textArea.SetText(cell.Text, true)
+		textArea.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			switch event.Key() {
+			case tcell.KeyEnter:
+				newValue := textArea.GetText()
+				if err := updateCell(db, editDB, editTable, keyColumns, keyValues, columnName, newValue); err != nil {
+					showErrorModal(app, record, "Update failed: "+err.Error())
+					return nil
+				}
+				cell.SetText(newValue)
+				returnToRecord()
+				return nil
+			case tcell.KeyEscape:
+				returnToRecord()
+				return nil
+			}
+			return event
+		})
+		app.SetRoot(textArea, true).SetFocus(textArea)
+	})
+
+	record.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEscape:
+			back()
+			return nil
+		case event.Key() == tcell.KeyPgDn || event.Rune() == 'n':
+			if current < rowCount-1 {
+				current++
+				render()
+			}
+			return nil
+		case event.Key() == tcell.KeyPgUp || event.Rune() == 'p':
+			if current > 1 {
+				current--
+				render()
+			}
+			return nil
+		}
+		return event
+	})
+
+	render()
+	app.SetRoot(record, true).SetFocus(record)
+}
+
+// Full column types (e.g. varchar(100)) of a table, keyed by column name
+func tableColumnTypes(db *sql.DB, dbName, tableName string) map[string]string {
+	types := map[string]string{}
+	rows, err := db.Query(`
+		SELECT COLUMN_NAME, COLUMN_TYPE
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ?
+		  AND TABLE_NAME = ?
+	`, dbName, tableName)
+	if err != nil {
+		util.SaveLog("Failed to read column types: " + err.Error())
+		return types
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, colType string
+		if err := rows.Scan(&name, &colType); err == nil {
+			types[name] = colType
+		}
+	}
+	return types
+}
+
+func resultTypeName(ct *sql.ColumnType) string {
+	name := ct.DatabaseTypeName()
+	if nullable, ok := ct.Nullable(); ok && nullable {
+		name += " NULL"
+	}
+	return name
+}
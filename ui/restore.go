@@ -0,0 +1,220 @@
+package ui
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"mysql-tui/dump"
+	"mysql-tui/util"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Pick a file with one of the given extensions; Esc returns to returnTo
+func pickFile(app *tview.Application, currentDir string, exts []string, title string, returnTo tview.Primitive, onPick func(path string)) {
+	list := tview.NewList().ShowSecondaryText(true)
+	list.SetBorder(true).SetTitle(" " + title + " ").SetTitleAlign(tview.AlignLeft)
+
+	if currentDir != "/" {
+		parent := filepath.Dir(currentDir)
+		list.AddItem("[::b]<..>", "Go up a directory", 'u', func() {
+			pickFile(app, parent, exts, title, returnTo, onPick)
+		})
+	}
+
+	entries, err := os.ReadDir(currentDir)
+	if err != nil {
+		showErrorModal(app, returnTo, "Failed to read directory: "+err.Error())
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	for _, entry := range entries {
+		name := entry.Name()
+		fullPath := filepath.Join(currentDir, name)
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			continue
+		}
+		meta := fmt.Sprintf("%d bytes | %s", info.Size(), info.ModTime().Format("2006-01-02 15:04"))
+
+		if info.IsDir() {
+			list.AddItem(tview.Escape(name), meta, 0, func() {
+				pickFile(app, fullPath, exts, title, returnTo, onPick)
+			})
+			continue
+		}
+		for _, ext := range exts {
+			if strings.HasSuffix(strings.ToLower(name), ext) {
+				list.AddItem("[green]"+tview.Escape(name), meta, 0, func() {
+					onPick(fullPath)
+				})
+				break
+			}
+		}
+	}
+
+	list.SetDoneFunc(func() {
+		app.SetRoot(returnTo, true)
+	})
+
+	statusBar := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText(fmt.Sprintf("[::b]Current Directory: [white]%s", tview.Escape(currentDir)))
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, true).
+		AddItem(statusBar, 1, 0, false)
+	app.SetRoot(layout, true).SetFocus(list)
+}
+
+// Choose a .sql / .sql.gz dump and load it into the current database
+func showRestoreDialog(app *tview.Application, db *sql.DB, dbName string) {
+	returnTo := CreateLayoutWithFooter(app, mainFlex)
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "."
+	}
+
+	pickFile(app, cwd, []string{".sql", ".sql.gz", ".gz"}, "Restore into "+dbName, returnTo, func(path string) {
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("Restore %s into %s?\n\nStatements in the file may drop and replace existing objects.", filepath.Base(path), dbName)).
+			AddButtons([]string{"Stop on error", "Skip and log", "Cancel"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				switch buttonLabel {
+				case "Stop on error", "Skip and log":
+					runRestore(app, db, dbName, dump.RestoreOptions{
+						File:        path,
+						Database:    dbName,
+						StopOnError: buttonLabel == "Stop on error",
+					})
+				default:
+					app.SetRoot(returnTo, true)
+				}
+			})
+		app.SetRoot(modal, true)
+	})
+}
+
+// Run the restore in the background with a live progress view; Esc stops it
+func runRestore(app *tview.Application, db *sql.DB, dbName string, opts dump.RestoreOptions) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	status := tview.NewTextView().SetDynamicColors(true)
+	status.SetBorder(true).SetTitle(" Restore " + filepath.Base(opts.File) + " ").SetTitleAlign(tview.AlignLeft)
+
+	errorsView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+	errorsView.SetBorder(true).SetTitle(" Errors ").SetTitleAlign(tview.AlignLeft)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(status, 7, 0, false).
+		AddItem(errorsView, 0, 1, true)
+
+	started := time.Now()
+	done := false
+	render := func(p dump.RestoreProgress, state string) {
+		percent := 0.0
+		if p.TotalBytes > 0 {
+			percent = float64(p.BytesRead) * 100 / float64(p.TotalBytes)
+		}
+		status.SetText(fmt.Sprintf("%s\n[white]Read: %s of %s (%.1f%%)\nStatements: %d  [red]Failed: %d[-]\nElapsed: %s",
+			state, dump.FormatBytes(p.BytesRead), dump.FormatBytes(p.TotalBytes), percent,
+			p.Statements, p.Failed, time.Since(started).Round(time.Second)))
+	}
+	render(dump.RestoreProgress{}, "[blue]Restoring... (Esc: Stop)")
+
+	// Failed statements also go to <file>.errors.log so they can be fixed and replayed
+	var errorLog *os.File
+	var logMu sync.Mutex
+	logPath := opts.File + ".errors.log"
+
+	onError := func(e dump.RestoreError) {
+		util.SaveLog("Restore error: " + e.Error())
+		logMu.Lock()
+		if errorLog == nil {
+			if f, err := os.Create(logPath); err == nil {
+				errorLog = f
+			}
+		}
+		if errorLog != nil {
+			fmt.Fprintf(errorLog, "-- line %d: %v\n%s;\n\n", e.Line, e.Err, e.Statement)
+		}
+		logMu.Unlock()
+
+		app.QueueUpdateDraw(func() {
+			fmt.Fprintf(errorsView, "[yellow]line %d:[-] %s\n  [gray]%s[-]\n",
+				e.Line, tview.Escape(e.Err.Error()), tview.Escape(dump.Abbreviate(e.Statement, 200)))
+		})
+	}
+
+	var lastDraw time.Time
+	onProgress := func(p dump.RestoreProgress) {
+		if time.Since(lastDraw) < 200*time.Millisecond {
+			return
+		}
+		lastDraw = time.Now()
+		app.QueueUpdateDraw(func() {
+			if !done {
+				render(p, "[blue]Restoring... (Esc: Stop)")
+			}
+		})
+	}
+
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			if !done {
+				cancel()
+				return nil
+			}
+			// Reload the object list, the restore may have created or dropped objects
+			UseDatabase(app, db, dbName)
+			return nil
+		}
+		return event
+	})
+
+	go func() {
+		progress, err := dump.Restore(ctx, db, opts, onProgress, onError)
+		cancel()
+
+		logMu.Lock()
+		if errorLog != nil {
+			errorLog.Close()
+		}
+		logMu.Unlock()
+
+		state := "[green]Restore completed."
+		switch {
+		case err == context.Canceled:
+			state = "[yellow]Restore stopped."
+		case err != nil:
+			state = "[red]Restore failed: " + tview.Escape(err.Error())
+		}
+		if progress.Failed > 0 {
+			state += fmt.Sprintf(" [yellow]%d failed statement(s) logged to %s", progress.Failed, tview.Escape(logPath))
+		}
+		util.SaveLog(fmt.Sprintf("Restore of %s into %s: %d statements, %d failed, err=%v",
+			opts.File, dbName, progress.Statements, progress.Failed, err))
+
+		app.QueueUpdateDraw(func() {
+			done = true
+			render(progress, state+"\n[white]Esc: Back")
+		})
+	}()
+
+	app.SetRoot(layout, true).SetFocus(layout)
+}
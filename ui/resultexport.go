@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"mysql-tui/dump"
+	"mysql-tui/util"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Statements that only read, so re-running them for an export is safe
+var readOnlyQueryRegex = regexp.MustCompile(`(?i)^\s*(SELECT|WITH|SHOW|DESCRIBE|DESC|EXPLAIN|TABLE|VALUES)\b`)
+
+// Labels of the formats in the export dialog, in dump.ResultFormats order
+var resultFormatLabels = map[string]string{
+	dump.FormatCSV:      "CSV",
+	dump.FormatTSV:      "TSV",
+	dump.FormatJSON:     "JSON",
+	dump.FormatNDJSON:   "NDJSON (one object per line)",
+	dump.FormatMarkdown: "Markdown table",
+	dump.FormatHTML:     "HTML table",
+	dump.FormatSQL:      "SQL INSERT statements",
+	dump.FormatXLSX:     "Excel workbook (XLSX)",
+}
+
+// Export the current result to a file or the clipboard
+func showResultExport(app *tview.Application, db *sql.DB, dataTable *tview.Table) {
+	if dataTable.GetRowCount() == 0 || dataTable.GetColumnCount() == 0 {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "There is no result to export.")
+		return
+	}
+
+	back := func() {
+		app.SetRoot(CreateLayoutWithFooter(app, mainFlex), true)
+		app.SetFocus(dataTable)
+	}
+
+	tableName := "exported_rows"
+	if len(gridTrail) > 0 {
+		tableName = gridTrail[len(gridTrail)-1].Table
+	}
+	rerun := lastExecutedQuery != "" && readOnlyQueryRegex.MatchString(lastExecutedQuery)
+
+	labels := make([]string, len(dump.ResultFormats))
+	for i, f := range dump.ResultFormats {
+		labels[i] = resultFormatLabels[f]
+	}
+
+	form := tview.NewForm()
+	var fileField *tview.InputField
+
+	form.AddDropDown("Format", labels, 0, func(option string, index int) {
+		if fileField == nil || index < 0 {
+			return
+		}
+		// Keep the file name, switch its extension
+		name := fileField.GetText()
+		for _, f := range dump.ResultFormats {
+			name = strings.TrimSuffix(name, dump.FormatExtension(f))
+		}
+		fileField.SetText(name + dump.FormatExtension(dump.ResultFormats[index]))
+	})
+	form.AddDropDown("Destination", []string{"File", "Clipboard"}, 0, nil)
+	form.AddInputField("File", "result"+dump.FormatExtension(dump.ResultFormats[0]), 40, nil, nil)
+	fileField = form.GetFormItemByLabel("File").(*tview.InputField)
+	form.AddInputField("INSERT table name", tableName, 30, nil, nil)
+	form.AddInputField("Masking rules", lastMaskFile, 40, nil, nil)
+
+	source := "the current grid contents"
+	if rerun {
+		source = "the full result of the last query (re-run)"
+	}
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).
+		SetTitle(" Export result - " + source + " ").
+		SetTitleAlign(tview.AlignLeft)
+	form.SetCancelFunc(back)
+
+	form.AddButton("Export", func() {
+		formatIndex, _ := form.GetFormItemByLabel("Format").(*tview.DropDown).GetCurrentOption()
+		destIndex, _ := form.GetFormItemByLabel("Destination").(*tview.DropDown).GetCurrentOption()
+		opts := dump.ResultOptions{
+			Format:    dump.ResultFormats[formatIndex],
+			TableName: strings.TrimSpace(form.GetFormItemByLabel("INSERT table name").(*tview.InputField).GetText()),
+		}
+		// Rules of the browsed table apply to its columns, *.column rules to any result
+		masker, err := loadMaskFile(strings.TrimSpace(form.GetFormItemByLabel("Masking rules").(*tview.InputField).GetText()))
+		if err != nil {
+			showErrorModal(app, form, "Cannot load the masking rules: "+err.Error())
+			return
+		}
+		opts.Mask = masker
+		if len(gridTrail) > 0 {
+			opts.MaskTable = gridTrail[len(gridTrail)-1].Table
+		}
+		path := strings.TrimSpace(fileField.GetText())
+		toClipboard := destIndex == 1
+		if toClipboard && opts.Format == dump.FormatXLSX {
+			showErrorModal(app, form, "XLSX workbooks can only be written to a file.")
+			return
+		}
+		if !toClipboard && path == "" {
+			showErrorModal(app, form, "Enter a file name.")
+			return
+		}
+
+		var buf bytes.Buffer
+		var out io.Writer = &buf
+		var file *os.File
+		if !toClipboard {
+			f, err := os.Create(path)
+			if err != nil {
+				showErrorModal(app, form, "Cannot create file: "+err.Error())
+				return
+			}
+			file = f
+			out = f
+		}
+
+		count, err := writeResult(db, dataTable, rerun, out, opts)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err == nil && toClipboard {
+			err = clipboard.WriteAll(buf.String())
+		}
+		if err != nil {
+			util.SaveLog("Result export failed: " + err.Error())
+			showErrorModal(app, form, "Export failed: "+err.Error())
+			return
+		}
+
+		message := fmt.Sprintf("Exported %d row(s) to %s.", count, path)
+		if toClipboard {
+			message = fmt.Sprintf("Copied %d row(s) to the clipboard.", count)
+		}
+		modal := tview.NewModal().
+			SetText(message).
+			AddButtons([]string{"OK"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				back()
+			})
+		app.SetRoot(modal, true)
+	})
+	form.AddButton("Cancel", back)
+
+	app.SetRoot(form, true).SetFocus(form)
+}
+
+// Re-run the last query when it only reads, otherwise export what the grid shows
+func writeResult(db *sql.DB, dataTable *tview.Table, rerun bool, out io.Writer, opts dump.ResultOptions) (int, error) {
+	if !rerun {
+		return dump.WriteResults(out, gridSource(dataTable), opts)
+	}
+	rows, err := db.Query(lastExecutedQuery, lastExecutedArgs...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	return dump.WriteResults(out, dump.NewRowsSource(rows), opts)
+}
+
+// The grid as a result set; cells shown as NULL become NULL
+func gridSource(dataTable *tview.Table) *dump.SliceSource {
+	src := &dump.SliceSource{}
+	for col := 0; col < dataTable.GetColumnCount(); col++ {
+		src.Cols = append(src.Cols, util.StripFormatting(dataTable.GetCell(0, col).Text))
+		if col < len(lastResultColumns) {
+			src.Typs = append(src.Typs, lastResultColumns[col].DatabaseTypeName())
+		}
+	}
+	if len(src.Typs) != len(src.Cols) {
+		src.Typs = nil
+	}
+	for row := 1; row < dataTable.GetRowCount(); row++ {
+		values := make([]interface{}, len(src.Cols))
+		for col := range src.Cols {
+			if value, ok := gridCellValue(dataTable, row, col); ok {
+				values[col] = []byte(value)
+			}
+		}
+		src.Rows = append(src.Rows, values)
+	}
+	return src
+}
@@ -0,0 +1,336 @@
+package ui
+
+import (
+	"fmt"
+	"mysql-tui/phhistory"
+	"mysql-tui/util"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Directory the snippet library is exported to and imported from, kept between uses
+var lastSnippetDir = "snippets"
+
+// Browse the snippet library, searched as you type. Enter inserts the selected snippet at the cursor of
+// the editor, asking for its placeholders first; Ctrl+N saves the editor's query as a new snippet.
+func showSnippetLibrary(app *tview.Application, queryBox *tview.TextArea) {
+	back := func() {
+		app.SetRoot(CreateLayoutWithFooter(app, mainFlex), true)
+		app.SetFocus(queryBox)
+	}
+
+	filter := tview.NewInputField().
+		SetLabel("Search: ").
+		SetFieldBackgroundColor(tcell.ColorBlack)
+	list := tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	list.SetBorder(true).
+		SetTitle(" [::b]Snippets[::-] - [green]Enter:[-]Insert  [green]Ctrl+N:[-]New  [green]Ctrl+E:[-]Edit  [green]Ctrl+D:[-]Delete  [green]Ctrl+L:[-]Export/Import  [green]Tab:[-]Search  [green]Esc:[-]Back ").
+		SetTitleAlign(tview.AlignLeft)
+	preview := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(true)
+	preview.SetBorder(true).SetTitle(" Snippet ").SetTitleAlign(tview.AlignLeft)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(filter, 1, 0, true).
+		AddItem(list, 0, 2, false).
+		AddItem(preview, 0, 1, false)
+
+	var snippets []phhistory.Snippet
+	load := func() {
+		var err error
+		snippets, err = phhistory.ListSnippets(filter.GetText())
+		list.Clear()
+		for i, h := range []string{"Folder", "Name", "Tags", "Description"} {
+			list.SetCell(0, i, tview.NewTableCell("[::b]"+h).
+				SetTextColor(tcell.ColorYellow).
+				SetSelectable(false))
+		}
+		if err != nil {
+			list.SetCell(1, 0, tview.NewTableCell("[red]"+tview.Escape(err.Error())).SetSelectable(false))
+			preview.SetText("")
+			return
+		}
+		for i, s := range snippets {
+			row := i + 1
+			list.SetCell(row, 0, tview.NewTableCell(tview.Escape(s.Folder)).SetTextColor(tcell.ColorGray))
+			list.SetCell(row, 1, tview.NewTableCell(tview.Escape(s.Name)))
+			list.SetCell(row, 2, tview.NewTableCell(tview.Escape(strings.Join(s.Tags, ", "))).
+				SetTextColor(tcell.ColorTeal).
+				SetMaxWidth(30))
+			list.SetCell(row, 3, tview.NewTableCell(tview.Escape(s.Description)).
+				SetMaxWidth(80).
+				SetExpansion(1))
+		}
+		if len(snippets) == 0 {
+			list.SetCell(1, 0, tview.NewTableCell("[gray]No snippets found").SetSelectable(false))
+			preview.SetText("")
+			return
+		}
+		list.Select(1, 0)
+		list.ScrollToBeginning()
+		preview.SetText(snippetDetails(snippets[0]))
+	}
+
+	selected := func() (phhistory.Snippet, bool) {
+		row, _ := list.GetSelection()
+		if row < 1 || row > len(snippets) {
+			return phhistory.Snippet{}, false
+		}
+		return snippets[row-1], true
+	}
+	reopen := func() {
+		app.SetRoot(layout, true).SetFocus(list)
+		load()
+	}
+	insert := func() {
+		s, ok := selected()
+		if !ok {
+			return
+		}
+		fillSnippet(app, s, layout, func(text string) {
+			back()
+			_, start, end := queryBox.GetSelection()
+			queryBox.Replace(start, end, text)
+		})
+	}
+
+	// Keys shared by the search field and the list
+	keys := func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			back()
+			return nil
+		case tcell.KeyCtrlN:
+			editSnippet(app, phhistory.Snippet{Body: queryBox.GetText()}, layout, reopen)
+			return nil
+		case tcell.KeyCtrlE:
+			if s, ok := selected(); ok {
+				editSnippet(app, s, layout, reopen)
+			}
+			return nil
+		case tcell.KeyCtrlD:
+			s, ok := selected()
+			if !ok {
+				return nil
+			}
+			modal := tview.NewModal().
+				SetText("Delete the snippet " + s.Path() + "?").
+				AddButtons([]string{"Delete", "Cancel"}).
+				SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+					if buttonLabel == "Delete" {
+						if err := phhistory.DeleteSnippet(s.ID); err != nil {
+							showErrorModal(app, layout, err.Error())
+							return
+						}
+					}
+					reopen()
+				})
+			app.SetRoot(modal, true)
+			return nil
+		case tcell.KeyCtrlL:
+			showSnippetFiles(app, layout, reopen)
+			return nil
+		}
+		return event
+	}
+
+	list.SetSelectionChangedFunc(func(row, column int) {
+		if s, ok := selected(); ok {
+			preview.SetText(snippetDetails(s))
+			preview.ScrollToBeginning()
+		}
+	})
+	list.SetSelectedFunc(func(row, column int) {
+		insert()
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyTab {
+			app.SetFocus(filter)
+			return nil
+		}
+		return keys(event)
+	})
+
+	filter.SetChangedFunc(func(text string) {
+		load()
+	})
+	filter.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyTab, tcell.KeyDown:
+			app.SetFocus(list)
+			return nil
+		case tcell.KeyEnter:
+			insert()
+			return nil
+		}
+		return keys(event)
+	})
+
+	load()
+	app.SetRoot(layout, true).SetFocus(filter)
+}
+
+// Ask for the values of a snippet's placeholders, prefilled with their defaults, and pass on the
+// filled-in body; a snippet without placeholders is passed on as is
+func fillSnippet(app *tview.Application, s phhistory.Snippet, returnTo tview.Primitive, done func(text string)) {
+	placeholders := phhistory.Placeholders(s.Body)
+	if len(placeholders) == 0 {
+		done(s.Body)
+		return
+	}
+
+	form := tview.NewForm()
+	for _, p := range placeholders {
+		form.AddInputField(p.Name, p.Default, 40, nil, nil)
+	}
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).SetTitle(" " + tview.Escape(s.Path()) + " ").SetTitleAlign(tview.AlignLeft)
+
+	form.AddButton("Insert", func() {
+		values := map[string]string{}
+		for _, p := range placeholders {
+			values[p.Name] = form.GetFormItemByLabel(p.Name).(*tview.InputField).GetText()
+		}
+		done(phhistory.FillPlaceholders(s.Body, values))
+	})
+	form.AddButton("Cancel", func() {
+		app.SetRoot(returnTo, true)
+	})
+	form.SetCancelFunc(func() {
+		app.SetRoot(returnTo, true)
+	})
+
+	app.SetRoot(form, true).SetFocus(form)
+}
+
+// Add or change a snippet; saved is called once it is stored
+func editSnippet(app *tview.Application, s phhistory.Snippet, returnTo tview.Primitive, saved func()) {
+	title := " Edit snippet " + tview.Escape(s.Path()) + " "
+	if s.ID == 0 {
+		title = " New snippet "
+	}
+
+	body := tview.NewTextArea().SetText(s.Body, false)
+	form := tview.NewForm().
+		AddInputField("Folder", s.Folder, 40, nil, nil).
+		AddInputField("Name", s.Name, 40, nil, nil).
+		AddInputField("Description", s.Description, 60, nil, nil).
+		AddInputField("Tags", strings.Join(s.Tags, ", "), 60, nil, nil).
+		AddFormItem(body.SetLabel("Query").SetSize(8, 0))
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+
+	help := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText("[gray]Folders nest with /, e.g. Reports/Monthly. Tags are separated by commas.\n" +
+			"${name} or ${name:default} in the query is asked for when the snippet is inserted.")
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 0, 1, true).
+		AddItem(help, 2, 0, false)
+
+	text := func(label string) string {
+		return strings.TrimSpace(form.GetFormItemByLabel(label).(*tview.InputField).GetText())
+	}
+	form.AddButton("Save", func() {
+		s.Folder = text("Folder")
+		s.Name = text("Name")
+		s.Description = text("Description")
+		s.Tags = strings.Split(text("Tags"), ",")
+		s.Body = strings.TrimSpace(body.GetText())
+		if s.Body == "" {
+			showErrorModal(app, layout, "The snippet has no query.")
+			return
+		}
+		if _, err := phhistory.SaveSnippet(s); err != nil {
+			showErrorModal(app, layout, err.Error())
+			return
+		}
+		saved()
+	})
+	form.AddButton("Cancel", func() {
+		app.SetRoot(returnTo, true)
+	})
+	form.SetCancelFunc(func() {
+		app.SetRoot(returnTo, true)
+	})
+
+	app.SetRoot(layout, true).SetFocus(form)
+}
+
+// Write the library to a directory of .sql files, one per snippet, or read one back in
+func showSnippetFiles(app *tview.Application, returnTo tview.Primitive, done func()) {
+	form := tview.NewForm().
+		AddInputField("Directory", lastSnippetDir, 50, nil, nil)
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).SetTitle(" Snippet files ").SetTitleAlign(tview.AlignLeft)
+
+	help := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText("[gray]Export writes <folder>/<name>.sql for every snippet, ready to commit and share.\n" +
+			"Import reads the .sql files under the directory; snippets with the same folder and name are replaced.")
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 0, 1, true).
+		AddItem(help, 2, 0, false)
+
+	run := func(export bool) {
+		dir := strings.TrimSpace(form.GetFormItemByLabel("Directory").(*tview.InputField).GetText())
+		if dir == "" {
+			showErrorModal(app, layout, "Enter a directory.")
+			return
+		}
+		lastSnippetDir = dir
+
+		action, load := "Imported", phhistory.ImportSnippets
+		if export {
+			action, load = "Exported", phhistory.ExportSnippets
+		}
+		count, err := load(dir)
+		util.SaveLog(fmt.Sprintf("%s %d snippet(s), directory %s, err=%v", action, count, dir, err))
+		if err != nil && export {
+			showErrorModal(app, layout, fmt.Sprintf("Exported %d snippet(s), then failed: %v", count, err))
+			return
+		}
+		if err != nil {
+			showErrorModal(app, layout, fmt.Sprintf("Nothing was imported: %v", err))
+			return
+		}
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("%s %d snippet(s), directory %s.", action, count, dir)).
+			AddButtons([]string{"OK"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				done()
+			})
+		app.SetRoot(modal, true)
+	}
+	form.AddButton("Export", func() {
+		run(true)
+	})
+	form.AddButton("Import", func() {
+		run(false)
+	})
+	form.AddButton("Cancel", func() {
+		app.SetRoot(returnTo, true)
+	})
+	form.SetCancelFunc(func() {
+		app.SetRoot(returnTo, true)
+	})
+
+	app.SetRoot(layout, true).SetFocus(form)
+}
+
+// The full snippet under the list
+func snippetDetails(s phhistory.Snippet) string {
+	var b strings.Builder
+	b.WriteString("[yellow::b]" + tview.Escape(s.Path()) + "[-::-]\n")
+	if s.Description != "" {
+		b.WriteString("[gray]" + tview.Escape(s.Description) + "[-]\n")
+	}
+	b.WriteString("\n" + tview.Escape(s.Body))
+	return b.String()
+}
@@ -0,0 +1,237 @@
+package ui
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mysql-tui/dump"
+	"mysql-tui/util"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Export the rows of a table matching a condition together with the rows they are tied to by foreign keys
+func showSubsetExport(app *tview.Application, db *sql.DB, dbName, table string) {
+	returnTo := CreateLayoutWithFooter(app, mainFlex)
+
+	var tables []string
+	start := 0
+	for _, obj := range allTables {
+		if obj.Type != "TABLE" {
+			continue
+		}
+		if obj.Name == table {
+			start = len(tables)
+		}
+		tables = append(tables, obj.Name)
+	}
+	if len(tables) == 0 {
+		showErrorModal(app, returnTo, "There are no tables in "+dbName+".")
+		return
+	}
+
+	fileName := dbName + "_subset.sql"
+	if table != "" {
+		fileName = dbName + "_" + table + "_subset.sql"
+	}
+	form := tview.NewForm().
+		AddDropDown("Start table", tables, start, nil).
+		AddInputField("WHERE", "", 50, nil, nil).
+		AddInputField("Limit", "", 8, tview.InputFieldInteger, nil).
+		AddDropDown("Follow", []string{"Referenced rows only", "Referenced and referencing rows"}, 0, nil).
+		AddInputField("Depth", "1", 8, tview.InputFieldInteger, nil).
+		AddInputField("Max rows", "1000000", 10, tview.InputFieldInteger, nil).
+		AddCheckbox("Include CREATE TABLE", false, nil).
+		AddCheckbox("DROP TABLE IF EXISTS", false, nil).
+		AddInputField("Directory", ".", 40, nil, nil).
+		AddInputField("File name", fileName, 40, nil, nil).
+		AddCheckbox("Compress (gzip)", false, nil).
+		AddInputField("Masking rules", lastMaskFile, 40, nil, nil)
+	form.SetFieldBackgroundColor(tcell.ColorLightGray)
+	form.SetBorder(true).SetTitle(" Subset export of " + dbName + " ").SetTitleAlign(tview.AlignLeft)
+
+	help := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText("[gray]WHERE selects the starting rows, e.g. id IN (1, 2, 3); empty takes them all.\n" +
+			"Every row they reference is always included. Depth limits the levels of referencing rows, 0 follows them all.")
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 0, 1, true).
+		AddItem(help, 2, 0, false)
+
+	text := func(label string) string {
+		return strings.TrimSpace(form.GetFormItemByLabel(label).(*tview.InputField).GetText())
+	}
+	checked := func(label string) bool {
+		return form.GetFormItemByLabel(label).(*tview.Checkbox).IsChecked()
+	}
+	number := func(label string) (int, bool) {
+		if text(label) == "" {
+			return 0, true
+		}
+		n, err := strconv.Atoi(text(label))
+		return n, err == nil && n >= 0
+	}
+
+	form.AddButton("Export", func() {
+		opts := dump.SubsetOptions{Database: dbName, Where: text("WHERE")}
+		index, _ := form.GetFormItemByLabel("Start table").(*tview.DropDown).GetCurrentOption()
+		opts.Table = tables[index]
+		followIndex, _ := form.GetFormItemByLabel("Follow").(*tview.DropDown).GetCurrentOption()
+		opts.Children = followIndex == 1
+		opts.Schema = checked("Include CREATE TABLE")
+		opts.DropTable = opts.Schema && checked("DROP TABLE IF EXISTS")
+
+		var ok bool
+		if opts.Limit, ok = number("Limit"); !ok {
+			showErrorModal(app, layout, "Limit must be a number, or empty for no limit.")
+			return
+		}
+		if opts.Depth, ok = number("Depth"); !ok {
+			showErrorModal(app, layout, "Depth must be a number, 0 for no limit.")
+			return
+		}
+		if opts.MaxRows, ok = number("Max rows"); !ok {
+			showErrorModal(app, layout, "Max rows must be a number, 0 for no limit.")
+			return
+		}
+
+		var err error
+		if opts.Mask, err = loadMaskFile(text("Masking rules")); err != nil {
+			showErrorModal(app, layout, "Cannot load the masking rules: "+err.Error())
+			return
+		}
+
+		dir, name := text("Directory"), text("File name")
+		if name == "" {
+			showErrorModal(app, layout, "Enter a file name.")
+			return
+		}
+		if dir == "" {
+			dir = "."
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			showErrorModal(app, layout, "Cannot create directory: "+err.Error())
+			return
+		}
+		path := filepath.Join(dir, name)
+		compress := checked("Compress (gzip)")
+		if compress && !strings.HasSuffix(path, ".gz") {
+			path += ".gz"
+		}
+		runSubsetExport(app, db, opts, path, compress, returnTo)
+	})
+	form.AddButton("Cancel", func() {
+		app.SetRoot(returnTo, true)
+	})
+	form.SetCancelFunc(func() {
+		app.SetRoot(returnTo, true)
+	})
+
+	app.SetRoot(layout, true).SetFocus(form)
+}
+
+// Collect and write the subset in the background, showing the rows found per table; Esc stops it
+func runSubsetExport(app *tview.Application, db *sql.DB, opts dump.SubsetOptions, path string, compress bool, returnTo tview.Primitive) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	status := tview.NewTextView().SetDynamicColors(true)
+	status.SetBorder(true).SetTitle(" Subset of " + opts.Table + " to " + filepath.Base(path) + " ").SetTitleAlign(tview.AlignLeft)
+	tablesView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+	tablesView.SetBorder(true).SetTitle(" Tables ").SetTitleAlign(tview.AlignLeft)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(status, 4, 0, false).
+		AddItem(tablesView, 0, 1, true)
+
+	started := time.Now()
+	done := false
+	// table -> rows found, in the order first reached
+	counts := map[string]int{}
+	var order []string
+	render := func(state string) {
+		total := 0
+		var b strings.Builder
+		for _, name := range order {
+			total += counts[name]
+			b.WriteString(fmt.Sprintf("%-40s %10d\n", tview.Escape(name), counts[name]))
+		}
+		status.SetText(fmt.Sprintf("%s\nTables: %d  Rows: %d  Elapsed: %s",
+			state, len(order), total, time.Since(started).Round(time.Second)))
+		tablesView.SetText(b.String())
+	}
+	render("[blue]Collecting rows... (Esc: Stop)")
+
+	var lastDraw time.Time
+	onProgress := func(t dump.SubsetTable) {
+		app.QueueUpdate(func() {
+			if _, ok := counts[t.Name]; !ok {
+				order = append(order, t.Name)
+			}
+			counts[t.Name] = t.Rows
+		})
+		if time.Since(lastDraw) < 200*time.Millisecond {
+			return
+		}
+		lastDraw = time.Now()
+		app.QueueUpdateDraw(func() {
+			if !done {
+				render("[blue]Collecting rows... (Esc: Stop)")
+			}
+		})
+	}
+
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			if !done {
+				cancel()
+				return nil
+			}
+			app.SetRoot(returnTo, true)
+			return nil
+		}
+		return event
+	})
+
+	go func() {
+		tables, err := dump.ExportSubset(ctx, db, path, compress, opts, onProgress)
+		cancel()
+
+		rows := 0
+		for _, t := range tables {
+			rows += t.Rows
+		}
+		state := fmt.Sprintf("[green]Wrote %d rows of %d table(s) to %s", rows, len(tables), tview.Escape(path))
+		switch {
+		case errors.Is(err, context.Canceled):
+			state = "[yellow]Subset export stopped, no file was written."
+		case err != nil:
+			state = "[red]Subset export failed: " + tview.Escape(err.Error())
+		}
+		util.SaveLog(fmt.Sprintf("Subset export of %s.%s WHERE %q to %s: %d rows in %d tables, err=%v",
+			opts.Database, opts.Table, opts.Where, path, rows, len(tables), err))
+
+		app.QueueUpdateDraw(func() {
+			done = true
+			if err == nil {
+				// Script order and final counts
+				counts, order = map[string]int{}, nil
+				for _, t := range tables {
+					counts[t.Name] = t.Rows
+					order = append(order, t.Name)
+				}
+			}
+			render(state + "\n[white]Esc: Back")
+		})
+	}()
+
+	app.SetRoot(layout, true).SetFocus(layout)
+}
@@ -0,0 +1,303 @@
+package ui
+
+import (
+	"database/sql"
+	"fmt"
+	"mysql-tui/phhistory"
+	"mysql-tui/util"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Runs statements for execAndRecord: a *sql.DB or *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Update a single cell of the row with the given primary key and record its before-image in the undo log.
+// The read and the update share a transaction, and the change is only kept when exactly one row matched.
+func updateCell(db *sql.DB, dbName, tableName string, keyColumns, keyValues []string, columnName, newValue string) error {
+	return updateCellValue(db, dbName, tableName, keyColumns, keyValues, columnName, sql.NullString{String: newValue, Valid: true})
+}
+
+// updateCell for a value that may be NULL
+func updateCellValue(db *sql.DB, dbName, tableName string, keyColumns, keyValues []string, columnName string, newValue sql.NullString) error {
+	if len(keyColumns) == 0 || len(keyColumns) != len(keyValues) {
+		return fmt.Errorf("the row has no complete primary key")
+	}
+	var conds []string
+	var keyArgs []interface{}
+	for i, col := range keyColumns {
+		conds = append(conds, fmt.Sprintf("`%s` = ?", col))
+		keyArgs = append(keyArgs, keyValues[i])
+	}
+	where := strings.Join(conds, " AND ")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	selectQuery := fmt.Sprintf("SELECT `%s` FROM `%s`.`%s` WHERE %s FOR UPDATE", columnName, dbName, tableName, where)
+	rows, err := tx.Query(selectQuery, keyArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to read current value: %w", err)
+	}
+	var before sql.NullString
+	matched := 0
+	for rows.Next() {
+		if err := rows.Scan(&before); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read current value: %w", err)
+		}
+		matched++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read current value: %w", err)
+	}
+	if matched != 1 {
+		return fmt.Errorf("the key matches %d rows instead of one, nothing was changed", matched)
+	}
+
+	var value interface{}
+	if newValue.Valid {
+		value = newValue.String
+	}
+	query := fmt.Sprintf("UPDATE `%s`.`%s` SET `%s` = ? WHERE %s", dbName, tableName, columnName, where)
+	fullQuery, affected, err := execAndRecord(tx, dbName, query, append([]interface{}{value}, keyArgs...)...)
+	if err != nil {
+		return err
+	}
+	// 0 when the value did not change
+	if affected > 1 {
+		return fmt.Errorf("the update changed %d rows instead of one and was rolled back", affected)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	util.SaveLog(fullQuery)
+	if affected != 1 {
+		return nil
+	}
+
+	entry := phhistory.UndoEntry{
+		DBName:     dbName,
+		TableName:  tableName,
+		Operation:  phhistory.OpUpdate,
+		KeyColumns: keyColumns,
+		KeyValues:  keyValues,
+		Before:     map[string]*string{columnName: nullStringPtr(before)},
+		After:      map[string]*string{columnName: nullStringPtr(newValue)},
+	}
+	if _, err := phhistory.SaveUndo(entry); err != nil {
+		util.SaveLog("Failed to record undo entry: " + err.Error())
+	}
+	return nil
+}
+
+// Values of the primary key columns in one grid row
+func gridRowKey(table *tview.Table, row int, keyColumns []string) ([]string, error) {
+	var values []string
+	for _, col := range keyColumns {
+		idx := gridColumnIndex(table, col)
+		if idx < 0 {
+			return nil, fmt.Errorf("the primary key column %s is not part of the result", col)
+		}
+		value, ok := gridCellValue(table, row, idx)
+		if !ok {
+			return nil, fmt.Errorf("the primary key column %s is NULL", col)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Run a statement and record it in the history, whether it worked or not.
+// It returns the statement with its arguments filled in, as recorded, and the rows it changed (-1 unknown).
+func execAndRecord(ex sqlExecer, dbName, query string, args ...interface{}) (string, int64, error) {
+	started := time.Now()
+	res, err := ex.Exec(query, args...)
+	run := phhistory.QueryRun{Duration: time.Since(started), Rows: -1, Affected: -1, Err: err}
+	if err == nil {
+		if n, countErr := res.RowsAffected(); countErr == nil {
+			run.Affected = n
+		}
+	}
+	fullQuery := phhistory.ReplacePlaceholders(query, args...)
+	if saveErr := phhistory.SaveQuery(fullQuery, dbName, run); saveErr != nil {
+		util.SaveLog("Failed to record query: " + saveErr.Error())
+	}
+	return fullQuery, run.Affected, err
+}
+
+// Run the inverse statement of an undo entry
+func undoChange(db *sql.DB, entry phhistory.UndoEntry) error {
+	if entry.Undone {
+		return fmt.Errorf("change #%d was already undone", entry.ID)
+	}
+	query, args, err := entry.Inverse()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	fullQuery, affected, err := execAndRecord(tx, entry.DBName, query, args...)
+	if err != nil {
+		return fmt.Errorf("undo failed: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("change #%d was not undone: the row was changed or deleted since", entry.ID)
+	}
+	if affected > 1 {
+		return fmt.Errorf("undo would change %d rows instead of one and was rolled back", affected)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("undo failed: %w", err)
+	}
+	if err := phhistory.MarkUndone(entry.ID); err != nil {
+		return err
+	}
+	util.SaveLog("UNDO: " + fullQuery)
+	return nil
+}
+
+// Undo the latest change of this session and refresh the grid
+func undoLastChange(app *tview.Application, db *sql.DB, table *tview.Table) {
+	entry, err := phhistory.LastUndo()
+	if err != nil {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "Failed to read undo log: "+err.Error())
+		return
+	}
+	if entry == nil {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "Nothing to undo in this session.")
+		return
+	}
+	if err := undoChange(db, *entry); err != nil {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), err.Error())
+		return
+	}
+	refreshEditableGrid(app, db, table)
+}
+
+// Re-run the browse query so the grid reflects reverted values
+func refreshEditableGrid(app *tview.Application, db *sql.DB, table *tview.Table) {
+	if isEditingEnabled && lastExecutedQuery != "" {
+		ExecuteQuery(app, db, lastExecutedQuery, table, lastExecutedArgs...)
+		if len(gridTrail) > 0 {
+			applyGridLocation(db, gridTrail[len(gridTrail)-1], table)
+		}
+	}
+	layout := CreateLayoutWithFooter(app, mainFlex)
+	app.SetRoot(layout, true)
+	app.SetFocus(table)
+}
+
+// Show the recent changes of this session; Enter undoes the selected one
+func showUndoLog(app *tview.Application, db *sql.DB, dataTable *tview.Table) {
+	entries, err := phhistory.RecentUndo(200)
+	if err != nil {
+		showErrorModal(app, CreateLayoutWithFooter(app, mainFlex), "Failed to read undo log: "+err.Error())
+		return
+	}
+
+	list := tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	list.SetBorder(true).
+		SetTitle(" [::b]Recent Changes[::-] - [green]Enter:[-]Undo  [green]Esc:[-]Back ").
+		SetTitleAlign(tview.AlignLeft)
+
+	headers := []string{"#", "Time", "Operation", "Table", "Key", "Change", "Status"}
+	for i, h := range headers {
+		list.SetCell(0, i, tview.NewTableCell("[::b]"+h).
+			SetTextColor(tcell.ColorYellow).
+			SetSelectable(false))
+	}
+
+	for i, e := range entries {
+		status := "[green]applied"
+		if e.Undone {
+			status = "[gray]undone"
+		}
+		row := i + 1
+		list.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("%d", e.ID)))
+		list.SetCell(row, 1, tview.NewTableCell(e.CreatedAt.Local().Format("15:04:05")))
+		list.SetCell(row, 2, tview.NewTableCell(e.Operation))
+		list.SetCell(row, 3, tview.NewTableCell(e.DBName+"."+e.TableName))
+		list.SetCell(row, 4, tview.NewTableCell(tview.Escape(e.Key())))
+		list.SetCell(row, 5, tview.NewTableCell(tview.Escape(describeChange(e))).SetMaxWidth(60))
+		list.SetCell(row, 6, tview.NewTableCell(status))
+	}
+	if len(entries) == 0 {
+		list.SetCell(1, 0, tview.NewTableCell("[gray]No changes recorded in this session").SetSelectable(false))
+	}
+
+	list.SetSelectedFunc(func(row, column int) {
+		if row < 1 || row > len(entries) {
+			return
+		}
+		entry := entries[row-1]
+		if entry.Undone {
+			return
+		}
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("Undo change #%d on %s?\n\n%s", entry.ID, entry.TableName, describeChange(entry))).
+			AddButtons([]string{"Undo", "Cancel"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				if buttonLabel != "Undo" {
+					app.SetRoot(list, true).SetFocus(list)
+					return
+				}
+				if err := undoChange(db, entry); err != nil {
+					showErrorModal(app, list, err.Error())
+					return
+				}
+				refreshEditableGrid(app, db, dataTable)
+			})
+		app.SetRoot(modal, true)
+	})
+
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			layout := CreateLayoutWithFooter(app, mainFlex)
+			app.SetRoot(layout, true)
+			app.SetFocus(dataTable)
+			return nil
+		}
+		return event
+	})
+
+	app.SetRoot(list, true).SetFocus(list)
+}
+
+func describeChange(e phhistory.UndoEntry) string {
+	var parts []string
+	for col, before := range e.Before {
+		parts = append(parts, fmt.Sprintf("%s: %s -> %s", col, displayValue(before), displayValue(e.After[col])))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func displayValue(v *string) string {
+	if v == nil {
+		return "NULL"
+	}
+	return "'" + *v + "'"
+}
+
+func nullStringPtr(v sql.NullString) *string {
+	if !v.Valid {
+		return nil
+	}
+	s := v.String
+	return &s
+}